@@ -4,6 +4,9 @@ import (
 	ethgoAbi "github.com/umbracle/ethgo/abi"
 )
 
+// AbiIO and AbiMember are the functionAbi of a Lit access condition. Lit
+// finds a key by the hash of its conditions, so their JSON must stay
+// exactly as keys were first saved with. Use Function for a faithful ABI.
 type AbiIO struct {
 	Name string `json:"name"`
 	Type string `json:"type"`
@@ -30,8 +33,6 @@ func ToAbiIOGroup(t *ethgoAbi.Type) []AbiIO {
 		}
 	}
 
-	// TODO: support more types
-
 	return io
 }
 
@@ -0,0 +1,133 @@
+package abi
+
+import (
+	"encoding/json"
+	"fmt"
+
+	ethgoAbi "github.com/umbracle/ethgo/abi"
+)
+
+// Param is a function input or output as written in a JSON ABI.
+type Param struct {
+	Name         string  `json:"name"`
+	Type         string  `json:"type"`
+	InternalType string  `json:"internalType,omitempty"`
+	Components   []Param `json:"components,omitempty"`
+	Indexed      bool    `json:"indexed,omitempty"`
+}
+
+// Function is a JSON ABI function entry with its real state mutability.
+// It is what /contracts/abis publishes, never what Lit conditions hold.
+type Function struct {
+	Name            string  `json:"name"`
+	Type            string  `json:"type"`
+	Inputs          []Param `json:"inputs"`
+	Outputs         []Param `json:"outputs"`
+	Constant        bool    `json:"constant"`
+	StateMutability string  `json:"stateMutability"`
+}
+
+// TypeName returns the solidity type as it appears in a JSON ABI. Tuples
+// are written as "tuple" with their fields moved to components.
+func TypeName(t *ethgoAbi.Type) string {
+	switch t.Kind() {
+	case ethgoAbi.KindTuple:
+		return "tuple"
+	case ethgoAbi.KindSlice:
+		return TypeName(t.Elem()) + "[]"
+	case ethgoAbi.KindArray:
+		return fmt.Sprintf("%s[%d]", TypeName(t.Elem()), t.Size())
+	default:
+		return t.String()
+	}
+}
+
+func components(t *ethgoAbi.Type) []Param {
+	for t.Kind() == ethgoAbi.KindSlice || t.Kind() == ethgoAbi.KindArray {
+		t = t.Elem()
+	}
+
+	if t.Kind() != ethgoAbi.KindTuple {
+		return nil
+	}
+
+	return ToParams(t)
+}
+
+func ToParams(t *ethgoAbi.Type) []Param {
+	params := make([]Param, 0)
+
+	if t == nil || t.Kind() != ethgoAbi.KindTuple {
+		return params
+	}
+
+	for _, te := range t.TupleElems() {
+		params = append(params, Param{
+			Name:       te.Name,
+			Type:       TypeName(te.Elem),
+			Components: components(te.Elem),
+			Indexed:    te.Indexed,
+		})
+	}
+
+	return params
+}
+
+// MethodToFunction converts a parsed method. ethgo drops internalType and
+// folds pure into view, so prefer ParseFunctions when the raw ABI is
+// available.
+func MethodToFunction(m *ethgoAbi.Method) Function {
+	mutability := "nonpayable"
+	if m.Const {
+		mutability = "view"
+	}
+
+	return Function{
+		Constant:        m.Const,
+		Inputs:          ToParams(m.Inputs),
+		Name:            m.Name,
+		Outputs:         ToParams(m.Outputs),
+		StateMutability: mutability,
+		Type:            "function",
+	}
+}
+
+// ParseFunctions reads the functions of a JSON ABI keeping every field.
+// Overloaded functions are keyed by their first declaration.
+func ParseFunctions(data []byte) (map[string]Function, error) {
+	var entries []Function
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+
+	functions := make(map[string]Function)
+	for _, e := range entries {
+		if e.Type != "function" && e.Type != "" {
+			continue
+		}
+		e.Type = "function"
+
+		if e.StateMutability == "" {
+			// Pre 0.5 ABIs only have the constant flag
+			if e.Constant {
+				e.StateMutability = "view"
+			} else {
+				e.StateMutability = "nonpayable"
+			}
+		}
+		e.Constant = e.StateMutability == "view" || e.StateMutability == "pure"
+
+		if e.Inputs == nil {
+			e.Inputs = make([]Param, 0)
+		}
+		if e.Outputs == nil {
+			e.Outputs = make([]Param, 0)
+		}
+
+		if _, ok := functions[e.Name]; !ok {
+			functions[e.Name] = e
+		}
+	}
+
+	return functions, nil
+}
@@ -0,0 +1,90 @@
+package abi
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	ethgoAbi "github.com/umbracle/ethgo/abi"
+)
+
+func TestParseFunctions(t *testing.T) {
+	data := `[
+		{"type":"function","name":"verifyOwner","stateMutability":"view","inputs":[{"name":"cid","type":"bytes32","internalType":"bytes32"},{"name":"account","type":"address","internalType":"address"}],"outputs":[{"name":"","type":"bool","internalType":"bool"}]},
+		{"type":"function","name":"hash","stateMutability":"pure","inputs":[{"name":"cids","type":"bytes32[]","internalType":"bytes32[]"}],"outputs":[{"name":"","type":"bytes32","internalType":"bytes32"}]},
+		{"type":"function","name":"batch","stateMutability":"nonpayable","inputs":[{"name":"items","type":"tuple[2]","internalType":"struct Item[2]","components":[{"name":"id","type":"uint256","internalType":"uint256"},{"name":"tags","type":"string[]","internalType":"string[]"}]}],"outputs":[]},
+		{"constant":true,"name":"legacy","inputs":[],"outputs":[{"name":"","type":"uint256"}]},
+		{"type":"event","name":"Transfer","inputs":[{"name":"to","type":"address","indexed":true}]}
+	]`
+
+	functions, err := ParseFunctions([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		mutability string
+		constant   bool
+	}{
+		{"verifyOwner", "view", true},
+		{"hash", "pure", true},
+		{"batch", "nonpayable", false},
+		{"legacy", "view", true},
+	}
+
+	if len(functions) != len(tests) {
+		t.Fatalf("got %d functions, want %d", len(functions), len(tests))
+	}
+
+	for _, tt := range tests {
+		f, ok := functions[tt.name]
+		if !ok {
+			t.Fatalf("%s missing", tt.name)
+		}
+		if f.StateMutability != tt.mutability || f.Constant != tt.constant {
+			t.Errorf("%s: %s %v, want %s %v", tt.name, f.StateMutability, f.Constant, tt.mutability, tt.constant)
+		}
+	}
+
+	// Round trip: re-parsing the output gives the same functions
+	out, err := json.Marshal([]Function{functions["batch"]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := ParseFunctions(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(again["batch"], functions["batch"]) {
+		t.Errorf("round trip changed batch:\n got %+v\nwant %+v", again["batch"], functions["batch"])
+	}
+}
+
+func TestMethodToFunction(t *testing.T) {
+	a, err := ethgoAbi.NewABI(`[{"type":"function","name":"batch","stateMutability":"view","inputs":[{"name":"items","type":"tuple[2]","components":[{"name":"id","type":"uint256"},{"name":"cids","type":"bytes32[]"}]}],"outputs":[{"name":"ok","type":"bool"}]}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := MethodToFunction(a.GetMethod("batch"))
+	want := Function{
+		Name: "batch",
+		Type: "function",
+		Inputs: []Param{{
+			Name: "items",
+			Type: "tuple[2]",
+			Components: []Param{
+				{Name: "id", Type: "uint256"},
+				{Name: "cids", Type: "bytes32[]"},
+			},
+		}},
+		Outputs:         []Param{{Name: "ok", Type: "bool"}},
+		Constant:        true,
+		StateMutability: "view",
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+}
@@ -68,9 +68,9 @@ func GenerateAccount(homeDir string) (*Account, error) {
 	}
 
 	fmt.Println("")
-	fmt.Println("Your node has generated a new Ethereum wallet that will be used for submitting your stake and receiving rewards. This is a self-custodial wallet meaning that you are responsible for backing up your recovery phrase in case your private key is deleted.\n")
-	fmt.Println("Make sure you copy this recovery phrase, write it down on paper, and store it safely. If you lose this phrase and your private keys are deleted, you will not be able to recover any funds held in the wallet.\n")
-	fmt.Println("Your recovery phrase is:\n")
+	fmt.Print("Your node has generated a new Ethereum wallet that will be used for submitting your stake and receiving rewards. This is a self-custodial wallet meaning that you are responsible for backing up your recovery phrase in case your private key is deleted.\n\n")
+	fmt.Print("Make sure you copy this recovery phrase, write it down on paper, and store it safely. If you lose this phrase and your private keys are deleted, you will not be able to recover any funds held in the wallet.\n\n")
+	fmt.Print("Your recovery phrase is:\n\n")
 	fmt.Println(phrase)
 	fmt.Println("")
 
@@ -66,6 +66,17 @@ func (a *Account) Siwe(chain, msg string) (*AuthSig, error) {
 	return authSig, nil
 }
 
+// Sign signs msg as an EIP-191 personal message, which RecoverAddress
+// checks.
+func (a *Account) Sign(msg string) (string, error) {
+	sig, err := a.Wallet.SignMsg(EIP191(msg))
+	if err != nil {
+		return "", err
+	}
+
+	return "0x" + hex.EncodeToString(sig), nil
+}
+
 func RecoverAddress(signature, plaintext string) (addr ethgo.Address, err error) {
 	var sig []byte
 	sig, err = hex.DecodeString(signature[2:] /* Remove 0x */)
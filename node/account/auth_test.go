@@ -0,0 +1,42 @@
+package account
+
+import (
+	"testing"
+
+	"github.com/umbracle/ethgo/wallet"
+)
+
+func TestSign(t *testing.T) {
+	key, err := wallet.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &Account{Address: key.Address(), Wallet: key}
+
+	msg := `{"node":"` + a.Address.String() + `","rows":[]}`
+	sig, err := a.Sign(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		msg    string
+		signer bool
+	}{
+		{"signed message", msg, true},
+		{"altered message", msg + " ", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, err := RecoverAddress(sig, tt.msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if signer := addr == a.Address; signer != tt.signer {
+				t.Errorf("got %s, want the signer %v", addr, tt.signer)
+			}
+		})
+	}
+}
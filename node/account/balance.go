@@ -4,6 +4,7 @@ import (
 	"blocksui-node/contracts"
 	"fmt"
 	"math/big"
+	"time"
 
 	"github.com/umbracle/ethgo"
 )
@@ -17,17 +18,43 @@ func (a *Account) StakeBalance() (*big.Int, error) {
 }
 
 func (a *Account) VerifyStake() bool {
-	cost, err := contracts.StakingCost()
+	cost, balance, err := contracts.StakeStatus(a.Address)
 	if err != nil {
 		fmt.Printf("[contracts]\t%v\n", err)
 		return false
 	}
 
-	balance, err := contracts.StakeBalance(a.Address)
-	if err != nil {
-		fmt.Printf("[contracts]\t%v\n", err)
-		return false
+	return balance.Cmp(cost) != -1
+}
+
+// WatchStake logs a warning whenever the stake is within margin percent of
+// the staking cost, so operators can top up before the node is dropped.
+func (a *Account) WatchStake(chain contracts.Chain, interval time.Duration, margin int64) {
+	for {
+		time.Sleep(interval)
+
+		cost, balance, err := contracts.StakeStatus(a.Address)
+		if err != nil {
+			fmt.Printf("[stake]\t%v\n", err)
+			continue
+		}
+
+		if warning := stakeWarning(chain, cost, balance, margin); warning != "" {
+			fmt.Printf("[stake]\tWarning: %s\n", warning)
+		}
 	}
+}
 
-	return balance.Cmp(cost) != -1
+// stakeWarning is what to tell the operator about balance, if anything.
+func stakeWarning(chain contracts.Chain, cost, balance *big.Int, margin int64) string {
+	threshold := new(big.Int).Mul(cost, big.NewInt(100+margin))
+	threshold.Div(threshold, big.NewInt(100))
+
+	if balance.Cmp(cost) == -1 {
+		return fmt.Sprintf("stake %s is below the staking cost %s. Run `bui stake topup`.", chain.FormatUnits(balance), chain.FormatUnits(cost))
+	} else if balance.Cmp(threshold) == -1 {
+		return fmt.Sprintf("stake %s is within %d%% of the staking cost %s.", chain.FormatUnits(balance), margin, chain.FormatUnits(cost))
+	}
+
+	return ""
 }
@@ -0,0 +1,33 @@
+package account
+
+import (
+	"blocksui-node/contracts"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestStakeWarning(t *testing.T) {
+	chain, _ := contracts.ChainForName("mumbai")
+	cost := big.NewInt(1000)
+
+	tests := []struct {
+		name    string
+		balance int64
+		want    string
+	}{
+		{"below the cost", 999, "below the staking cost"},
+		{"within the margin", 1099, "within 10%"},
+		{"at the margin", 1100, ""},
+		{"well staked", 5000, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := stakeWarning(chain, cost, big.NewInt(tt.balance), 10)
+			if tt.want == "" && got != "" || !strings.Contains(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"blocksui-node/account"
+	"blocksui-node/analytics"
+	"blocksui-node/config"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+var (
+	// Analytics Flags
+	analyticsFlags = flag.NewFlagSet("analytics", flag.ExitOnError)
+	analyticsSince = analyticsFlags.String("since", "", "--since 2006-01-02 - First day to export, 30 days ago by default")
+	analyticsUntil = analyticsFlags.String("until", "", "--until 2006-01-02 - Last day to export, today by default")
+	analyticsOut   = analyticsFlags.String("o", "", "-o analytics.json - Where to write the signed batch, stdout by default")
+)
+
+func analyticsUsage() {
+	fmt.Println("")
+	fmt.Println("Usage: bui analytics export [OPTIONS]")
+	fmt.Println("")
+	analyticsFlags.PrintDefaults()
+	fmt.Println("")
+}
+
+func parseDay(flagName, v string, fallback time.Time) time.Time {
+	if v == "" {
+		return fallback
+	}
+
+	t, err := time.Parse("2006-01-02", v)
+	if err != nil {
+		fmt.Printf("Invalid date for --%s: %s\n", flagName, v)
+		os.Exit(1)
+	}
+
+	return t
+}
+
+func exportAnalytics(c *config.Config, args []string) {
+	if len(args) == 0 || args[0] != "export" {
+		analyticsUsage()
+		os.Exit(1)
+	}
+
+	parseFlags(analyticsFlags, args[1:])
+	if analyticsFlags.NArg() != 0 {
+		analyticsUsage()
+		os.Exit(1)
+	}
+
+	until := parseDay("until", *analyticsUntil, time.Now().UTC())
+	since := parseDay("since", *analyticsSince, until.AddDate(0, 0, -29))
+	if since.After(until) {
+		fmt.Println("--since must not be after --until")
+		os.Exit(1)
+	}
+
+	a, err := account.LoadAccount(c)
+	if err != nil {
+		fmt.Printf("[Load Accounts] %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := analytics.Start(c, a.Address); err != nil {
+		fmt.Printf("[Analytics] %v\n", err)
+		os.Exit(1)
+	}
+
+	batch, err := analytics.Export(a, since, until)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	data, err := json.MarshalIndent(batch, "", "  ")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if *analyticsOut == "" {
+		fmt.Println(string(data))
+		return
+	}
+
+	if err := os.WriteFile(*analyticsOut, data, 0644); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Exported %s through %s to %s, signed by %s\n", since.Format("2006-01-02"), until.Format("2006-01-02"), *analyticsOut, a.Address)
+}
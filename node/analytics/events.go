@@ -0,0 +1,237 @@
+// Package analytics records every block the node serves in an append-only
+// event log and aggregates the serves per block, origin and day for the
+// block's creator.
+package analytics
+
+import (
+	"blocksui-node/config"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/umbracle/ethgo"
+)
+
+const dayFormat = "2006-01-02"
+
+// Event is one successful serve of a block.
+type Event struct {
+	Block   string        `json:"block"`
+	TokenId uint64        `json:"tokenId"`
+	Type    string        `json:"type"`
+	Origin  string        `json:"origin"`
+	Time    time.Time     `json:"time"`
+	Node    ethgo.Address `json:"node"`
+}
+
+// Counts are serves, split by whether a licence or the block itself was
+// presented.
+type Counts struct {
+	Serves   uint64 `json:"serves"`
+	Licensed uint64 `json:"licensed"`
+	Owner    uint64 `json:"owner"`
+}
+
+func (c *Counts) add(o Counts) {
+	c.Serves += o.Serves
+	c.Licensed += o.Licensed
+	c.Owner += o.Owner
+}
+
+// days maps a UTC day to the serves on it.
+type days map[string]*Counts
+
+type recorder struct {
+	node ethgo.Address
+	path string
+	file *os.File
+
+	mu sync.RWMutex
+	// block -> origin -> day
+	aggregates map[string]map[string]days
+}
+
+var events *recorder
+
+// Start replays the event log into the aggregates and opens it for
+// appending events served by node.
+func Start(c *config.Config, node ethgo.Address) error {
+	if events != nil {
+		return fmt.Errorf("Already initialized")
+	}
+
+	rec := &recorder{
+		node:       node,
+		path:       filepath.Join(c.HomeDir, ".bui", "events.log"),
+		aggregates: make(map[string]map[string]days),
+	}
+
+	if err := rec.replay(); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(rec.path), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(rec.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	// Start a new line after a torn one so the next event isn't lost too
+	if info, err := file.Stat(); err == nil && info.Size() > 0 && !endsWithNewline(rec.path) {
+		if _, err := file.Write([]byte{'\n'}); err != nil {
+			return err
+		}
+	}
+
+	rec.file = file
+	events = rec
+
+	return nil
+}
+
+// Close syncs the event log to disk and stops recording, for a shutdown.
+func Close() error {
+	if events == nil {
+		return nil
+	}
+
+	events.mu.Lock()
+	defer events.mu.Unlock()
+
+	if events.file == nil {
+		return nil
+	}
+
+	err := events.file.Sync()
+	if cerr := events.file.Close(); err == nil {
+		err = cerr
+	}
+	events.file = nil
+
+	return err
+}
+
+func endsWithNewline(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	last := make([]byte, 1)
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	if _, err := file.ReadAt(last, info.Size()-1); err != nil {
+		return false
+	}
+
+	return last[0] == '\n'
+}
+
+func (rec *recorder) replay() error {
+	file, err := os.Open(rec.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	skipped := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			// A crash can leave the last line torn
+			skipped++
+			continue
+		}
+		rec.aggregate(e)
+	}
+
+	if skipped > 0 {
+		fmt.Printf("[analytics]\tSkipped %d unreadable events\n", skipped)
+	}
+
+	return scanner.Err()
+}
+
+// aggregate adds e to the totals. Callers hold the lock or own rec.
+func (rec *recorder) aggregate(e Event) {
+	origins, ok := rec.aggregates[e.Block]
+	if !ok {
+		origins = make(map[string]days)
+		rec.aggregates[e.Block] = origins
+	}
+
+	byDay, ok := origins[e.Origin]
+	if !ok {
+		byDay = make(days)
+		origins[e.Origin] = byDay
+	}
+
+	day := e.Time.UTC().Format(dayFormat)
+	counts, ok := byDay[day]
+	if !ok {
+		counts = &Counts{}
+		byDay[day] = counts
+	}
+
+	counts.add(countsFor(e))
+}
+
+func countsFor(e Event) Counts {
+	c := Counts{Serves: 1}
+	if e.Type == "license" {
+		c.Licensed = 1
+	} else {
+		c.Owner = 1
+	}
+
+	return c
+}
+
+// Record appends a serve to the log and the aggregates.
+func Record(block string, tokenId uint64, kind, origin string) error {
+	if events == nil {
+		return fmt.Errorf("Analytics are not initialized")
+	}
+
+	e := Event{
+		Block:   strings.ToLower(block),
+		TokenId: tokenId,
+		Type:    kind,
+		Origin:  strings.TrimRight(strings.ToLower(origin), "/"),
+		Time:    time.Now().UTC(),
+		Node:    events.node,
+	}
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	events.mu.Lock()
+	defer events.mu.Unlock()
+
+	if events.file == nil {
+		return fmt.Errorf("Analytics are closed")
+	}
+	if _, err := events.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+
+	events.aggregate(e)
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package analytics
+
+import (
+	"blocksui-node/config"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/umbracle/ethgo"
+)
+
+func TestReplayTornLine(t *testing.T) {
+	c := &config.Config{HomeDir: t.TempDir()}
+	path := filepath.Join(c.HomeDir, ".bui", "events.log")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	log := `{"block":"0xaa","tokenId":1,"type":"license","origin":"https://a.com","time":"` + now + `"}
+{"block":"0xaa","tokenId":1,"type":"block","origin":"https://b.com","time":"` + now + `"}
+{"block":"0xaa","tokenId":1,"type":"lic`
+	if err := os.WriteFile(path, []byte(log), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	start := func() {
+		events = nil
+		if err := Start(c, ethgo.Address{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer func() {
+		Close()
+		events = nil
+	}()
+
+	total := func() Counts {
+		stats, err := Stats("0xAA", time.Now().Add(-24*time.Hour), time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return stats.Total
+	}
+
+	start()
+	if got, want := total(), (Counts{Serves: 2, Licensed: 1, Owner: 1}); got != want {
+		t.Errorf("got %+v after replay, want %+v", got, want)
+	}
+
+	// The next serve starts its own line rather than joining the torn one
+	if err := Record("0xaa", 1, "license", "https://a.com/"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	start()
+	if got, want := total(), (Counts{Serves: 3, Licensed: 2, Owner: 1}); got != want {
+		t.Errorf("got %+v after a restart, want %+v", got, want)
+	}
+}
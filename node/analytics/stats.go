@@ -0,0 +1,178 @@
+package analytics
+
+import (
+	"blocksui-node/account"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/umbracle/ethgo"
+)
+
+// OriginStats are a block's serves to one origin.
+type OriginStats struct {
+	Origin string `json:"origin"`
+	Counts
+	FirstDay string `json:"firstDay"`
+	LastDay  string `json:"lastDay"`
+}
+
+type DayStats struct {
+	Day string `json:"day"`
+	Counts
+}
+
+// BlockStats are a block's serves between Since and Until, both whole UTC
+// days.
+type BlockStats struct {
+	Block   string        `json:"block"`
+	Since   string        `json:"since"`
+	Until   string        `json:"until"`
+	Total   Counts        `json:"total"`
+	Origins []OriginStats `json:"origins"`
+	Days    []DayStats    `json:"days"`
+}
+
+// Row is one block's serves to one origin on one day.
+type Row struct {
+	Block  string `json:"block"`
+	Origin string `json:"origin"`
+	Day    string `json:"day"`
+	Counts
+}
+
+// Batch is every aggregate a node recorded between Since and Until.
+type Batch struct {
+	Node      ethgo.Address `json:"node"`
+	Since     string        `json:"since"`
+	Until     string        `json:"until"`
+	CreatedAt time.Time     `json:"createdAt"`
+	Rows      []Row         `json:"rows"`
+}
+
+// SignedBatch carries a batch exactly as it was signed, so the signature
+// can be checked with account.RecoverAddress against the batch's node.
+type SignedBatch struct {
+	Batch     json.RawMessage `json:"batch"`
+	Signature string          `json:"signature"`
+}
+
+func dayRange(since, until time.Time) (string, string) {
+	return since.UTC().Format(dayFormat), until.UTC().Format(dayFormat)
+}
+
+// Stats sums a block's serves per origin and per day.
+func Stats(block string, since, until time.Time) (*BlockStats, error) {
+	if events == nil {
+		return nil, fmt.Errorf("Analytics are not initialized")
+	}
+
+	from, to := dayRange(since, until)
+	stats := &BlockStats{
+		Block:   strings.ToLower(block),
+		Since:   from,
+		Until:   to,
+		Origins: []OriginStats{},
+		Days:    []DayStats{},
+	}
+
+	perDay := make(map[string]*Counts)
+
+	events.mu.RLock()
+	for origin, byDay := range events.aggregates[stats.Block] {
+		o := OriginStats{Origin: origin}
+		for day, counts := range byDay {
+			if day < from || day > to {
+				continue
+			}
+
+			o.add(*counts)
+			if o.FirstDay == "" || day < o.FirstDay {
+				o.FirstDay = day
+			}
+			if day > o.LastDay {
+				o.LastDay = day
+			}
+
+			if _, ok := perDay[day]; !ok {
+				perDay[day] = &Counts{}
+			}
+			perDay[day].add(*counts)
+		}
+
+		if o.Serves > 0 {
+			stats.Total.add(o.Counts)
+			stats.Origins = append(stats.Origins, o)
+		}
+	}
+	events.mu.RUnlock()
+
+	for day, counts := range perDay {
+		stats.Days = append(stats.Days, DayStats{day, *counts})
+	}
+
+	sort.Slice(stats.Origins, func(i, j int) bool {
+		if stats.Origins[i].Serves != stats.Origins[j].Serves {
+			return stats.Origins[i].Serves > stats.Origins[j].Serves
+		}
+		return stats.Origins[i].Origin < stats.Origins[j].Origin
+	})
+	sort.Slice(stats.Days, func(i, j int) bool { return stats.Days[i].Day < stats.Days[j].Day })
+
+	return stats, nil
+}
+
+// Export signs every aggregate between since and until with the node's
+// account, for reward accounting.
+func Export(a *account.Account, since, until time.Time) (*SignedBatch, error) {
+	if events == nil {
+		return nil, fmt.Errorf("Analytics are not initialized")
+	}
+
+	from, to := dayRange(since, until)
+	batch := Batch{
+		Node:      a.Address,
+		Since:     from,
+		Until:     to,
+		CreatedAt: time.Now().UTC(),
+		Rows:      []Row{},
+	}
+
+	events.mu.RLock()
+	for block, origins := range events.aggregates {
+		for origin, byDay := range origins {
+			for day, counts := range byDay {
+				if day < from || day > to {
+					continue
+				}
+				batch.Rows = append(batch.Rows, Row{block, origin, day, *counts})
+			}
+		}
+	}
+	events.mu.RUnlock()
+
+	sort.Slice(batch.Rows, func(i, j int) bool {
+		x, y := batch.Rows[i], batch.Rows[j]
+		if x.Day != y.Day {
+			return x.Day < y.Day
+		}
+		if x.Block != y.Block {
+			return x.Block < y.Block
+		}
+		return x.Origin < y.Origin
+	})
+
+	data, err := json.Marshal(batch)
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := a.Sign(string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	return &SignedBatch{data, sig}, nil
+}
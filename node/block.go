@@ -0,0 +1,293 @@
+package main
+
+import (
+	"blocksui-node/account"
+	"blocksui-node/blocks"
+	"blocksui-node/config"
+	"blocksui-node/contracts"
+	"blocksui-node/indexer"
+	"blocksui-node/ipfs"
+	"blocksui-node/server"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/umbracle/ethgo"
+)
+
+var (
+	// Block Flags
+	blockFlags = flag.NewFlagSet("block", flag.ExitOnError)
+	blockOut   = blockFlags.String("o", "", "-o block.car - Where to write the exported CAR")
+
+	// Rekey Flags
+	rekeyAll    = blockFlags.Bool("all", false, "--all - Rekey every indexed block this node's account owns")
+	rekeyFrom   = blockFlags.String("from-address", "", "--from-address 0x... - The BUIBlockNFT deployment the blocks are bound to now")
+	rekeyTo     = blockFlags.String("address", "", "--address 0x... - The BUIBlockNFT deployment to bind the blocks to")
+	rekeyChain  = blockFlags.String("chain", "", "--chain mumbai - The chain of the new access conditions, which must be the node's chain")
+	rekeyDryRun = blockFlags.Bool("dry-run", false, "--dry-run - Only check each block can be decrypted")
+	rekeyReport = blockFlags.String("report", "rekey-report.json", "--report rekey-report.json - Where to write the migration report")
+)
+
+func blockUsage() {
+	fmt.Println("")
+	fmt.Println("Usage: bui block [export <tokenId>|import <file.car>|rekey <tokenId>...|rekey --all] [OPTIONS]")
+	fmt.Println("")
+	blockFlags.PrintDefaults()
+	fmt.Println("")
+}
+
+func block(c *config.Config, args []string) {
+	if len(args) == 0 {
+		blockUsage()
+		os.Exit(1)
+	}
+
+	cmd := args[0]
+	parseFlags(blockFlags, args[1:])
+
+	if cmd == "rekey" {
+		rekey(c)
+		return
+	}
+
+	if blockFlags.NArg() != 1 {
+		blockUsage()
+		os.Exit(1)
+	}
+
+	store, err := ipfs.Open(c)
+	if err != nil {
+		fmt.Printf("[Store] %v\n", err)
+		os.Exit(1)
+	}
+
+	ctx := context.Background()
+
+	switch cmd {
+	case "export":
+		tokenId, err := strconv.ParseUint(blockFlags.Arg(0), 10, 64)
+		if err != nil {
+			fmt.Printf("Invalid token id %s\n", blockFlags.Arg(0))
+			os.Exit(1)
+		}
+
+		if err := contracts.LoadContracts(c); err != nil {
+			fmt.Printf("[Load Contracts] %v\n", err)
+			os.Exit(1)
+		}
+
+		roots, err := server.BundleRoots(ctx, store, tokenId)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		out := *blockOut
+		if out == "" {
+			out = fmt.Sprintf("block-%d.car", tokenId)
+		}
+
+		file, err := os.Create(out)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		defer file.Close()
+
+		if err := ipfs.WriteCar(ctx, store, roots, file); err != nil {
+			fmt.Println(err)
+			os.Remove(out)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Exported block %d to %s\n", tokenId, out)
+		for _, root := range roots {
+			fmt.Printf("  %s\n", root)
+		}
+	case "import":
+		file, err := os.Open(blockFlags.Arg(0))
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		defer file.Close()
+
+		roots, err := store.PutCar(ctx, file)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Imported %s\n", blockFlags.Arg(0))
+		for _, root := range roots {
+			fmt.Printf("  %s\n", root)
+		}
+	default:
+		blockUsage()
+		os.Exit(1)
+	}
+}
+
+func parseAddress(flagName, s string) ethgo.Address {
+	if s == "" {
+		return ethgo.ZeroAddress
+	}
+
+	if _, err := hex.DecodeString(strings.TrimPrefix(s, "0x")); err != nil || len(s) != 42 || !strings.HasPrefix(s, "0x") {
+		fmt.Printf("Invalid address for --%s: %s\n", flagName, s)
+		os.Exit(1)
+	}
+
+	return ethgo.HexToAddress(s)
+}
+
+// ownedBlocks lists the blocks the index says a is holding. The index is
+// only as fresh as the node last left it.
+func ownedBlocks(c *config.Config, a *account.Account) ([]uint64, error) {
+	store, err := indexer.LoadStore(filepath.Join(c.HomeDir, ".bui", "index.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []uint64{}
+	for id, t := range store.Snapshot("BUIBlockNFT") {
+		if t.Owner() != a.Address {
+			continue
+		}
+
+		tokenId, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, tokenId)
+	}
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	return ids, nil
+}
+
+// rekey re-encrypts blocks the node's account owns under new access
+// conditions and writes a migration report.
+func rekey(c *config.Config) {
+	if *rekeyAll == (blockFlags.NArg() > 0) {
+		blockUsage()
+		os.Exit(1)
+	}
+
+	opts := server.RekeyOptions{
+		FromAddress: parseAddress("from-address", *rekeyFrom),
+		ToAddress:   parseAddress("address", *rekeyTo),
+		Chain:       *rekeyChain,
+		DryRun:      *rekeyDryRun,
+	}
+
+	if opts.Chain != "" {
+		if _, ok := contracts.ChainForName(opts.Chain); !ok {
+			fmt.Printf("Unknown chain %s\n", opts.Chain)
+			os.Exit(1)
+		}
+	}
+
+	if err := contracts.LoadContracts(c); err != nil {
+		fmt.Printf("[Load Contracts] %v\n", err)
+		os.Exit(1)
+	}
+
+	a, err := account.LoadAccount(c)
+	if err != nil {
+		fmt.Printf("[Load Accounts] %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := blocks.StartLineage(c); err != nil {
+		fmt.Printf("[Lineage] %v\n", err)
+		os.Exit(1)
+	}
+
+	var tokenIds []uint64
+	if *rekeyAll {
+		if tokenIds, err = ownedBlocks(c, a); err != nil {
+			fmt.Printf("[Index] %v\n", err)
+			os.Exit(1)
+		}
+	} else {
+		for _, arg := range blockFlags.Args() {
+			tokenId, err := strconv.ParseUint(arg, 10, 64)
+			if err != nil {
+				fmt.Printf("Invalid token id %s\n", arg)
+				os.Exit(1)
+			}
+			tokenIds = append(tokenIds, tokenId)
+		}
+	}
+
+	if len(tokenIds) == 0 {
+		fmt.Printf("No blocks owned by %s\n", a.Address)
+		return
+	}
+
+	store, err := ipfs.Open(c)
+	if err != nil {
+		fmt.Printf("[Store] %v\n", err)
+		os.Exit(1)
+	}
+
+	report, err := server.RekeyAll(context.Background(), c, a, store, tokenIds, opts)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	failed, skipped := 0, 0
+	for _, res := range report.Results {
+		switch {
+		case res.Error != "":
+			failed++
+			fmt.Printf("  %d\tfailed\t%s\n", res.TokenId, res.Error)
+		case res.Skipped:
+			skipped++
+			fmt.Printf("  %d\tskipped\talready bound to %s\n", res.TokenId, report.To)
+		case report.DryRun:
+			fmt.Printf("  %d\tok\t%s\n", res.TokenId, res.FromPayload)
+		default:
+			fmt.Printf("  %d\tversion %d\t%s\n", res.TokenId, res.Version, res.MetadataURI)
+		}
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if err := os.WriteFile(*rekeyReport, data, 0644); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	verb := "Rekeyed"
+	if report.DryRun {
+		verb = "Checked"
+	}
+
+	fmt.Printf("%s %d of %d blocks from %s to %s, report in %s\n", verb, len(tokenIds)-failed-skipped, len(tokenIds), report.From, report.To, *rekeyReport)
+	if skipped > 0 {
+		fmt.Printf("%d were already bound to %s and left alone.\n", skipped, report.To)
+	}
+	if !report.DryRun && failed+skipped < len(tokenIds) {
+		fmt.Println("Point each token at its new metadataURI to make the new version the default.")
+	}
+
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
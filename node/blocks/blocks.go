@@ -0,0 +1,272 @@
+// Package blocks defines the block document a creator compiles: a tree of
+// primitive components, their props and references to other blocks.
+package blocks
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	SchemaVersion = 1
+	MaxDepth      = 32
+	MaxComponents = 2000
+)
+
+var (
+	namePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+	refPattern  = regexp.MustCompile(`^0x[0-9A-Fa-f]{64}$`)
+)
+
+// Document is a block. Preview is only set on the unencrypted previews
+// published alongside a block. Primitives is never stored: the node sets
+// it on the blocks it serves to the CID of the primitives bundle each one
+// was compiled against.
+type Document struct {
+	Version    int          `json:"version"`
+	Preview    string       `json:"preview,omitempty"`
+	Primitives string       `json:"primitives,omitempty"`
+	Components []*Component `json:"components"`
+}
+
+// Component renders the named primitive, such as Button, from the
+// primitives bundle the block was compiled against, or embeds another
+// block by its bytes32 CID. Block is only set once a reference has been
+// resolved for a reader.
+type Component struct {
+	Id        string                 `json:"id,omitempty"`
+	Primitive string                 `json:"primitive,omitempty"`
+	Ref       string                 `json:"ref,omitempty"`
+	Props     map[string]interface{} `json:"props,omitempty"`
+	Children  []*Component           `json:"children,omitempty"`
+	Block     *Document              `json:"block,omitempty"`
+}
+
+type FieldError struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Path + ": " + fe.Error
+	}
+
+	return strings.Join(msgs, "; ")
+}
+
+type parser struct {
+	known func(primitive string) bool
+	errs  Errors
+	ids   map[string]string
+	count int
+}
+
+func (p *parser) fail(path, format string, args ...interface{}) {
+	p.errs = append(p.errs, FieldError{path, fmt.Sprintf(format, args...)})
+}
+
+// Parse checks data against the block schema and returns the document.
+// known reports whether a primitive exists in the primitives bundle; nil
+// skips that check. Every problem is reported with its path, such as
+// components[0].children[2].primitive.
+func Parse(data []byte, known func(primitive string) bool) (*Document, error) {
+	return parse(data, known, false)
+}
+
+// ParsePreview parses a published preview, which must name the preview
+// mode it was made with. Only previews may carry a mode.
+func ParsePreview(data []byte) (*Document, error) {
+	return parse(data, nil, true)
+}
+
+func parse(data []byte, known func(primitive string) bool, preview bool) (*Document, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var raw interface{}
+	if err := dec.Decode(&raw); err != nil {
+		return nil, Errors{{"", fmt.Sprintf("invalid JSON: %v", err)}}
+	}
+
+	if dec.More() {
+		return nil, Errors{{"", "unexpected data after the document"}}
+	}
+
+	p := &parser{known: known, ids: make(map[string]string)}
+
+	obj, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, Errors{{"", "must be an object"}}
+	}
+
+	doc := &Document{}
+
+	for key := range obj {
+		if key != "version" && key != "components" && (key != "preview" || !preview) {
+			p.fail(key, "unknown field")
+		}
+	}
+
+	if preview {
+		mode, _ := obj["preview"].(string)
+		if mode != PreviewStrip && mode != PreviewWatermark {
+			p.fail("preview", "must be %q or %q", PreviewStrip, PreviewWatermark)
+		}
+		doc.Preview = mode
+	}
+
+	switch v := obj["version"].(type) {
+	case nil:
+		p.fail("version", "is required")
+	case json.Number:
+		n, err := v.Int64()
+		if err != nil || n != SchemaVersion {
+			p.fail("version", "unsupported version %s, expected %d", v, SchemaVersion)
+		}
+		doc.Version = int(n)
+	default:
+		p.fail("version", "must be a number")
+	}
+
+	doc.Components = p.components(obj["components"], "components", 1)
+	if len(doc.Components) == 0 && len(p.errs) == 0 {
+		p.fail("components", "must not be empty")
+	}
+
+	if len(p.errs) > 0 {
+		sort.SliceStable(p.errs, func(i, j int) bool { return p.errs[i].Path < p.errs[j].Path })
+		return nil, p.errs
+	}
+
+	return doc, nil
+}
+
+func (p *parser) components(v interface{}, path string, depth int) []*Component {
+	if v == nil {
+		if depth == 1 {
+			p.fail(path, "is required")
+		}
+		return nil
+	}
+
+	list, ok := v.([]interface{})
+	if !ok {
+		p.fail(path, "must be an array")
+		return nil
+	}
+
+	if depth > MaxDepth {
+		p.fail(path, "nested deeper than %d", MaxDepth)
+		return nil
+	}
+
+	out := make([]*Component, 0, len(list))
+	for i, item := range list {
+		if c := p.component(item, fmt.Sprintf("%s[%d]", path, i), depth); c != nil {
+			out = append(out, c)
+		}
+	}
+
+	return out
+}
+
+func (p *parser) component(v interface{}, path string, depth int) *Component {
+	if p.count++; p.count > MaxComponents {
+		if p.count == MaxComponents+1 {
+			p.fail(path, "more than %d components", MaxComponents)
+		}
+		return nil
+	}
+
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		p.fail(path, "must be an object")
+		return nil
+	}
+
+	c := &Component{}
+
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	// Children last so ids are claimed in document order
+	sort.Slice(keys, func(i, j int) bool {
+		if (keys[i] == "children") != (keys[j] == "children") {
+			return keys[j] == "children"
+		}
+		return keys[i] < keys[j]
+	})
+
+	for _, key := range keys {
+		value := obj[key]
+		switch key {
+		case "id":
+			id, ok := value.(string)
+			if !ok || id == "" {
+				p.fail(path+".id", "must be a non-empty string")
+				continue
+			}
+			if first, dup := p.ids[id]; dup {
+				p.fail(path+".id", "duplicate id %q, first used at %s", id, first)
+				continue
+			}
+			p.ids[id] = path + ".id"
+			c.Id = id
+		case "primitive":
+			name, ok := value.(string)
+			if !ok || !namePattern.MatchString(name) {
+				p.fail(path+".primitive", "must be a primitive name")
+				continue
+			}
+			if p.known != nil && !p.known(name) {
+				p.fail(path+".primitive", "unknown primitive %q", name)
+			}
+			c.Primitive = name
+		case "ref":
+			ref, ok := value.(string)
+			if !ok || !refPattern.MatchString(ref) {
+				p.fail(path+".ref", "must be a bytes32 block CID")
+				continue
+			}
+			c.Ref = strings.ToLower(ref)
+		case "props":
+			props, ok := value.(map[string]interface{})
+			if !ok {
+				p.fail(path+".props", "must be an object")
+				continue
+			}
+			for name := range props {
+				if name == "" {
+					p.fail(path+".props", "prop names must not be empty")
+				}
+			}
+			c.Props = props
+		case "children":
+			c.Children = p.components(value, path+".children", depth+1)
+		default:
+			p.fail(path+"."+key, "unknown field")
+		}
+	}
+
+	_, hasPrimitive := obj["primitive"]
+	_, hasRef := obj["ref"]
+	switch {
+	case hasPrimitive && hasRef:
+		p.fail(path+".ref", "can't be combined with primitive")
+	case hasRef && obj["children"] != nil:
+		p.fail(path+".children", "aren't allowed on a block reference")
+	case !hasPrimitive && !hasRef:
+		p.fail(path+".primitive", "is required")
+	}
+
+	return c
+}
@@ -0,0 +1,122 @@
+package blocks
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func nested(depth int) string {
+	doc := `{"primitive":"Box"}`
+	for i := 1; i < depth; i++ {
+		doc = fmt.Sprintf(`{"primitive":"Box","children":[%s]}`, doc)
+	}
+
+	return fmt.Sprintf(`{"version":1,"components":[%s]}`, doc)
+}
+
+func TestParse(t *testing.T) {
+	ref := "0x" + strings.Repeat("Ab", 32)
+	known := func(name string) bool { return name == "Box" || name == "Button" }
+
+	tests := []struct {
+		name  string
+		doc   string
+		paths []string
+	}{
+		{"valid", `{"version":1,"components":[{"id":"a","primitive":"Box","props":{"gap":2},"children":[{"primitive":"Button"}]}]}`, nil},
+		{"reference", `{"version":1,"components":[{"ref":"` + ref + `"}]}`, nil},
+		{"preview mode", `{"version":1,"preview":"strip","components":[{"primitive":"Box"}]}`, []string{"preview"}},
+		{"invalid JSON", `{"version":1,`, []string{""}},
+		{"trailing data", `{"version":1,"components":[{"primitive":"Box"}]} {}`, []string{""}},
+		{"not an object", `[]`, []string{""}},
+		{"missing version", `{"components":[{"primitive":"Box"}]}`, []string{"version"}},
+		{"wrong version", `{"version":2,"components":[{"primitive":"Box"}]}`, []string{"version"}},
+		{"unknown field", `{"version":1,"theme":"dark","components":[{"primitive":"Box"}]}`, []string{"theme"}},
+		{"no components", `{"version":1,"components":[]}`, []string{"components"}},
+		{"unknown primitive", `{"version":1,"components":[{"primitive":"Video"}]}`, []string{"components[0].primitive"}},
+		{"bad primitive name", `{"version":1,"components":[{"primitive":"1Box"}]}`, []string{"components[0].primitive"}},
+		{"missing primitive", `{"version":1,"components":[{"props":{}}]}`, []string{"components[0].primitive"}},
+		{"bad reference", `{"version":1,"components":[{"ref":"0x1234"}]}`, []string{"components[0].ref"}},
+		{"primitive and reference", `{"version":1,"components":[{"primitive":"Box","ref":"` + ref + `"}]}`, []string{"components[0].ref"}},
+		{"reference with children", `{"version":1,"components":[{"ref":"` + ref + `","children":[{"primitive":"Box"}]}]}`, []string{"components[0].children"}},
+		{"duplicate id", `{"version":1,"components":[{"id":"a","primitive":"Box","children":[{"id":"a","primitive":"Button"}]}]}`, []string{"components[0].children[0].id"}},
+		{"empty prop name", `{"version":1,"components":[{"primitive":"Box","props":{"":1}}]}`, []string{"components[0].props"}},
+		{"every error", `{"version":"1","components":[{"primitive":"Video"},{"colour":"red","primitive":"Box"}]}`, []string{"components[0].primitive", "components[1].colour", "version"}},
+		{"at max depth", nested(MaxDepth), nil},
+		{"too deep", nested(MaxDepth + 1), []string{"components" + strings.Repeat("[0].children", MaxDepth)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Parse([]byte(tt.doc), known)
+
+			if tt.paths == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if len(doc.Components) == 0 {
+					t.Fatal("no components")
+				}
+				return
+			}
+
+			errs, ok := err.(Errors)
+			if !ok {
+				t.Fatalf("got %v, want Errors", err)
+			}
+
+			paths := make([]string, len(errs))
+			for i, fe := range errs {
+				paths[i] = fe.Path
+			}
+			if strings.Join(paths, " ") != strings.Join(tt.paths, " ") {
+				t.Errorf("got errors at %q, want %q (%v)", paths, tt.paths, errs)
+			}
+		})
+	}
+}
+
+func TestParseMaxComponents(t *testing.T) {
+	items := make([]string, MaxComponents+1)
+	for i := range items {
+		items[i] = `{"primitive":"Box"}`
+	}
+
+	_, err := Parse([]byte(`{"version":1,"components":[`+strings.Join(items, ",")+`]}`), nil)
+
+	errs, ok := err.(Errors)
+	if !ok || len(errs) != 1 {
+		t.Fatalf("got %v, want one error", err)
+	}
+	if want := fmt.Sprintf("components[%d]", MaxComponents); errs[0].Path != want {
+		t.Errorf("got error at %s, want %s", errs[0].Path, want)
+	}
+}
+
+func TestParsePreview(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		mode string
+		ok   bool
+	}{
+		{"strip", `{"version":1,"preview":"strip","components":[{"primitive":"Box"}]}`, PreviewStrip, true},
+		{"watermark", `{"version":1,"preview":"watermark","components":[{"primitive":"Box"}]}`, PreviewWatermark, true},
+		{"bad mode", `{"version":1,"preview":"blur","components":[{"primitive":"Box"}]}`, "", false},
+		// A block is not a preview of itself
+		{"no mode", `{"version":1,"components":[{"primitive":"Box"}]}`, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := ParsePreview([]byte(tt.doc))
+			if ok := err == nil; ok != tt.ok {
+				t.Fatalf("got %v, want ok %v", err, tt.ok)
+			}
+			if tt.ok && doc.Preview != tt.mode {
+				t.Errorf("got mode %q, want %q", doc.Preview, tt.mode)
+			}
+		})
+	}
+}
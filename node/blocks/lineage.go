@@ -0,0 +1,171 @@
+package blocks
+
+import (
+	"blocksui-node/config"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Version is one published upgrade of a minted block. The minted block
+// itself is the first version and is only known through its tokenURI.
+type Version struct {
+	Number      int       `json:"number"`
+	Cid         string    `json:"cid"`
+	MetadataURI string    `json:"metadataURI"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// Lineage maps the bytes32 CID of a minted block to its later versions,
+// oldest first. Licences are checked against the minted CID, so every
+// version is covered by them.
+type Lineage struct {
+	Roots map[string][]Version `json:"roots"`
+
+	path string
+	mu   sync.RWMutex
+	// Numbers handed out to versions still being published
+	reserved map[string]int
+}
+
+var lineage *Lineage
+
+func StartLineage(c *config.Config) error {
+	if lineage != nil {
+		return fmt.Errorf("Already initialized")
+	}
+
+	l := &Lineage{
+		Roots:    make(map[string][]Version),
+		path:     filepath.Join(c.HomeDir, ".bui", "lineage.json"),
+		reserved: make(map[string]int),
+	}
+
+	data, err := os.ReadFile(l.path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	} else if err == nil {
+		if err := json.Unmarshal(data, l); err != nil {
+			return err
+		}
+	}
+
+	lineage = l
+
+	return nil
+}
+
+func (l *Lineage) save() error {
+	l.mu.RLock()
+	data, err := json.Marshal(l)
+	l.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return err
+	}
+
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, l.path)
+}
+
+func AddVersion(root string, v Version) error {
+	if lineage == nil {
+		return fmt.Errorf("Lineage is not loaded")
+	}
+
+	root = strings.ToLower(root)
+
+	lineage.mu.Lock()
+	lineage.Roots[root] = append(lineage.Roots[root], v)
+	lineage.mu.Unlock()
+
+	return lineage.save()
+}
+
+// NextNumber hands out the number for a new version of root built on a
+// parent numbered parent. It is taken under the lineage lock, so versions
+// published at the same time never share a number.
+func NextNumber(root string, parent int) int {
+	if lineage == nil {
+		return parent + 1
+	}
+
+	root = strings.ToLower(root)
+
+	lineage.mu.Lock()
+	defer lineage.mu.Unlock()
+
+	n := parent
+	if r := lineage.reserved[root]; r > n {
+		n = r
+	}
+	for _, v := range lineage.Roots[root] {
+		if v.Number > n {
+			n = v.Number
+		}
+	}
+
+	lineage.reserved[root] = n + 1
+
+	return n + 1
+}
+
+// Latest returns the highest numbered version published through this
+// node, or false when it has published none.
+func Latest(root string) (Version, bool) {
+	if lineage == nil {
+		return Version{}, false
+	}
+
+	lineage.mu.RLock()
+	defer lineage.mu.RUnlock()
+
+	var latest Version
+	for _, v := range lineage.Roots[strings.ToLower(root)] {
+		if v.Number > latest.Number {
+			latest = v
+		}
+	}
+
+	return latest, latest.Number > 0
+}
+
+// FindVersion matches cid against each version's payload and metadata CID.
+func FindVersion(root, cid string) (Version, bool) {
+	if lineage == nil {
+		return Version{}, false
+	}
+
+	lineage.mu.RLock()
+	defer lineage.mu.RUnlock()
+
+	for _, v := range lineage.Roots[strings.ToLower(root)] {
+		if v.Cid == cid || strings.TrimPrefix(v.MetadataURI, "ipfs://") == cid {
+			return v, true
+		}
+	}
+
+	return Version{}, false
+}
+
+func Versions(root string) []Version {
+	if lineage == nil {
+		return nil
+	}
+
+	lineage.mu.RLock()
+	defer lineage.mu.RUnlock()
+
+	return append([]Version(nil), lineage.Roots[strings.ToLower(root)]...)
+}
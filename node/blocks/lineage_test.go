@@ -0,0 +1,42 @@
+package blocks
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestNextNumber(t *testing.T) {
+	lineage = &Lineage{
+		Roots:    map[string][]Version{"0xroot": {{Number: 2}, {Number: 3}}},
+		reserved: make(map[string]int),
+	}
+	defer func() { lineage = nil }()
+
+	// Publishing on an old parent still moves past every known version
+	if n := NextNumber("0xROOT", 1); n != 4 {
+		t.Fatalf("got %d, want 4", n)
+	}
+
+	seen := make(map[int]bool)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n := NextNumber("0xroot", 3)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if seen[n] {
+				t.Errorf("number %d handed out twice", n)
+			}
+			seen[n] = true
+		}()
+	}
+	wg.Wait()
+
+	if n := NextNumber("0xother", 1); n != 2 {
+		t.Errorf("got %d for a new root, want 2", n)
+	}
+}
@@ -0,0 +1,74 @@
+package blocks
+
+import "encoding/json"
+
+const (
+	PreviewStrip     = "strip"
+	PreviewWatermark = "watermark"
+)
+
+// Preview derives the public preview of a block. Both modes keep the
+// layout and component ids but none of the content: stripping drops every
+// prop, watermarking keeps number and boolean props, replaces text with a
+// placeholder and adds a visible notice. Embedded blocks are licensed
+// separately and are left out of both.
+func Preview(doc *Document, mode string) *Document {
+	preview := &Document{
+		Version:    doc.Version,
+		Preview:    mode,
+		Components: previewComponents(doc.Components, mode),
+	}
+
+	if mode == PreviewWatermark {
+		preview.Components = append(preview.Components, &Component{
+			Primitive: "Text",
+			Props:     map[string]interface{}{"text": "Preview"},
+		})
+	}
+
+	return preview
+}
+
+func previewComponents(list []*Component, mode string) []*Component {
+	out := make([]*Component, 0, len(list))
+	for _, c := range list {
+		if c.Ref != "" {
+			continue
+		}
+
+		pc := &Component{
+			Id:        c.Id,
+			Primitive: c.Primitive,
+			Children:  previewComponents(c.Children, mode),
+		}
+
+		if mode == PreviewWatermark {
+			pc.Props = placeholderProps(c.Props)
+		}
+
+		out = append(out, pc)
+	}
+
+	return out
+}
+
+// placeholderProps keeps props that size or toggle a component and
+// replaces text, which may be content, with a placeholder. Lists and
+// objects are dropped.
+func placeholderProps(props map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{})
+	for name, v := range props {
+		switch v.(type) {
+		case bool, float64, json.Number:
+			out[name] = v
+		case string:
+			out[name] = "Preview"
+		}
+	}
+
+	if len(out) == 0 {
+		return nil
+	}
+
+	return out
+}
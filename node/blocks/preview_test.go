@@ -0,0 +1,61 @@
+package blocks
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestPreview(t *testing.T) {
+	doc, err := Parse([]byte(`{"version":1,"components":[
+		{"id":"hero","primitive":"Box","props":{"gap":4,"wrap":true,"items":["a"]},"children":[
+			{"primitive":"Text","props":{"text":"Secret launch copy"}},
+			{"ref":"0x`+strings.Repeat("ab", 32)+`"}
+		]}
+	]}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		mode  string
+		props string
+		last  string
+	}{
+		{PreviewStrip, `null`, "Box"},
+		{PreviewWatermark, `{"gap":4,"wrap":true}`, "Text"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			preview := Preview(doc, tt.mode)
+
+			data, err := json.Marshal(preview)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(string(data), "Secret") || strings.Contains(string(data), "0xab") {
+				t.Errorf("preview leaks content: %s", data)
+			}
+
+			hero := preview.Components[0]
+			if hero.Id != "hero" || len(hero.Children) != 1 {
+				t.Fatalf("layout not kept: %s", data)
+			}
+
+			props, _ := json.Marshal(hero.Props)
+			if string(props) != tt.props {
+				t.Errorf("got props %s, want %s", props, tt.props)
+			}
+
+			if last := preview.Components[len(preview.Components)-1]; last.Primitive != tt.last {
+				t.Errorf("last component is %s, want %s", last.Primitive, tt.last)
+			}
+
+			// Previews must be valid documents themselves
+			if _, err := ParsePreview(data); err != nil {
+				t.Errorf("preview does not parse: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package blocks
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+const (
+	MaxRefDepth = 8
+	MaxRefs     = 256
+)
+
+// ErrNotLicensed is returned by a Fetcher when the reader holds no licence
+// for a referenced block. Resolve lists those blocks instead of failing.
+var ErrNotLicensed = errors.New("Not licensed")
+
+type notLicensed struct {
+	reason string
+}
+
+func (e *notLicensed) Error() string {
+	return ErrNotLicensed.Error() + ": " + e.reason
+}
+
+func (e *notLicensed) Is(target error) bool {
+	return target == ErrNotLicensed
+}
+
+// NotLicensed is ErrNotLicensed with the reason the reader's licence
+// doesn't cover the block, such as it having expired.
+func NotLicensed(reason string) error {
+	return &notLicensed{reason}
+}
+
+// Fetcher decrypts and parses a referenced block for the reader.
+type Fetcher func(ref string) (*Document, error)
+
+// Missing is a referenced block the reader has no rights to.
+type Missing struct {
+	Ref    string   `json:"ref"`
+	Paths  []string `json:"paths"`
+	Reason string   `json:"reason,omitempty"`
+}
+
+type resolver struct {
+	fetch   Fetcher
+	docs    map[string]*Document
+	missing map[string]*Missing
+	errs    Errors
+	count   int
+}
+
+// HasRefs reports whether any component embeds another block.
+func (d *Document) HasRefs() bool {
+	var walk func([]*Component) bool
+	walk = func(list []*Component) bool {
+		for _, c := range list {
+			if c.Ref != "" || walk(c.Children) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return walk(d.Components)
+}
+
+// Resolve fills in Block for every reference in doc, recursively. root is
+// the CID of doc itself, so a block can't embed itself. Blocks the reader
+// isn't licensed for are returned rather than failing the whole tree;
+// cycles, references nested too deep and fetch failures are errors.
+func Resolve(doc *Document, root string, fetch Fetcher) ([]Missing, error) {
+	rv := &resolver{
+		fetch:   fetch,
+		docs:    make(map[string]*Document),
+		missing: make(map[string]*Missing),
+	}
+
+	rv.resolve(doc.Components, "components", []string{root})
+
+	if len(rv.errs) > 0 {
+		sort.SliceStable(rv.errs, func(i, j int) bool { return rv.errs[i].Path < rv.errs[j].Path })
+		return nil, rv.errs
+	}
+
+	missing := make([]Missing, 0, len(rv.missing))
+	for _, m := range rv.missing {
+		missing = append(missing, *m)
+	}
+	sort.Slice(missing, func(i, j int) bool { return missing[i].Ref < missing[j].Ref })
+
+	return missing, nil
+}
+
+func (rv *resolver) resolve(list []*Component, path string, stack []string) {
+	for i, c := range list {
+		cpath := fmt.Sprintf("%s[%d]", path, i)
+
+		if c.Ref == "" {
+			rv.resolve(c.Children, cpath+".children", stack)
+			continue
+		}
+
+		if rv.visit(c, cpath+".ref", stack) {
+			rv.resolve(c.Block.Components, cpath+".block.components", append(stack, c.Ref))
+		}
+	}
+}
+
+// visit fetches one reference, at most once per tree, and reports whether
+// its own references should be followed.
+func (rv *resolver) visit(c *Component, path string, stack []string) bool {
+	for _, ref := range stack {
+		if ref == c.Ref {
+			rv.errs = append(rv.errs, FieldError{path, fmt.Sprintf("block %s embeds itself", c.Ref)})
+			return false
+		}
+	}
+
+	if len(stack) > MaxRefDepth {
+		rv.errs = append(rv.errs, FieldError{path, fmt.Sprintf("blocks nested deeper than %d", MaxRefDepth)})
+		return false
+	}
+
+	// Counts every reference, not just distinct blocks, since a block
+	// embedded many times is walked each time
+	if rv.count++; rv.count > MaxRefs {
+		if rv.count == MaxRefs+1 {
+			rv.errs = append(rv.errs, FieldError{path, fmt.Sprintf("more than %d block references", MaxRefs)})
+		}
+		return false
+	}
+
+	if m, ok := rv.missing[c.Ref]; ok {
+		m.Paths = append(m.Paths, path)
+		return false
+	}
+
+	doc, ok := rv.docs[c.Ref]
+	if !ok {
+		var err error
+		doc, err = rv.fetch(c.Ref)
+		if errors.Is(err, ErrNotLicensed) {
+			m := &Missing{Ref: c.Ref, Paths: []string{path}}
+			var nl *notLicensed
+			if errors.As(err, &nl) {
+				m.Reason = nl.reason
+			}
+			rv.missing[c.Ref] = m
+			return false
+		} else if err != nil {
+			rv.errs = append(rv.errs, FieldError{path, err.Error()})
+			return false
+		}
+
+		rv.docs[c.Ref] = doc
+	}
+
+	c.Block = doc
+
+	return true
+}
@@ -0,0 +1,201 @@
+package blocks
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func refCid(n int) string {
+	return fmt.Sprintf("0x%064x", n)
+}
+
+func refs(cids ...string) *Document {
+	doc := &Document{Version: SchemaVersion}
+	for _, cid := range cids {
+		doc.Components = append(doc.Components, &Component{Ref: cid})
+	}
+	if len(cids) == 0 {
+		doc.Components = []*Component{{Primitive: "Box"}}
+	}
+
+	return doc
+}
+
+// chain embeds block i+1 in block i, n blocks deep.
+func chain(n int) map[string]*Document {
+	docs := make(map[string]*Document)
+	for i := 1; i < n; i++ {
+		docs[refCid(i)] = refs(refCid(i + 1))
+	}
+	docs[refCid(n)] = refs()
+
+	return docs
+}
+
+func TestResolve(t *testing.T) {
+	root := refCid(0)
+
+	many := make([]string, MaxRefs+1)
+	for i := range many {
+		many[i] = refCid(1)
+	}
+
+	tests := []struct {
+		name     string
+		doc      *Document
+		docs     map[string]*Document
+		licensed func(ref string) bool
+		reason   string
+		paths    []string
+		missing  []string
+		fetches  int
+	}{
+		{
+			name:    "nested",
+			doc:     refs(refCid(1)),
+			docs:    chain(3),
+			fetches: 3,
+		},
+		{
+			name:    "fetched once",
+			doc:     refs(refCid(1), refCid(1)),
+			docs:    chain(1),
+			fetches: 1,
+		},
+		{
+			name:  "embeds itself",
+			doc:   refs(root),
+			paths: []string{"components[0].ref"},
+		},
+		{
+			name: "cycle",
+			doc:  refs(refCid(1)),
+			docs: map[string]*Document{
+				refCid(1): refs(refCid(2)),
+				refCid(2): refs(refCid(1)),
+			},
+			paths:   []string{"components[0].block.components[0].block.components[0].ref"},
+			fetches: 2,
+		},
+		{
+			name:    "at max depth",
+			doc:     refs(refCid(1)),
+			docs:    chain(MaxRefDepth),
+			fetches: MaxRefDepth,
+		},
+		{
+			name:    "too deep",
+			doc:     refs(refCid(1)),
+			docs:    chain(MaxRefDepth + 1),
+			paths:   []string{"components[0]" + strings.Repeat(".block.components[0]", MaxRefDepth) + ".ref"},
+			fetches: MaxRefDepth,
+		},
+		{
+			name:    "too many references",
+			doc:     refs(many...),
+			docs:    chain(1),
+			paths:   []string{fmt.Sprintf("components[%d].ref", MaxRefs)},
+			fetches: 1,
+		},
+		{
+			name:     "not licensed",
+			doc:      refs(refCid(1), refCid(2), refCid(2)),
+			docs:     map[string]*Document{refCid(1): refs(), refCid(2): refs()},
+			licensed: func(ref string) bool { return ref != refCid(2) },
+			missing:  []string{refCid(2)},
+			fetches:  2,
+		},
+		{
+			name:     "licence expired",
+			doc:      refs(refCid(1)),
+			docs:     map[string]*Document{refCid(1): refs()},
+			licensed: func(ref string) bool { return false },
+			reason:   "Licence expired",
+			missing:  []string{refCid(1)},
+			fetches:  1,
+		},
+		{
+			name:    "fetch failure",
+			doc:     refs(refCid(1)),
+			docs:    map[string]*Document{},
+			paths:   []string{"components[0].ref"},
+			fetches: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fetches := 0
+			fetch := func(ref string) (*Document, error) {
+				fetches++
+				if tt.licensed != nil && !tt.licensed(ref) {
+					if tt.reason != "" {
+						return nil, NotLicensed(tt.reason)
+					}
+					return nil, ErrNotLicensed
+				}
+
+				doc, ok := tt.docs[ref]
+				if !ok {
+					return nil, fmt.Errorf("No block %s", ref)
+				}
+
+				return doc, nil
+			}
+
+			missing, err := Resolve(tt.doc, root, fetch)
+
+			if fetches != tt.fetches {
+				t.Errorf("fetched %d times, want %d", fetches, tt.fetches)
+			}
+
+			if tt.paths != nil {
+				errs, ok := err.(Errors)
+				if !ok {
+					t.Fatalf("got %v, want Errors", err)
+				}
+
+				paths := make([]string, len(errs))
+				for i, fe := range errs {
+					paths[i] = fe.Path
+				}
+				if strings.Join(paths, " ") != strings.Join(tt.paths, " ") {
+					t.Errorf("got errors at %q, want %q", paths, tt.paths)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			refs := make([]string, len(missing))
+			for i, m := range missing {
+				refs[i] = m.Ref
+				if m.Reason != tt.reason {
+					t.Errorf("got reason %q for %s, want %q", m.Reason, m.Ref, tt.reason)
+				}
+			}
+			if strings.Join(refs, " ") != strings.Join(tt.missing, " ") {
+				t.Errorf("got missing %q, want %q", refs, tt.missing)
+			}
+
+			for _, c := range tt.doc.Components {
+				if c.Block == nil && !contains(tt.missing, c.Ref) {
+					t.Errorf("%s was not resolved", c.Ref)
+				}
+			}
+		})
+	}
+}
+
+func contains(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,354 @@
+// Package catalog indexes the metadata of every minted block so blocks can
+// be listed and searched. It follows the chain through the indexer, which
+// indexes from the contracts' deployment, so blocks minted before the node
+// first started are backfilled too.
+package catalog
+
+import (
+	"blocksui-node/config"
+	"blocksui-node/indexer"
+	"blocksui-node/ipfs"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/umbracle/ethgo"
+)
+
+const (
+	refreshInterval = 15 * time.Second
+	fetchTimeout    = 30 * time.Second
+	maxMetadataSize = 64 << 10
+	// Metadata fetches per refresh, so a backlog doesn't stall updates
+	fetchBatch = 50
+	// Concurrent fetches, and how long a refresh waits for all of them
+	fetchWorkers    = 8
+	refreshDeadline = time.Minute
+)
+
+type Entry struct {
+	TokenId     uint64    `json:"tokenId"`
+	Cid         string    `json:"cid"`
+	MetadataURI string    `json:"metadataURI"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Tags        []string  `json:"tags"`
+	Image       string    `json:"image,omitempty"`
+	Preview     string    `json:"preview,omitempty"`
+	Creator     string    `json:"creator"`
+	Licenses    int       `json:"licenses"`
+	IndexedAt   time.Time `json:"indexedAt"`
+}
+
+func (e *Entry) key() string {
+	return strconv.FormatUint(e.TokenId, 10)
+}
+
+// metadata is the part of a block's metadata the catalog reads.
+type metadata struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Image       string `json:"image"`
+	Preview     string `json:"preview"`
+	Tags        string `json:"tags"`
+}
+
+type Catalog struct {
+	path  string
+	store ipfs.BlockStore
+
+	mu      sync.RWMutex
+	entries map[string]*Entry
+	index   index
+}
+
+var catalog *Catalog
+
+// Start loads the saved catalog and keeps it in step with the indexer in
+// the background.
+func Start(c *config.Config, store ipfs.BlockStore) error {
+	if catalog != nil {
+		return fmt.Errorf("Already initialized")
+	}
+
+	cat := &Catalog{
+		path:    filepath.Join(c.HomeDir, ".bui", "catalog.json"),
+		store:   store,
+		entries: make(map[string]*Entry),
+	}
+
+	data, err := os.ReadFile(cat.path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	} else if err == nil {
+		if err := json.Unmarshal(data, &cat.entries); err != nil {
+			return err
+		}
+	}
+
+	cat.index = buildIndex(cat.entries)
+	catalog = cat
+	go cat.run()
+
+	return nil
+}
+
+// Search returns one page of matching blocks.
+func Search(q Query) Results {
+	if catalog == nil {
+		return Results{Page: q.Page, Limit: q.Limit, Results: []*Entry{}}
+	}
+
+	catalog.mu.RLock()
+	defer catalog.mu.RUnlock()
+
+	return search(catalog.entries, catalog.index, q)
+}
+
+func Get(tokenId uint64) (*Entry, bool) {
+	if catalog == nil {
+		return nil, false
+	}
+
+	catalog.mu.RLock()
+	defer catalog.mu.RUnlock()
+
+	e, ok := catalog.entries[strconv.FormatUint(tokenId, 10)]
+	return e, ok
+}
+
+// HasPreview reports whether cid is the preview of a catalogued block.
+func HasPreview(cid string) bool {
+	if catalog == nil {
+		return false
+	}
+
+	catalog.mu.RLock()
+	defer catalog.mu.RUnlock()
+
+	for _, e := range catalog.entries {
+		if e.Preview == "ipfs://"+cid {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (cat *Catalog) run() {
+	for {
+		if cat.refresh() {
+			if err := cat.save(); err != nil {
+				fmt.Printf("[catalog]\t%v\n", err)
+			}
+		}
+
+		time.Sleep(refreshInterval)
+	}
+}
+
+// refresh reads metadata for new tokens and tokens whose metadata changed
+// on chain, drops tokens a reorg removed and updates licence counts. It
+// reports whether anything changed.
+func (cat *Catalog) refresh() bool {
+	blocks, _ := indexer.Tokens("BUIBlockNFT")
+	if blocks == nil {
+		return false
+	}
+
+	licenses, _ := indexer.Tokens("BUILicenseNFT")
+	counts := make(map[string]int)
+	for _, t := range licenses {
+		if t.Cid != "" {
+			counts[t.Cid]++
+		}
+	}
+
+	cat.mu.RLock()
+	entries := make(map[string]Entry, len(cat.entries))
+	for key, e := range cat.entries {
+		entries[key] = *e
+	}
+	cat.mu.RUnlock()
+
+	// Metadata is read for new tokens and tokens whose URI the indexer
+	// cleared because a token event may have changed it
+	stale := []string{}
+	for id, t := range blocks {
+		e, ok := entries[id]
+		if t.Cid == "" {
+			continue
+		}
+
+		if !ok || t.TokenURI == "" || t.TokenURI != e.MetadataURI {
+			if len(stale) == fetchBatch {
+				break
+			}
+			stale = append(stale, id)
+		}
+	}
+
+	fresh := cat.fetchAll(stale, blocks)
+
+	updated := make(map[string]*Entry)
+	for id, t := range blocks {
+		e, ok := entries[id]
+		if t.Cid == "" {
+			continue
+		}
+
+		if f, fetched := fresh[id]; fetched {
+			if !ok || f.MetadataURI != e.MetadataURI {
+				fmt.Printf("[catalog]\tIndexed token %s\n", id)
+			}
+			e = *f
+		} else if !ok {
+			// Not fetched yet or the fetch failed
+			continue
+		}
+
+		// Tokens whose mint wasn't indexed have no creator
+		e.Creator = ""
+		if t.Creator != ethgo.ZeroAddress {
+			e.Creator = t.Creator.String()
+		}
+		e.Licenses = counts[t.Cid]
+		updated[id] = &e
+	}
+
+	changed := len(updated) != len(entries)
+	for key, e := range updated {
+		old, ok := entries[key]
+		if !ok || old.MetadataURI != e.MetadataURI || old.Licenses != e.Licenses || old.Creator != e.Creator {
+			changed = true
+			break
+		}
+	}
+
+	if !changed {
+		return false
+	}
+
+	ix := buildIndex(updated)
+
+	cat.mu.Lock()
+	cat.entries = updated
+	cat.index = ix
+	cat.mu.Unlock()
+
+	return true
+}
+
+// fetchAll reads the metadata of ids concurrently. Fetches still running
+// at the refresh deadline are given up and retried on the next refresh.
+func (cat *Catalog) fetchAll(ids []string, tokens map[string]indexer.Token) map[string]*Entry {
+	ctx, cancel := context.WithTimeout(context.Background(), refreshDeadline)
+	defer cancel()
+
+	var (
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		fresh = make(map[string]*Entry)
+		queue = make(chan string)
+	)
+
+	for i := 0; i < fetchWorkers && i < len(ids); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range queue {
+				e, err := cat.fetch(ctx, id, tokens[id])
+				if err != nil {
+					fmt.Printf("[catalog]\tFailed to index token %s: %v\n", id, err)
+					continue
+				}
+
+				mu.Lock()
+				fresh[id] = e
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, id := range ids {
+		queue <- id
+	}
+	close(queue)
+	wg.Wait()
+
+	return fresh
+}
+
+func (cat *Catalog) fetch(ctx context.Context, id string, t indexer.Token) (*Entry, error) {
+	tokenId, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	uri, err := indexer.FetchTokenURI("BUIBlockNFT", tokenId)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+
+	data, err := cat.store.Get(ctx, strings.TrimPrefix(uri, "ipfs://"))
+	if err != nil {
+		return nil, err
+	}
+	defer data.Close()
+
+	buf, err := io.ReadAll(io.LimitReader(data, maxMetadataSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(buf) > maxMetadataSize {
+		return nil, fmt.Errorf("Metadata is larger than %d bytes", maxMetadataSize)
+	}
+
+	var meta metadata
+	if err := json.Unmarshal(buf, &meta); err != nil {
+		return nil, err
+	}
+
+	return &Entry{
+		TokenId:     tokenId,
+		Cid:         t.Cid,
+		MetadataURI: uri,
+		Name:        meta.Name,
+		Description: meta.Description,
+		Tags:        ParseTags(meta.Tags),
+		Image:       meta.Image,
+		Preview:     meta.Preview,
+		IndexedAt:   time.Now(),
+	}, nil
+}
+
+func (cat *Catalog) save() error {
+	cat.mu.RLock()
+	data, err := json.Marshal(cat.entries)
+	cat.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cat.path), 0755); err != nil {
+		return err
+	}
+
+	tmp := cat.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, cat.path)
+}
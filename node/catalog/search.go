@@ -0,0 +1,170 @@
+package catalog
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Field weights, so a match in the name ranks above one in the description
+const (
+	nameWeight        = 3
+	tagWeight         = 2
+	descriptionWeight = 1
+)
+
+// Query filters and ranks the catalog. Query matches words in the name,
+// tags and description, each as a prefix; Tag and Creator must match
+// exactly. Page counts from 1.
+type Query struct {
+	Query   string
+	Tag     string
+	Creator string
+	Page    int
+	Limit   int
+}
+
+type Results struct {
+	Total   int      `json:"total"`
+	Page    int      `json:"page"`
+	Limit   int      `json:"limit"`
+	Results []*Entry `json:"results"`
+}
+
+// ParseTags splits the free-form tags string from metadata. Tags are
+// comma separated, or space separated when there are no commas.
+func ParseTags(tags string) []string {
+	sep := func(r rune) bool { return r == ',' }
+	if !strings.Contains(tags, ",") {
+		sep = unicode.IsSpace
+	}
+
+	seen := make(map[string]bool)
+	list := []string{}
+	for _, tag := range strings.FieldsFunc(tags, sep) {
+		tag = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(tag), "#")))
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			list = append(list, tag)
+		}
+	}
+
+	return list
+}
+
+func words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// index maps each word to the entries containing it, with their weight.
+type index map[string]map[string]int
+
+func (ix index) add(key string, text string, weight int) {
+	for _, w := range words(text) {
+		if ix[w] == nil {
+			ix[w] = make(map[string]int)
+		}
+		ix[w][key] += weight
+	}
+}
+
+func buildIndex(entries map[string]*Entry) index {
+	ix := make(index)
+	for key, e := range entries {
+		ix.add(key, e.Name, nameWeight)
+		ix.add(key, strings.Join(e.Tags, " "), tagWeight)
+		ix.add(key, e.Description, descriptionWeight)
+	}
+
+	return ix
+}
+
+// score ranks entries matching every query word. A word matches any
+// indexed word it is a prefix of.
+func (ix index) score(query string) map[string]int {
+	var scores map[string]int
+
+	for _, q := range words(query) {
+		matched := make(map[string]int)
+		for w, keys := range ix {
+			if !strings.HasPrefix(w, q) {
+				continue
+			}
+			for key, weight := range keys {
+				matched[key] += weight
+			}
+		}
+
+		if scores == nil {
+			scores = matched
+			continue
+		}
+
+		for key := range scores {
+			if weight, ok := matched[key]; ok {
+				scores[key] += weight
+			} else {
+				delete(scores, key)
+			}
+		}
+	}
+
+	return scores
+}
+
+func search(entries map[string]*Entry, ix index, q Query) Results {
+	scores := ix.score(q.Query)
+	creator := strings.ToLower(q.Creator)
+	tag := strings.ToLower(q.Tag)
+
+	matches := make([]*Entry, 0)
+	for key, e := range entries {
+		if scores != nil {
+			if _, ok := scores[key]; !ok {
+				continue
+			}
+		}
+
+		if creator != "" && strings.ToLower(e.Creator) != creator {
+			continue
+		}
+
+		if tag != "" && !hasTag(e, tag) {
+			continue
+		}
+
+		matches = append(matches, e)
+	}
+
+	// Best match first, newest first among equals
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if scores != nil && scores[a.key()] != scores[b.key()] {
+			return scores[a.key()] > scores[b.key()]
+		}
+		return a.TokenId > b.TokenId
+	})
+
+	res := Results{Total: len(matches), Page: q.Page, Limit: q.Limit, Results: []*Entry{}}
+	if offset := (q.Page - 1) * q.Limit; offset < len(matches) {
+		end := offset + q.Limit
+		if end > len(matches) {
+			end = len(matches)
+		}
+		res.Results = matches[offset:end]
+	}
+
+	return res
+}
+
+func hasTag(e *Entry, tag string) bool {
+	for _, t := range e.Tags {
+		if t == tag {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,98 @@
+package catalog
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseTags(t *testing.T) {
+	tests := []struct {
+		tags string
+		want []string
+	}{
+		{"", nil},
+		{"   ", nil},
+		{"forms", []string{"forms"}},
+		{"forms buttons", []string{"forms", "buttons"}},
+		{"#Forms #Buttons", []string{"forms", "buttons"}},
+		{"dark mode, forms", []string{"dark mode", "forms"}},
+		{" forms ,, #Buttons , ", []string{"forms", "buttons"}},
+		{"Forms forms FORMS", []string{"forms"}},
+		{"#, forms", []string{"forms"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tags, func(t *testing.T) {
+			got := ParseTags(tt.tags)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			if got == nil {
+				t.Error("got nil, want an empty list")
+			}
+		})
+	}
+}
+
+func TestSearch(t *testing.T) {
+	entries := map[string]*Entry{}
+	for _, e := range []*Entry{
+		{TokenId: 1, Name: "Login form", Tags: []string{"forms"}, Description: "Email and password", Creator: "0xAA"},
+		{TokenId: 2, Name: "Pricing table", Tags: []string{"pricing"}, Description: "Three tiers with a signup form", Creator: "0xbb"},
+		{TokenId: 3, Name: "Newsletter", Tags: []string{"forms", "email"}, Description: "Signup box", Creator: "0xaa"},
+		{TokenId: 4, Name: "Footer", Tags: []string{"layout"}, Description: "Links and copyright", Creator: "0xcc"},
+		{TokenId: 5, Name: "Contact form", Tags: []string{"forms"}, Description: "Email and message", Creator: "0xcc"},
+	} {
+		entries[e.key()] = e
+	}
+	ix := buildIndex(entries)
+
+	tests := []struct {
+		name  string
+		query Query
+		want  []uint64
+		total int
+	}{
+		// Name matches outrank tags, which outrank descriptions; ties go to
+		// the newest token
+		{"ranked", Query{Query: "form"}, []uint64{5, 1, 3, 2}, 4},
+		{"prefix", Query{Query: "sign"}, []uint64{3, 2}, 2},
+		{"every word", Query{Query: "email form"}, []uint64{5, 1, 3}, 3},
+		{"no match", Query{Query: "carousel"}, []uint64{}, 0},
+		{"everything newest first", Query{}, []uint64{5, 4, 3, 2, 1}, 5},
+		{"tag", Query{Tag: "Forms"}, []uint64{5, 3, 1}, 3},
+		{"creator", Query{Creator: "0xaa"}, []uint64{3, 1}, 2},
+		{"query and creator", Query{Query: "form", Creator: "0xCC"}, []uint64{5}, 1},
+		{"first page", Query{Page: 1, Limit: 2}, []uint64{5, 4}, 5},
+		{"last page", Query{Page: 3, Limit: 2}, []uint64{1}, 5},
+		{"past the end", Query{Page: 4, Limit: 2}, []uint64{}, 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.query.Page == 0 {
+				tt.query.Page, tt.query.Limit = 1, 10
+			}
+
+			res := search(entries, ix, tt.query)
+
+			got := make([]uint64, len(res.Results))
+			for i, e := range res.Results {
+				got[i] = e.TokenId
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got %v, want %v", got, tt.want)
+				}
+			}
+
+			if res.Total != tt.total {
+				t.Errorf("got total %d, want %d", res.Total, tt.total)
+			}
+		})
+	}
+}
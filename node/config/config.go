@@ -2,22 +2,42 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
-	ChainName       string
-	ContractsCID    string
-	Env             string
-	HomeDir         string
-	LitVersion      string
-	MinLitNodeCount uint8
-	NetworkName     string
-	Port            string
-	PrimitivesCID   string
-	PrivateKey      string
-	ProviderURL     string
-	RecoveryPhrase  string
-	Web3Token       string
+	AdminToken         string
+	ChainName          string
+	ContractsCID       string
+	Env                string
+	HomeDir            string
+	IPFSApi            string
+	IPFSBootstrap      []string
+	IPFSGateways       []string
+	IPFSGatewayTimeout time.Duration
+	IPFSListen         []string
+	IndexerStart       uint64
+	IndexerStale       time.Duration
+	LitVersion         string
+	MaxBlockSize       uint64
+	MaxImageSize       uint64
+	MinLitNodeCount    uint8
+	MulticallAddress   string
+	NetworkName        string
+	PinGrace           time.Duration
+	PinServiceToken    string
+	PinServiceURL      string
+	Port               string
+	PrimitivesCID      string
+	PrivateKey         string
+	ProviderURL        string
+	RecoveryPhrase     string
+	Store              string
+	StoreDir           string
+	TokenTTL           time.Duration
+	Web3Token          string
 }
 
 func (c *Config) Chain() string {
@@ -28,6 +48,41 @@ func (c *Config) Chain() string {
 	}
 }
 
+func envString(name string, fallback string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+
+	return fallback
+}
+
+func envUint(name string, fallback uint64) uint64 {
+	if v, err := strconv.ParseUint(os.Getenv(name), 10, 64); err == nil {
+		return v
+	}
+
+	return fallback
+}
+
+func envDuration(name string, fallback time.Duration) time.Duration {
+	if v, err := time.ParseDuration(os.Getenv(name)); err == nil {
+		return v
+	}
+
+	return fallback
+}
+
+// envList splits a comma separated setting. "" and "off" give an empty
+// list.
+func envList(name string, fallback string) []string {
+	v := envString(name, fallback)
+	if v == "" || v == "off" {
+		return nil
+	}
+
+	return strings.Split(v, ",")
+}
+
 func New(env string) *Config {
 	hd, err := os.UserHomeDir()
 	if err != nil {
@@ -35,17 +90,34 @@ func New(env string) *Config {
 	}
 
 	return &Config{
-		ChainName:       os.Getenv("CHAIN_NAME"),
-		ContractsCID:    os.Getenv("CONTRACTS_CID"),
-		Env:             env,
-		HomeDir:         hd,
-		LitVersion:      os.Getenv("LIT_VERSION"),
-		MinLitNodeCount: 6,
-		NetworkName:     os.Getenv("NETWORK_NAME"),
-		PrimitivesCID:   os.Getenv("PRIMITIVES_CID"),
-		PrivateKey:      os.Getenv("PRIVATE_KEY"),
-		ProviderURL:     os.Getenv("PROVIDER_URL"),
-		RecoveryPhrase:  os.Getenv("RECOVERY_PHRASE"),
-		Web3Token:       os.Getenv("WEB3STORAGE_TOKEN"),
+		AdminToken:         os.Getenv("ADMIN_TOKEN"),
+		ChainName:          os.Getenv("CHAIN_NAME"),
+		ContractsCID:       os.Getenv("CONTRACTS_CID"),
+		Env:                env,
+		HomeDir:            hd,
+		IPFSApi:            envString("IPFS_API", "localhost:5001"),
+		IPFSBootstrap:      envList("IPFS_BOOTSTRAP", ""),
+		IPFSGateways:       envList("IPFS_GATEWAYS", ""),
+		IPFSGatewayTimeout: envDuration("IPFS_GATEWAY_TIMEOUT", 10*time.Second),
+		IPFSListen:         envList("IPFS_LISTEN", "/ip4/0.0.0.0/tcp/4001,/ip6/::/tcp/4001"),
+		IndexerStart:       envUint("INDEXER_START_BLOCK", 0),
+		IndexerStale:       envDuration("INDEXER_STALENESS", time.Minute),
+		LitVersion:         os.Getenv("LIT_VERSION"),
+		MaxBlockSize:       envUint("MAX_BLOCK_SIZE", 1<<20),
+		MaxImageSize:       envUint("MAX_IMAGE_SIZE", 5<<20),
+		MinLitNodeCount:    6,
+		MulticallAddress:   os.Getenv("MULTICALL_ADDRESS"),
+		NetworkName:        os.Getenv("NETWORK_NAME"),
+		PinGrace:           envDuration("PIN_GRACE", 72*time.Hour),
+		PinServiceToken:    os.Getenv("PIN_SERVICE_TOKEN"),
+		PinServiceURL:      os.Getenv("PIN_SERVICE_URL"),
+		PrimitivesCID:      os.Getenv("PRIMITIVES_CID"),
+		PrivateKey:         os.Getenv("PRIVATE_KEY"),
+		ProviderURL:        os.Getenv("PROVIDER_URL"),
+		RecoveryPhrase:     os.Getenv("RECOVERY_PHRASE"),
+		Store:              os.Getenv("STORE"),
+		StoreDir:           os.Getenv("STORE_DIR"),
+		TokenTTL:           envDuration("TOKEN_TTL", 24*time.Hour),
+		Web3Token:          os.Getenv("WEB3STORAGE_TOKEN"),
 	}
 }
@@ -1,13 +1,108 @@
 package contracts
 
-var idNameMap = map[string]string{
-	"1":     "ethereum",
-	"137":   "polygon",
-	"80001": "mumbai",
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+type Chain struct {
+	Id       string
+	Name     string
+	Currency string
+	Decimals uint8
+}
+
+var chains = []Chain{
+	{"1", "ethereum", "ETH", 18},
+	{"137", "polygon", "MATIC", 18},
+	{"80001", "mumbai", "MATIC", 18},
 }
 
-// TODO: Make this a struct
+func ChainForId(id string) (Chain, bool) {
+	for _, c := range chains {
+		if c.Id == id {
+			return c, true
+		}
+	}
+
+	return Chain{}, false
+}
+
+func ChainForName(name string) (Chain, bool) {
+	for _, c := range chains {
+		if c.Name == name {
+			return c, true
+		}
+	}
+
+	return Chain{}, false
+}
 
 func ChainNameForId(id string) string {
-	return idNameMap[id]
+	c, _ := ChainForId(id)
+	return c.Name
+}
+
+// FormatUnits renders wei in the chain's native currency, e.g. 1.5 MATIC.
+func (c Chain) FormatUnits(wei *big.Int) string {
+	base := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(c.Decimals)), nil)
+	whole, frac := new(big.Int).QuoRem(new(big.Int).Abs(wei), base, new(big.Int))
+
+	sign := ""
+	if wei.Sign() < 0 {
+		sign = "-"
+	}
+
+	fracStr := frac.String()
+	fracStr = strings.TrimRight(strings.Repeat("0", int(c.Decimals)-len(fracStr))+fracStr, "0")
+	if fracStr == "" {
+		return fmt.Sprintf("%s%s %s", sign, whole, c.Currency)
+	}
+
+	return fmt.Sprintf("%s%s.%s %s", sign, whole, fracStr, c.Currency)
+}
+
+func digits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ParseWei reads a whole amount of wei.
+func ParseWei(amount string) (*big.Int, error) {
+	amount = strings.TrimSpace(amount)
+	if amount == "" || !digits(amount) {
+		return nil, fmt.Errorf("Invalid amount %q", amount)
+	}
+
+	wei, _ := new(big.Int).SetString(amount, 10)
+
+	return wei, nil
+}
+
+// ParseUnits converts an amount in the native currency, such as 1.5, into
+// wei.
+func (c Chain) ParseUnits(amount string) (*big.Int, error) {
+	parts := strings.SplitN(strings.TrimSpace(amount), ".", 2)
+
+	whole, frac := parts[0], ""
+	if len(parts) == 2 {
+		frac = parts[1]
+	}
+
+	if whole+frac == "" || !digits(whole) || !digits(frac) {
+		return nil, fmt.Errorf("Invalid amount %q", amount)
+	}
+	if len(frac) > int(c.Decimals) {
+		return nil, fmt.Errorf("Too many decimals in %s", amount)
+	}
+
+	wei, _ := new(big.Int).SetString(whole+frac+strings.Repeat("0", int(c.Decimals)-len(frac)), 10)
+
+	return wei, nil
 }
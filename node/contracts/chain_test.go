@@ -0,0 +1,81 @@
+package contracts
+
+import (
+	"testing"
+)
+
+func TestParseUnits(t *testing.T) {
+	matic, _ := ChainForName("polygon")
+
+	tests := []struct {
+		amount string
+		want   string
+		err    bool
+	}{
+		{"1", "1000000000000000000", false},
+		{"1.5", "1500000000000000000", false},
+		{" 0.000000000000000001 ", "1", false},
+		{".5", "500000000000000000", false},
+		{"2.", "2000000000000000000", false},
+		{"0", "0", false},
+		{"", "", true},
+		{".", "", true},
+		{"-1", "", true},
+		{"+1", "", true},
+		{"1.-5", "", true},
+		{"1e18", "", true},
+		{"1.2.3", "", true},
+		{"0.0000000000000000001", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.amount, func(t *testing.T) {
+			got, err := matic.ParseUnits(tt.amount)
+			if tt.err {
+				if err == nil {
+					t.Errorf("got %s, want an error", got)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseWei(t *testing.T) {
+	tests := []struct {
+		amount string
+		want   string
+		err    bool
+	}{
+		{"15", "15", false},
+		{"", "", true},
+		{"-15", "", true},
+		{"1.5", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.amount, func(t *testing.T) {
+			got, err := ParseWei(tt.amount)
+			if tt.err {
+				if err == nil {
+					t.Errorf("got %s, want an error", got)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
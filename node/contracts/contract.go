@@ -1,13 +1,18 @@
 package contracts
 
 import (
+	"blocksui-node/abi"
 	"blocksui-node/config"
 	"blocksui-node/ipfs"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/fs"
 	"path/filepath"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/umbracle/ethgo"
 	ethgoAbi "github.com/umbracle/ethgo/abi"
@@ -25,16 +30,56 @@ type ContractConfig struct {
 type Contract struct {
 	Address      ethgo.Address
 	Abi          *ethgoAbi.ABI
+	Functions    map[string]abi.Function
 	Provider     *contract.Contract
 	RawBytes     []byte
 	EncryptedKey string
+
+	// Reads with a sender may depend on msg.sender, so they aren't batched
+	sender bool
+}
+
+// Member returns method as a Lit access condition's functionAbi, in the
+// fixed form existing keys were saved under.
+func (c *Contract) Member(method string) (abi.AbiMember, bool) {
+	if m := c.Abi.GetMethod(method); m != nil {
+		return abi.MethodToMember(m), true
+	}
+
+	return abi.AbiMember{}, false
+}
+
+// Function returns the full JSON ABI entry for method.
+func (c *Contract) Function(method string) (abi.Function, bool) {
+	if f, ok := c.Functions[method]; ok {
+		return f, true
+	}
+
+	if m := c.Abi.GetMethod(method); m != nil {
+		return abi.MethodToFunction(m), true
+	}
+
+	return abi.Function{}, false
 }
 
 func (c *Contract) Txn(method string, args ...interface{}) (contract.Txn, error) {
 	return c.Provider.Txn(method, args...)
 }
 
+// Call goes through the multicall batcher when one is configured, so the
+// contract sees Multicall3 as msg.sender. Contracts bound to a sender are
+// always called directly.
 func (c *Contract) Call(method string, args ...interface{}) (map[string]interface{}, error) {
+	if batcher != nil && !c.sender {
+		m := c.Abi.GetMethod(method)
+		if m == nil {
+			return nil, fmt.Errorf("Method not found: %s", method)
+		}
+
+		res := batcher.Call(c.Address, m, args...)
+		return res.Values, res.Err
+	}
+
 	return c.Provider.Call(method, ethgo.Latest, args...)
 }
 
@@ -57,7 +102,19 @@ func LoadContracts(c *config.Config) error {
 		client = newClient
 	}
 
-	res, err := ipfs.Web3Get(c.ContractsCID, c.Web3Token)
+	// Batching is opt-in since not every chain has Multicall3
+	switch c.MulticallAddress {
+	case "", "off":
+	case "default":
+		batcher = probeMulticall(ethgo.HexToAddress(MulticallAddress))
+	default:
+		batcher = probeMulticall(ethgo.HexToAddress(c.MulticallAddress))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	res, err := ipfs.Web3Get(ctx, c.ContractsCID, c.Web3Token)
 	if err != nil {
 		fmt.Println("Web3 Error")
 		return err
@@ -94,9 +151,22 @@ func LoadContracts(c *config.Config) error {
 				return err
 			}
 
+			var raw struct {
+				Abi json.RawMessage `json:"abi"`
+			}
+			if err := json.Unmarshal(data, &raw); err != nil {
+				return err
+			}
+
+			functions, err := abi.ParseFunctions(raw.Abi)
+			if err != nil {
+				return err
+			}
+
 			contracts[cnf.ContractName] = Contract{
-				Address: cnf.Address,
-				Abi:     cnf.Abi,
+				Address:   cnf.Address,
+				Abi:       cnf.Abi,
+				Functions: functions,
 				Provider: contract.NewContract(
 					cnf.Address,
 					cnf.Abi,
@@ -111,6 +181,10 @@ func LoadContracts(c *config.Config) error {
 	})
 }
 
+func Eth() *jsonrpc.Eth {
+	return client.Eth()
+}
+
 func GetContract(name string) (*Contract, bool) {
 	if c, ok := contracts[name]; ok {
 		return &c, true
@@ -119,6 +193,22 @@ func GetContract(name string) (*Contract, bool) {
 	return nil, false
 }
 
+// ContractAt is the named contract's ABI bound to another address, such as
+// an earlier deployment.
+func ContractAt(name string, address ethgo.Address) (*Contract, bool) {
+	c, ok := contracts[name]
+	if !ok {
+		return nil, false
+	}
+
+	return &Contract{
+		Address:   address,
+		Abi:       c.Abi,
+		Functions: c.Functions,
+		Provider:  contract.NewContract(address, c.Abi, contract.WithJsonRPC(client.Eth())),
+	}, true
+}
+
 func ContractForSender(name string, withSender contract.ContractOption) *Contract {
 	c := contracts[name]
 	opts := []contract.ContractOption{
@@ -126,12 +216,103 @@ func ContractForSender(name string, withSender contract.ContractOption) *Contrac
 		withSender,
 	}
 	return &Contract{
-		Address:  c.Address,
-		Abi:      c.Abi,
-		Provider: contract.NewContract(c.Address, c.Abi, opts...),
+		Address:   c.Address,
+		Abi:       c.Abi,
+		Functions: c.Functions,
+		Provider:  contract.NewContract(c.Address, c.Abi, opts...),
+		sender:    true,
 	}
 }
 
+var (
+	deployMu     sync.Mutex
+	deployBlocks = make(map[string]uint64)
+)
+
+// DeploymentBlock is the first block the named contract has code at,
+// found by bisecting eth_getCode. Providers that keep no historical state
+// can't answer, in which case it is the genesis block.
+func DeploymentBlock(name string) (uint64, error) {
+	deployMu.Lock()
+	defer deployMu.Unlock()
+
+	if n, ok := deployBlocks[name]; ok {
+		return n, nil
+	}
+
+	cnt, ok := GetContract(name)
+	if !ok {
+		return 0, fmt.Errorf("Contract not found %s", name)
+	}
+
+	eth := client.Eth()
+	head, err := eth.BlockNumber()
+	if err != nil {
+		return 0, err
+	}
+
+	lo, hi := uint64(0), head
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+
+		code, err := eth.GetCode(cnt.Address, ethgo.BlockNumber(mid))
+		if err != nil {
+			fmt.Printf("[contracts]\tNo state for block %d, searching %s from genesis\n", mid, name)
+			lo = 0
+			break
+		}
+
+		if code != "" && code != "0x" {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+
+	deployBlocks[name] = lo
+
+	return lo, nil
+}
+
+// probeMulticall only batches through address once it holds code.
+func probeMulticall(address ethgo.Address) *Batcher {
+	code, err := client.Eth().GetCode(address, ethgo.Latest)
+	if err != nil || code == "" || code == "0x" {
+		fmt.Printf("[contracts]\tNo Multicall3 at %s, calling contracts directly\n", address)
+		return nil
+	}
+
+	return NewBatcher(client.Eth(), address, BatchWindow)
+}
+
+// withFunctions adds the contract's functions in full, with internalType,
+// components and the real state mutability, to its deployment JSON.
+func withFunctions(contract Contract) []byte {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(contract.RawBytes, &fields); err != nil {
+		return contract.RawBytes
+	}
+
+	functions := make([]abi.Function, 0, len(contract.Functions))
+	for _, f := range contract.Functions {
+		functions = append(functions, f)
+	}
+	sort.Slice(functions, func(i, j int) bool { return functions[i].Name < functions[j].Name })
+
+	data, err := json.Marshal(functions)
+	if err != nil {
+		return contract.RawBytes
+	}
+	fields["functions"] = data
+
+	out, err := json.Marshal(fields)
+	if err != nil {
+		return contract.RawBytes
+	}
+
+	return out
+}
+
 func MarshalABIs(c *config.Config) []byte {
 	result := `{
 		"chain": "` + c.ChainName + `",
@@ -140,7 +321,7 @@ func MarshalABIs(c *config.Config) []byte {
 	i := 0
 	for name, contract := range contracts {
 		result += `"` + name + `": `
-		result += string(contract.RawBytes)
+		result += string(withFunctions(contract))
 		i++
 		if i < len(contracts) {
 			result += `,
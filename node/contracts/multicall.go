@@ -0,0 +1,334 @@
+package contracts
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/umbracle/ethgo"
+	ethgoAbi "github.com/umbracle/ethgo/abi"
+)
+
+// Multicall3 is deployed at the same address on every supported chain.
+const MulticallAddress = "0xcA11bde05977b3631167028862bE2a173976CA11"
+
+const BatchWindow = 10 * time.Millisecond
+
+// MaxBatch caps the calls in one aggregate3, which has to fit in the
+// provider's eth_call gas limit.
+const MaxBatch = 200
+
+var (
+	aggregate3 = &ethgoAbi.Method{
+		Name:    "aggregate3",
+		Inputs:  ethgoAbi.MustNewType("tuple(tuple(address target, bool allowFailure, bytes callData)[] calls)"),
+		Outputs: ethgoAbi.MustNewType("tuple(tuple(bool success, bytes returnData)[] returnData)"),
+	}
+	getBlockNumber = &ethgoAbi.Method{
+		Name:    "getBlockNumber",
+		Inputs:  ethgoAbi.MustNewType("tuple()"),
+		Outputs: ethgoAbi.MustNewType("tuple(uint256 blockNumber)"),
+	}
+)
+
+// Caller is the part of the JSON-RPC client the batcher needs. A simulated
+// backend can stand in for it.
+type Caller interface {
+	Call(msg *ethgo.CallMsg, block ethgo.BlockNumber) (string, error)
+}
+
+type CallResult struct {
+	Values map[string]interface{}
+	Block  uint64
+	Err    error
+}
+
+type callRequest struct {
+	target ethgo.Address
+	method *ethgoAbi.Method
+	data   []byte
+	result chan CallResult
+}
+
+type Batcher struct {
+	address ethgo.Address
+	caller  Caller
+	window  time.Duration
+
+	mu      sync.Mutex
+	pending []*callRequest
+}
+
+var batcher *Batcher
+
+func NewBatcher(caller Caller, address ethgo.Address, window time.Duration) *Batcher {
+	return &Batcher{
+		address: address,
+		caller:  caller,
+		window:  window,
+	}
+}
+
+func newRequest(target ethgo.Address, method *ethgoAbi.Method, args []interface{}) (*callRequest, error) {
+	data, err := method.Encode(args)
+	if err != nil {
+		return nil, err
+	}
+
+	return &callRequest{
+		target: target,
+		method: method,
+		data:   data,
+		result: make(chan CallResult, 1),
+	}, nil
+}
+
+// Call queues a read and waits for the batch it lands in. Every call in a
+// batch is answered from the same block, but a burst of more than
+// MaxBatch calls is split over several batches.
+func (b *Batcher) Call(target ethgo.Address, method *ethgoAbi.Method, args ...interface{}) CallResult {
+	req, err := newRequest(target, method, args)
+	if err != nil {
+		return CallResult{Err: err}
+	}
+
+	b.mu.Lock()
+	b.pending = append(b.pending, req)
+	if len(b.pending) == 1 {
+		time.AfterFunc(b.window, b.flush)
+	}
+	b.mu.Unlock()
+
+	return <-req.result
+}
+
+// Pinned makes reads all answered at block, however many batches they
+// take.
+func (b *Batcher) Pinned(block uint64, reads ...PinnedRead) []CallResult {
+	results := make([]CallResult, len(reads))
+	reqs := make([]*callRequest, len(reads))
+
+	pending := make([]*callRequest, 0, len(reads))
+	for i, read := range reads {
+		req, err := newRequest(read.Target, read.Method, read.Args)
+		if err != nil {
+			results[i] = CallResult{Err: err}
+			continue
+		}
+
+		reqs[i] = req
+		pending = append(pending, req)
+	}
+
+	b.run(pending, ethgo.BlockNumber(block))
+
+	for i, req := range reqs {
+		if req != nil {
+			results[i] = <-req.result
+		}
+	}
+
+	return results
+}
+
+// PinnedRead is one read made through Pinned.
+type PinnedRead struct {
+	Target ethgo.Address
+	Method *ethgoAbi.Method
+	Args   []interface{}
+}
+
+func (b *Batcher) flush() {
+	b.mu.Lock()
+	reqs := b.pending
+	b.pending = nil
+	b.mu.Unlock()
+
+	b.run(reqs, ethgo.Latest)
+}
+
+// run answers reqs in aggregates of at most MaxBatch calls at block.
+func (b *Batcher) run(reqs []*callRequest, block ethgo.BlockNumber) {
+	var wg sync.WaitGroup
+	for len(reqs) > 0 {
+		n := len(reqs)
+		if n > MaxBatch {
+			n = MaxBatch
+		}
+
+		wg.Add(1)
+		go func(reqs []*callRequest) {
+			defer wg.Done()
+			b.batch(reqs, block)
+		}(reqs[:n])
+
+		reqs = reqs[n:]
+	}
+	wg.Wait()
+}
+
+func (b *Batcher) batch(reqs []*callRequest, block ethgo.BlockNumber) {
+	calls := make([]map[string]interface{}, 0, len(reqs)+1)
+	calls = append(calls, map[string]interface{}{
+		"target":       b.address,
+		"allowFailure": false,
+		"callData":     getBlockNumber.ID(),
+	})
+	for _, req := range reqs {
+		calls = append(calls, map[string]interface{}{
+			"target":       req.target,
+			"allowFailure": true,
+			"callData":     req.data,
+		})
+	}
+
+	results, err := b.aggregate(calls, block)
+	if err != nil {
+		// The aggregate itself failed, so its calls are made one by one
+		fmt.Printf("[multicall]\t%v, calling directly\n", err)
+		for _, req := range reqs {
+			go func(req *callRequest) {
+				req.result <- b.direct(req, block)
+			}(req)
+		}
+		return
+	}
+
+	var answered uint64
+	if res, err := getBlockNumber.Decode(results[0]["returnData"].([]byte)); err == nil {
+		answered = res["blockNumber"].(*big.Int).Uint64()
+	}
+
+	for i, req := range reqs {
+		res := results[i+1]
+		if !res["success"].(bool) {
+			msg := "Call reverted"
+			if reason, err := ethgoAbi.UnpackRevertError(res["returnData"].([]byte)); err == nil {
+				msg = reason
+			}
+			req.result <- CallResult{Block: answered, Err: fmt.Errorf("%s: %s", req.method.Name, msg)}
+			continue
+		}
+
+		values, err := req.method.Decode(res["returnData"].([]byte))
+		req.result <- CallResult{Values: values, Block: answered, Err: err}
+	}
+}
+
+// direct makes a queued read as a plain eth_call.
+func (b *Batcher) direct(req *callRequest, block ethgo.BlockNumber) CallResult {
+	out, err := b.caller.Call(&ethgo.CallMsg{
+		To:   &req.target,
+		Data: req.data,
+	}, block)
+	if err != nil {
+		return CallResult{Err: err}
+	}
+
+	raw, err := hex.DecodeString(strings.TrimPrefix(out, "0x"))
+	if err != nil {
+		return CallResult{Err: err}
+	}
+
+	values, err := req.method.Decode(raw)
+	if block >= 0 {
+		return CallResult{Values: values, Block: uint64(block), Err: err}
+	}
+	return CallResult{Values: values, Err: err}
+}
+
+func (b *Batcher) aggregate(calls []map[string]interface{}, block ethgo.BlockNumber) ([]map[string]interface{}, error) {
+	data, err := aggregate3.Encode([]interface{}{calls})
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := b.caller.Call(&ethgo.CallMsg{
+		To:   &b.address,
+		Data: data,
+	}, block)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := hex.DecodeString(strings.TrimPrefix(out, "0x"))
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := aggregate3.Decode(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	results, ok := res["returnData"].([]map[string]interface{})
+	if !ok || len(results) != len(calls) {
+		return nil, fmt.Errorf("Unexpected multicall response")
+	}
+
+	return results, nil
+}
+
+type Read struct {
+	Contract string
+	Method   string
+	Args     []interface{}
+}
+
+// ReadAll makes the reads at the current head block, so they agree with
+// each other. With a batcher they share multicalls, otherwise each read
+// is a separate call pinned to that block.
+func ReadAll(reads ...Read) ([]map[string]interface{}, error) {
+	head, err := client.Eth().BlockNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]map[string]interface{}, len(reads))
+	errs := make([]error, len(reads))
+
+	ctrs := make([]*Contract, len(reads))
+	for i, read := range reads {
+		ctr, ok := GetContract(read.Contract)
+		if !ok {
+			return nil, fmt.Errorf("Could not load %s contract", read.Contract)
+		}
+		ctrs[i] = ctr
+	}
+
+	if batcher != nil {
+		pinned := make([]PinnedRead, len(reads))
+		for i, read := range reads {
+			m := ctrs[i].Abi.GetMethod(read.Method)
+			if m == nil {
+				return nil, fmt.Errorf("Method not found: %s", read.Method)
+			}
+			pinned[i] = PinnedRead{Target: ctrs[i].Address, Method: m, Args: read.Args}
+		}
+
+		for i, res := range batcher.Pinned(head, pinned...) {
+			results[i], errs[i] = res.Values, res.Err
+		}
+	} else {
+		var wg sync.WaitGroup
+		for i, read := range reads {
+			wg.Add(1)
+			go func(i int, read Read) {
+				defer wg.Done()
+				results[i], errs[i] = ctrs[i].Provider.Call(read.Method, ethgo.BlockNumber(head), read.Args...)
+			}(i, read)
+		}
+		wg.Wait()
+	}
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return results, nil
+}
@@ -0,0 +1,295 @@
+package contracts
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	gethAbi "github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/umbracle/ethgo"
+	ethgoAbi "github.com/umbracle/ethgo/abi"
+	"github.com/umbracle/ethgo/contract"
+)
+
+// getEthBalance is a Multicall3 read, so the deployed Multicall3 is also
+// the contract read through it.
+var getEthBalance = &ethgoAbi.Method{
+	Name:    "getEthBalance",
+	Inputs:  ethgoAbi.MustNewType("tuple(address addr)"),
+	Outputs: ethgoAbi.MustNewType("tuple(uint256 balance)"),
+}
+
+// simCaller answers eth_call from a simulated chain and counts the
+// aggregate3 and direct calls it sees, and the blocks they were made at.
+type simCaller struct {
+	sim *backends.SimulatedBackend
+
+	mu        sync.Mutex
+	aggregate int
+	direct    int
+	blocks    []ethgo.BlockNumber
+}
+
+func (s *simCaller) Call(msg *ethgo.CallMsg, block ethgo.BlockNumber) (string, error) {
+	s.mu.Lock()
+	if bytes.HasPrefix(msg.Data, aggregate3.ID()) {
+		s.aggregate++
+	} else {
+		s.direct++
+	}
+	s.blocks = append(s.blocks, block)
+	s.mu.Unlock()
+
+	var number *big.Int
+	if block >= 0 {
+		number = big.NewInt(int64(block))
+	}
+
+	to := common.Address(*msg.To)
+	out, err := s.sim.CallContract(context.Background(), ethereum.CallMsg{To: &to, Data: msg.Data}, number)
+
+	return "0x" + hex.EncodeToString(out), err
+}
+
+func (s *simCaller) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.aggregate, s.direct, s.blocks = 0, 0, nil
+}
+
+// owner is funded with i+1 wei, so each read has a distinct answer.
+func owner(i int) ethgo.Address {
+	return ethgo.Address{18: byte((i + 1) >> 8), 19: byte(i + 1)}
+}
+
+// newChain deploys Multicall3 to a simulated chain with n funded owners.
+func newChain(t *testing.T, n int) (*simCaller, ethgo.Address) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	auth, err := bind.NewKeyedTransactorWithChainID(key, big.NewInt(1337))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alloc := core.GenesisAlloc{auth.From: {Balance: new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)}}
+	for i := 0; i < n; i++ {
+		alloc[common.Address(owner(i))] = core.GenesisAccount{Balance: big.NewInt(int64(i + 1))}
+	}
+
+	sim := backends.NewSimulatedBackend(alloc, 30000000)
+	t.Cleanup(func() { sim.Close() })
+
+	// The creation code of Multicall3 as deployed on every chain
+	bin, err := os.ReadFile("testdata/Multicall3.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	address, _, _, err := bind.DeployContract(auth, gethAbi.ABI{}, common.FromHex(strings.TrimSpace(string(bin))), sim)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim.Commit()
+
+	return &simCaller{sim: sim}, ethgo.Address(address)
+}
+
+func (s *simCaller) head() uint64 {
+	return s.sim.Blockchain().CurrentBlock().NumberU64()
+}
+
+func callBalances(b *Batcher, target ethgo.Address, n int) []CallResult {
+	results := make([]CallResult, n)
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = b.Call(target, getEthBalance, owner(i))
+		}(i)
+	}
+	wg.Wait()
+
+	return results
+}
+
+func checkBalances(t *testing.T, results []CallResult) {
+	t.Helper()
+
+	for i, res := range results {
+		if res.Err != nil {
+			t.Fatalf("call %d: %v", i, res.Err)
+		}
+		if got := res.Values["balance"].(*big.Int).Int64(); got != int64(i+1) {
+			t.Errorf("call %d: got balance %d, want %d", i, got, i+1)
+		}
+	}
+}
+
+func TestBatcher(t *testing.T) {
+	caller, multicall := newChain(t, 3)
+
+	tests := []struct {
+		name      string
+		address   ethgo.Address
+		aggregate int
+		direct    int
+		block     uint64
+	}{
+		{"batched", multicall, 1, 0, caller.head()},
+		// eth_call to an address without code returns nothing
+		{"multicall missing", ethgo.Address{19: 0xee}, 1, 3, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			caller.reset()
+			b := NewBatcher(caller, tt.address, 20*time.Millisecond)
+
+			results := callBalances(b, multicall, 3)
+			checkBalances(t, results)
+
+			for i, res := range results {
+				if res.Block != tt.block {
+					t.Errorf("call %d: got block %d, want %d", i, res.Block, tt.block)
+				}
+			}
+
+			if caller.aggregate != tt.aggregate || caller.direct != tt.direct {
+				t.Errorf("got %d aggregate and %d direct calls, want %d and %d", caller.aggregate, caller.direct, tt.aggregate, tt.direct)
+			}
+		})
+	}
+}
+
+func TestBatchCap(t *testing.T) {
+	caller, multicall := newChain(t, MaxBatch+5)
+	b := NewBatcher(caller, multicall, 50*time.Millisecond)
+
+	checkBalances(t, callBalances(b, multicall, MaxBatch+5))
+
+	if caller.aggregate != 2 || caller.direct != 0 {
+		t.Errorf("got %d aggregate and %d direct calls, want 2 and 0", caller.aggregate, caller.direct)
+	}
+}
+
+func TestPinned(t *testing.T) {
+	caller, multicall := newChain(t, MaxBatch+5)
+
+	tests := []struct {
+		name      string
+		address   ethgo.Address
+		aggregate int
+		direct    int
+	}{
+		{"batched", multicall, 2, 0},
+		{"multicall missing", ethgo.Address{19: 0xee}, 2, MaxBatch + 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			caller.reset()
+			b := NewBatcher(caller, tt.address, time.Hour)
+
+			reads := make([]PinnedRead, MaxBatch+5)
+			for i := range reads {
+				reads[i] = PinnedRead{Target: multicall, Method: getEthBalance, Args: []interface{}{owner(i)}}
+			}
+
+			head := caller.head()
+			results := b.Pinned(head, reads...)
+			checkBalances(t, results)
+
+			for i, res := range results {
+				if res.Block != head {
+					t.Errorf("call %d: got block %d, want %d", i, res.Block, head)
+				}
+			}
+
+			// Every call, split or not, is made at the pinned block
+			for _, block := range caller.blocks {
+				if block != ethgo.BlockNumber(head) {
+					t.Errorf("got a call at %s, want block %d", block, head)
+				}
+			}
+
+			if caller.aggregate != tt.aggregate || caller.direct != tt.direct {
+				t.Errorf("got %d aggregate and %d direct calls, want %d and %d", caller.aggregate, caller.direct, tt.aggregate, tt.direct)
+			}
+		})
+	}
+}
+
+// simProvider sends a contract's direct calls to the simulated chain.
+type simProvider struct {
+	caller *simCaller
+}
+
+func (p simProvider) Call(to ethgo.Address, data []byte, opts *contract.CallOpts) ([]byte, error) {
+	out, err := p.caller.Call(&ethgo.CallMsg{To: &to, Data: data}, ethgo.Latest)
+	if err != nil {
+		return nil, err
+	}
+
+	return hex.DecodeString(strings.TrimPrefix(out, "0x"))
+}
+
+func (p simProvider) Txn(ethgo.Address, ethgo.Key, []byte) (contract.Txn, error) {
+	return nil, fmt.Errorf("Not supported")
+}
+
+func TestSenderIsNotBatched(t *testing.T) {
+	caller, multicall := newChain(t, 7)
+	batcher = NewBatcher(caller, multicall, time.Millisecond)
+	defer func() { batcher = nil }()
+
+	abi := &ethgoAbi.ABI{Methods: map[string]*ethgoAbi.Method{"getEthBalance": getEthBalance}}
+	provider := contract.NewContract(multicall, abi, contract.WithProvider(simProvider{caller}))
+
+	tests := []struct {
+		name      string
+		sender    bool
+		aggregate int
+		direct    int
+	}{
+		{"without sender", false, 1, 0},
+		{"with sender", true, 0, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			caller.reset()
+
+			c := &Contract{Address: multicall, Abi: abi, Provider: provider, sender: tt.sender}
+			res, err := c.Call("getEthBalance", owner(6))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := res["balance"].(*big.Int).Int64(); got != 7 {
+				t.Errorf("got balance %d, want 7", got)
+			}
+
+			if caller.aggregate != tt.aggregate || caller.direct != tt.direct {
+				t.Errorf("got %d aggregate and %d direct calls, want %d and %d", caller.aggregate, caller.direct, tt.aggregate, tt.direct)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package contracts
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/umbracle/ethgo"
+	ethgoAbi "github.com/umbracle/ethgo/abi"
+	"github.com/umbracle/ethgo/jsonrpc/codec"
+)
+
+type Plan struct {
+	Contract  string                 `json:"contract"`
+	Method    string                 `json:"method"`
+	From      ethgo.Address          `json:"from"`
+	To        ethgo.Address          `json:"to"`
+	Block     uint64                 `json:"block"`
+	Value     string                 `json:"value"`
+	Gas       uint64                 `json:"gas"`
+	GasPrice  string                 `json:"gasPrice"`
+	TotalCost string                 `json:"totalCost"`
+	Result    map[string]interface{} `json:"result,omitempty"`
+	Reverted  bool                   `json:"reverted"`
+	Revert    string                 `json:"revertReason,omitempty"`
+}
+
+// revertReason extracts the Error(string) message from a failed eth_call
+// or eth_estimateGas. Providers put the revert data in the error object.
+func revertReason(err error) (string, bool) {
+	obj, ok := err.(*codec.ErrorObject)
+	if !ok {
+		return "", false
+	}
+
+	if data, ok := obj.Data.(string); ok && strings.HasPrefix(data, "0x") {
+		raw, herr := hex.DecodeString(data[2:])
+		if herr == nil {
+			if reason, rerr := ethgoAbi.UnpackRevertError(raw); rerr == nil {
+				return reason, true
+			}
+		}
+	}
+
+	if strings.Contains(obj.Message, "revert") {
+		return obj.Message, true
+	}
+
+	return "", false
+}
+
+// Simulate runs method against the latest block without sending a
+// transaction and reports the decoded result or revert reason together
+// with the gas estimate and total cost.
+func Simulate(from ethgo.Address, name, method string, value *big.Int, args ...interface{}) (*Plan, error) {
+	ctr, ok := GetContract(name)
+	if !ok {
+		return nil, fmt.Errorf("Could not load %s contract", name)
+	}
+
+	m := ctr.Abi.GetMethod(method)
+	if m == nil {
+		return nil, fmt.Errorf("Method not found: %s", method)
+	}
+
+	data, err := m.Encode(args)
+	if err != nil {
+		return nil, err
+	}
+
+	if value == nil {
+		value = big.NewInt(0)
+	}
+
+	eth := client.Eth()
+
+	block, err := eth.BlockNumber()
+	if err != nil {
+		return nil, err
+	}
+
+	gasPrice, err := eth.GasPrice()
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{
+		Contract: name,
+		Method:   method,
+		From:     from,
+		To:       ctr.Address,
+		Block:    block,
+		Value:    value.String(),
+		GasPrice: new(big.Int).SetUint64(gasPrice).String(),
+	}
+
+	msg := &ethgo.CallMsg{
+		From:  from,
+		To:    &ctr.Address,
+		Data:  data,
+		Value: value,
+	}
+
+	out, err := eth.Call(msg, ethgo.BlockNumber(block))
+	if err != nil {
+		reason, ok := revertReason(err)
+		if !ok {
+			return nil, err
+		}
+
+		plan.Reverted = true
+		plan.Revert = reason
+		plan.TotalCost = value.String()
+
+		return plan, nil
+	}
+
+	if raw, err := hex.DecodeString(strings.TrimPrefix(out, "0x")); err == nil && len(raw) > 0 {
+		if res, err := m.Decode(raw); err == nil {
+			plan.Result = res
+		}
+	}
+
+	gas, err := eth.EstimateGas(msg)
+	if err != nil {
+		reason, ok := revertReason(err)
+		if !ok {
+			return nil, err
+		}
+
+		plan.Reverted = true
+		plan.Revert = reason
+	}
+	plan.Gas = gas
+
+	total := new(big.Int).Mul(new(big.Int).SetUint64(gas), new(big.Int).SetUint64(gasPrice))
+	plan.TotalCost = total.Add(total, value).String()
+
+	return plan, nil
+}
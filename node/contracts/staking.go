@@ -1,8 +1,11 @@
 package contracts
 
 import (
+	"blocksui-node/abi"
 	"fmt"
 	"math/big"
+	"sort"
+	"strings"
 
 	"github.com/umbracle/ethgo"
 	"github.com/umbracle/ethgo/contract"
@@ -53,13 +56,21 @@ func Verify(address ethgo.Address) (bool, error) {
 	return res["0"].(bool), nil
 }
 
-func CalcStake(address ethgo.Address) (*big.Int, error) {
-	cost, err := StakingCost()
+// StakeStatus reads the staking cost and balance at the same block.
+func StakeStatus(address ethgo.Address) (cost *big.Int, balance *big.Int, err error) {
+	res, err := ReadAll(
+		Read{"BUINodeStaking", "stakingCost", nil},
+		Read{"BUINodeStaking", "balance", []interface{}{address}},
+	)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	balance, err := StakeBalance(address)
+	return res[0]["0"].(*big.Int), res[1]["0"].(*big.Int), nil
+}
+
+func CalcStake(address ethgo.Address) (*big.Int, error) {
+	cost, balance, err := StakeStatus(address)
 	if err != nil {
 		return nil, err
 	}
@@ -67,6 +78,14 @@ func CalcStake(address ethgo.Address) (*big.Int, error) {
 	return cost.Sub(cost, balance), nil
 }
 
+func SimulateRegister(from ethgo.Address, ip []byte, stake *big.Int) (*Plan, error) {
+	return Simulate(from, "BUINodeStaking", "register", stake, toHexString(ip))
+}
+
+func SimulateUnregister(from ethgo.Address) (*Plan, error) {
+	return Simulate(from, "BUINodeStaking", "unregister", nil)
+}
+
 func Register(sender contract.ContractOption, ip []byte, stake *big.Int) bool {
 	ctr := ContractForSender("BUINodeStaking", sender)
 	// TODO: hex.EncodeToString
@@ -124,3 +143,120 @@ func Unregister(sender contract.ContractOption) bool {
 
 	return true
 }
+
+// Method is a contract method the node relies on, with the argument and
+// return types it expects. The ABI is loaded from CONTRACTS_CID at
+// runtime, so each one is resolved against it before use.
+type Method struct {
+	Name    string
+	Inputs  []string
+	Outputs []string
+}
+
+func (m Method) String() string {
+	return fmt.Sprintf("%s(%s)", m.Name, strings.Join(m.Inputs, ","))
+}
+
+var (
+	ClaimMethod    = Method{"claim", []string{}, nil}
+	RecordMethod   = Method{"nodes", []string{"address"}, nil}
+	RewardsMethod  = Method{"rewards", []string{"address"}, []string{"uint256"}}
+	TopUpMethod    = Method{"topUp", []string{}, nil}
+	WithdrawMethod = Method{"withdraw", []string{"uint256"}, nil}
+)
+
+func types(io []abi.AbiIO) []string {
+	t := make([]string, 0, len(io))
+	for _, p := range io {
+		t = append(t, p.Type)
+	}
+
+	return t
+}
+
+func sameTypes(got, want []string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Resolve checks the contract's ABI has m with the expected types. Nil
+// Outputs accepts any return values.
+func Resolve(name string, m Method) error {
+	ctr, ok := GetContract(name)
+	if !ok {
+		return fmt.Errorf("Could not load %s contract", name)
+	}
+
+	member, ok := ctr.Member(m.Name)
+	if !ok {
+		methods := make([]string, 0, len(ctr.Abi.Methods))
+		for _, method := range ctr.Abi.Methods {
+			methods = append(methods, method.Name)
+		}
+		sort.Strings(methods)
+
+		return fmt.Errorf("%s at %s has no %s method, it has %s", name, ctr.Address, m, strings.Join(methods, ", "))
+	}
+
+	if !sameTypes(types(member.Inputs), m.Inputs) {
+		return fmt.Errorf("%s.%s takes (%s), expected %s", name, m.Name, strings.Join(types(member.Inputs), ","), m)
+	}
+
+	if m.Outputs != nil && !sameTypes(types(member.Outputs), m.Outputs) {
+		return fmt.Errorf("%s.%s returns (%s), expected (%s)", name, m.Name, strings.Join(types(member.Outputs), ","), strings.Join(m.Outputs, ","))
+	}
+
+	return nil
+}
+
+func PendingRewards(address ethgo.Address) (*big.Int, error) {
+	if err := Resolve("BUINodeStaking", RewardsMethod); err != nil {
+		return nil, err
+	}
+
+	ctr, _ := GetContract("BUINodeStaking")
+	res, err := ctr.Call(RewardsMethod.Name, address)
+	if err != nil {
+		return nil, err
+	}
+
+	return res["0"].(*big.Int), nil
+}
+
+func Registration(address ethgo.Address) (map[string]interface{}, error) {
+	if err := Resolve("BUINodeStaking", RecordMethod); err != nil {
+		return nil, err
+	}
+
+	ctr, _ := GetContract("BUINodeStaking")
+	return ctr.Call(RecordMethod.Name, address)
+}
+
+func Transact(sender contract.ContractOption, method string, value *big.Int, args ...interface{}) (*ethgo.Receipt, error) {
+	ctr := ContractForSender("BUINodeStaking", sender)
+
+	txn, err := ctr.Txn(method, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	if value != nil {
+		txn.WithOpts(&contract.TxnOpts{
+			Value: value,
+		})
+	}
+
+	if err := txn.Do(); err != nil {
+		return nil, err
+	}
+
+	return txn.Wait()
+}
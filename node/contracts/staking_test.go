@@ -0,0 +1,49 @@
+package contracts
+
+import (
+	"strings"
+	"testing"
+
+	ethgoAbi "github.com/umbracle/ethgo/abi"
+)
+
+func TestResolve(t *testing.T) {
+	abi, err := ethgoAbi.NewABIFromList([]string{
+		"function register(bytes32 ip) payable",
+		"function topUp() payable",
+		"function withdraw(uint256 amount, address to)",
+		"function rewards(address node) view returns (uint256)",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contracts = Contracts{"BUINodeStaking": Contract{Abi: abi}}
+	defer func() { contracts = nil }()
+
+	tests := []struct {
+		method Method
+		err    string
+	}{
+		{TopUpMethod, ""},
+		{RewardsMethod, ""},
+		{ClaimMethod, "has no claim() method, it has register, rewards, topUp, withdraw"},
+		{WithdrawMethod, "takes (uint256,address), expected withdraw(uint256)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method.Name, func(t *testing.T) {
+			err := Resolve("BUINodeStaking", tt.method)
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("got %v, want no error", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got %v, want an error containing %q", err, tt.err)
+			}
+		})
+	}
+}
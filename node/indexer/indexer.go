@@ -0,0 +1,491 @@
+package indexer
+
+import (
+	"blocksui-node/config"
+	"blocksui-node/contracts"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/umbracle/ethgo"
+	ethgoAbi "github.com/umbracle/ethgo/abi"
+)
+
+const (
+	batchSize    = 2000
+	reorgDepth   = 64
+	pollInterval = 5 * time.Second
+)
+
+var contractNames = []string{"BUIBlockNFT", "BUILicenseNFT"}
+
+type Indexer struct {
+	contracts map[ethgo.Address]string
+	start     uint64
+	stale     time.Duration
+	store     *Store
+}
+
+var indexer *Indexer
+
+// Start loads the local ownership store and follows the NFT contracts in
+// the background. Lookups fall back to live calls until it has caught up.
+// Indexing starts at INDEXER_START_BLOCK, or where the first contract was
+// deployed so every token is seen from its mint.
+func Start(c *config.Config) error {
+	if indexer != nil {
+		return fmt.Errorf("Already initialized")
+	}
+
+	store, err := LoadStore(filepath.Join(c.HomeDir, ".bui", "index.json"))
+	if err != nil {
+		return err
+	}
+
+	ix := &Indexer{
+		contracts: make(map[ethgo.Address]string),
+		stale:     c.IndexerStale,
+		store:     store,
+	}
+
+	ix.start = c.IndexerStart
+	for i, name := range contractNames {
+		cnt, ok := contracts.GetContract(name)
+		if !ok {
+			return fmt.Errorf("Contract not found %s", name)
+		}
+		ix.contracts[cnt.Address] = name
+
+		if c.IndexerStart > 0 {
+			continue
+		}
+
+		deployed, err := contracts.DeploymentBlock(name)
+		if err != nil {
+			return err
+		}
+		if i == 0 || deployed < ix.start {
+			ix.start = deployed
+		}
+	}
+
+	if c.IndexerStart > 0 {
+		fmt.Printf("[indexer]\tINDEXER_START_BLOCK is set, tokens minted before block %d won't be indexed or catalogued\n", c.IndexerStart)
+	}
+
+	// A store started anywhere else may be missing tokens, so it is rebuilt
+	if store.Block == 0 || store.Start != ix.start {
+		fmt.Printf("[indexer]\tIndexing from block %d\n", ix.start)
+		store.Reset(ix.start)
+	}
+
+	indexer = ix
+	go ix.run()
+
+	return nil
+}
+
+// Owns only answers from the store when it is fresh. A false result means
+// the caller should fall back to a live call.
+func Owns(contract, cid string, address ethgo.Address) bool {
+	if indexer == nil || !indexer.store.Fresh(indexer.stale) {
+		return false
+	}
+
+	return indexer.store.Owns(contract, cid, address)
+}
+
+// Held returns the id of address's token of contract for cid, such as a
+// licence for a block, when the store is fresh.
+func Held(contract, cid string, address ethgo.Address) (uint64, bool) {
+	if indexer == nil || !indexer.store.Fresh(indexer.stale) {
+		return 0, false
+	}
+
+	id, ok := indexer.store.Held(contract, cid, address)
+	if !ok {
+		return 0, false
+	}
+
+	tokenId, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return tokenId, true
+}
+
+// GetToken returns an indexed token when the store is fresh.
+func GetToken(contract string, tokenId uint64) (Token, bool) {
+	if indexer == nil || !indexer.store.Fresh(indexer.stale) {
+		return Token{}, false
+	}
+
+	return indexer.store.Get(contract, fmt.Sprint(tokenId))
+}
+
+func TokenURI(contract string, tokenId uint64) (string, bool) {
+	if indexer == nil || !indexer.store.Fresh(indexer.stale) {
+		return "", false
+	}
+
+	return indexer.store.TokenURI(contract, fmt.Sprint(tokenId))
+}
+
+// TokenForCid answers from the store even when it is behind. A miss only
+// means the mint hasn't been indexed yet.
+func TokenForCid(contract, cid string) (uint64, bool) {
+	if indexer == nil {
+		return 0, false
+	}
+
+	id, ok := indexer.store.TokenForCid(contract, cid)
+	if !ok {
+		return 0, false
+	}
+
+	tokenId, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return tokenId, true
+}
+
+// FetchTokenURI looks the token's metadata URI up in the index, falling
+// back to a live call whose result is then indexed.
+func FetchTokenURI(contract string, tokenId uint64) (string, error) {
+	if uri, ok := TokenURI(contract, tokenId); ok {
+		return uri, nil
+	}
+
+	cnt, ok := contracts.GetContract(contract)
+	if !ok {
+		return "", fmt.Errorf("Failed to fetch contract")
+	}
+
+	result, err := cnt.Call("tokenURI", tokenId)
+	if err != nil {
+		return "", fmt.Errorf("Failed to fetch TokenURI")
+	}
+
+	uri := result["0"].(string)
+	SetTokenURI(contract, tokenId, uri)
+
+	return uri, nil
+}
+
+// Tokens copies every indexed token of contract, keyed by token id, along
+// with the last indexed block. The copy may be behind the chain.
+func Tokens(contract string) (map[string]Token, uint64) {
+	if indexer == nil {
+		return nil, 0
+	}
+
+	indexer.store.mu.RLock()
+	block := indexer.store.Block
+	indexer.store.mu.RUnlock()
+
+	return indexer.store.Snapshot(contract), block
+}
+
+// FirstBlock is the block indexing started at, or 0 without an indexer.
+func FirstBlock() uint64 {
+	if indexer == nil {
+		return 0
+	}
+
+	return indexer.start
+}
+
+// Flush saves the store now, for a shutdown.
+func Flush() error {
+	if indexer == nil {
+		return nil
+	}
+
+	return indexer.store.Save()
+}
+
+// Block is the last block the store has indexed, or 0 without an indexer.
+func Block() uint64 {
+	if indexer == nil {
+		return 0
+	}
+
+	indexer.store.mu.RLock()
+	defer indexer.store.mu.RUnlock()
+
+	return indexer.store.Block
+}
+
+// FindToken scans contract's logs from block from to the head for the
+// token minted for cid. It reads the chain directly, so it also finds
+// mints the store missed, and adds them to it.
+func FindToken(contract, cid string, from uint64) (uint64, bool, error) {
+	cnt, ok := contracts.GetContract(contract)
+	if !ok {
+		return 0, false, fmt.Errorf("Contract not found %s", contract)
+	}
+
+	eth := contracts.Eth()
+	head, err := eth.BlockNumber()
+	if err != nil {
+		return 0, false, err
+	}
+
+	cid = strings.ToLower(cid)
+	for ; from <= head; from += batchSize {
+		to := from + batchSize - 1
+		if to > head {
+			to = head
+		}
+
+		filter := &ethgo.LogFilter{Address: []ethgo.Address{cnt.Address}}
+		filter.SetFromUint64(from)
+		filter.SetToUint64(to)
+
+		logs, err := eth.GetLogs(filter)
+		if err != nil {
+			return 0, false, err
+		}
+
+		for _, log := range logs {
+			for _, event := range cnt.Abi.Events {
+				if !event.Match(log) {
+					continue
+				}
+
+				values, err := event.ParseLog(log)
+				if err != nil {
+					return 0, false, err
+				}
+
+				tokenId, logCid, _, _ := eventFields(event, values)
+				if tokenId == "" || logCid != cid {
+					continue
+				}
+
+				id, err := strconv.ParseUint(tokenId, 10, 64)
+				if err != nil {
+					return 0, false, err
+				}
+
+				if indexer != nil {
+					indexer.store.SetCid(contract, tokenId, cid, log.BlockNumber)
+				}
+
+				return id, true, nil
+			}
+		}
+	}
+
+	return 0, false, nil
+}
+
+func SetTokenURI(contract string, tokenId uint64, uri string) {
+	if indexer != nil {
+		indexer.store.SetTokenURI(contract, fmt.Sprint(tokenId), uri, 0)
+	}
+}
+
+func (ix *Indexer) run() {
+	for {
+		if err := ix.sync(); err != nil {
+			fmt.Printf("[indexer]\t%v\n", err)
+		}
+
+		time.Sleep(pollInterval)
+	}
+}
+
+func (ix *Indexer) sync() error {
+	eth := contracts.Eth()
+
+	if err := ix.checkReorg(); err != nil {
+		return err
+	}
+
+	head, err := eth.BlockNumber()
+	if err != nil {
+		return err
+	}
+
+	addresses := make([]ethgo.Address, 0, len(ix.contracts))
+	for addr := range ix.contracts {
+		addresses = append(addresses, addr)
+	}
+
+	from := ix.store.Block + 1
+	to := ix.store.Block
+	saved := time.Now()
+
+	for from <= head {
+		to = from + batchSize - 1
+		if to > head {
+			to = head
+		}
+
+		filter := &ethgo.LogFilter{Address: addresses}
+		filter.SetFromUint64(from)
+		filter.SetToUint64(to)
+
+		logs, err := eth.GetLogs(filter)
+		if err != nil {
+			return err
+		}
+
+		for _, log := range logs {
+			if err := ix.handle(log); err != nil {
+				fmt.Printf("[indexer]\t%v\n", err)
+			}
+		}
+
+		from = to + 1
+
+		// Keep the progress of a long catch-up across restarts
+		if from <= head && time.Since(saved) > time.Minute {
+			block, err := eth.GetBlockByNumber(ethgo.BlockNumber(to), false)
+			if err != nil {
+				return err
+			}
+
+			ix.store.Progress(to, block.Hash, reorgDepth)
+			if err := ix.store.Save(); err != nil {
+				return err
+			}
+			saved = time.Now()
+		}
+	}
+
+	block, err := eth.GetBlockByNumber(ethgo.BlockNumber(to), false)
+	if err != nil {
+		return err
+	}
+
+	ix.store.Synced(to, block.Hash, reorgDepth)
+
+	return ix.store.Save()
+}
+
+// checkReorg walks back through the recorded block hashes until one still
+// matches the chain and rewinds the store to it.
+func (ix *Indexer) checkReorg() error {
+	ix.store.mu.RLock()
+	numbers := make([]uint64, 0, len(ix.store.Hashes))
+	for n := range ix.store.Hashes {
+		numbers = append(numbers, n)
+	}
+	ix.store.mu.RUnlock()
+
+	if len(numbers) == 0 {
+		return nil
+	}
+
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] > numbers[j] })
+
+	for _, n := range numbers {
+		block, err := contracts.Eth().GetBlockByNumber(ethgo.BlockNumber(n), false)
+		if err != nil {
+			return err
+		}
+
+		ix.store.mu.RLock()
+		hash := ix.store.Hashes[n]
+		ix.store.mu.RUnlock()
+
+		if block != nil && block.Hash == hash {
+			if n != ix.store.Block {
+				fmt.Printf("[indexer]\tReorg detected, rewinding to block %d\n", n)
+				ix.store.Rewind(n)
+			}
+
+			return nil
+		}
+	}
+
+	rewind := uint64(0)
+	if numbers[len(numbers)-1] > reorgDepth {
+		rewind = numbers[len(numbers)-1] - reorgDepth
+	}
+
+	fmt.Printf("[indexer]\tReorg deeper than recorded hashes, rewinding to block %d\n", rewind)
+	ix.store.Rewind(rewind)
+
+	return nil
+}
+
+func (ix *Indexer) handle(log *ethgo.Log) error {
+	name, ok := ix.contracts[log.Address]
+	if !ok {
+		return nil
+	}
+
+	cnt, ok := contracts.GetContract(name)
+	if !ok {
+		return fmt.Errorf("Contract not found %s", name)
+	}
+
+	for _, event := range cnt.Abi.Events {
+		if !event.Match(log) {
+			continue
+		}
+
+		values, err := event.ParseLog(log)
+		if err != nil {
+			return err
+		}
+
+		tokenId, cid, from, to := eventFields(event, values)
+		if tokenId == "" {
+			return nil
+		}
+
+		if event.Name == "Transfer" {
+			ix.store.SetOwner(name, tokenId, from, to, log.BlockNumber)
+		} else {
+			// Any other token event may have changed the metadata
+			ix.store.SetTokenURI(name, tokenId, "", log.BlockNumber)
+		}
+
+		if cid != "" {
+			ix.store.SetCid(name, tokenId, cid, log.BlockNumber)
+		}
+
+		return nil
+	}
+
+	return nil
+}
+
+// eventFields picks the token id, block CID, sender and recipient out of a
+// decoded event. The mint and licence events differ between contract
+// versions so they are matched by type rather than by name.
+func eventFields(event *ethgoAbi.Event, values map[string]interface{}) (tokenId, cid string, from, to ethgo.Address) {
+	for _, elem := range event.Inputs.TupleElems() {
+		switch v := values[elem.Name].(type) {
+		case *big.Int:
+			if tokenId == "" {
+				tokenId = v.String()
+			}
+		case [32]byte:
+			if cid == "" {
+				cid = "0x" + hex.EncodeToString(v[:])
+			}
+		case ethgo.Address:
+			switch elem.Name {
+			case "from":
+				from = v
+			case "to":
+				to = v
+			}
+		}
+	}
+
+	return
+}
@@ -0,0 +1,403 @@
+package indexer
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/umbracle/ethgo"
+)
+
+type Owner struct {
+	Address ethgo.Address `json:"address"`
+	Block   uint64        `json:"block"`
+}
+
+// Creator is the address the token was minted to, from its Transfer from
+// the zero address. CidBlock and URIBlock are the blocks Cid and
+// TokenURI last changed at, so a reorg can undo them.
+type Token struct {
+	Cid      string        `json:"cid,omitempty"`
+	CidBlock uint64        `json:"cidBlock,omitempty"`
+	TokenURI string        `json:"tokenURI,omitempty"`
+	URIBlock uint64        `json:"uriBlock,omitempty"`
+	Creator  ethgo.Address `json:"creator"`
+	Owners   []Owner       `json:"owners"`
+}
+
+// Owner returns the current owner. Earlier entries are kept only as far
+// back as a reorg could reach so ownership can be rewound.
+func (t *Token) Owner() ethgo.Address {
+	if len(t.Owners) == 0 {
+		return ethgo.ZeroAddress
+	}
+
+	return t.Owners[len(t.Owners)-1].Address
+}
+
+// Store is the index. Start is the block indexing began at, so a store
+// started later than the contracts were deployed can be told apart.
+type Store struct {
+	Start     uint64                       `json:"start"`
+	Block     uint64                       `json:"block"`
+	Hashes    map[uint64]ethgo.Hash        `json:"hashes"`
+	Tokens    map[string]map[string]*Token `json:"tokens"`
+	UpdatedAt time.Time                    `json:"updatedAt"`
+
+	path   string
+	mu     sync.RWMutex
+	dirty  bool
+	saving sync.Mutex
+	// Token ids by contract and CID, so lookups by CID don't scan
+	cids map[string]map[string][]string
+}
+
+func LoadStore(path string) (*Store, error) {
+	s := &Store{
+		Hashes: make(map[uint64]ethgo.Hash),
+		Tokens: make(map[string]map[string]*Token),
+		path:   path,
+		cids:   make(map[string]map[string][]string),
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+
+	for contract, tokens := range s.Tokens {
+		for id, t := range tokens {
+			s.index(contract, id, "", t.Cid)
+		}
+	}
+
+	return s, nil
+}
+
+// Reset empties the store so indexing starts over at block start.
+func (s *Store) Reset(start uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Start = start
+	s.Block = 0
+	if start > 0 {
+		s.Block = start - 1
+	}
+	s.Hashes = make(map[uint64]ethgo.Hash)
+	s.Tokens = make(map[string]map[string]*Token)
+	s.UpdatedAt = time.Time{}
+	s.cids = make(map[string]map[string][]string)
+	s.dirty = true
+}
+
+// index moves tokenId from the old CID's entry to the new one's.
+func (s *Store) index(contract, tokenId, old, cid string) {
+	if old == cid {
+		return
+	}
+
+	byCid, ok := s.cids[contract]
+	if !ok {
+		byCid = make(map[string][]string)
+		s.cids[contract] = byCid
+	}
+
+	if old != "" {
+		ids := byCid[old]
+		for i, id := range ids {
+			if id == tokenId {
+				ids = append(ids[:i:i], ids[i+1:]...)
+				break
+			}
+		}
+		if len(ids) == 0 {
+			delete(byCid, old)
+		} else {
+			byCid[old] = ids
+		}
+	}
+
+	if cid != "" {
+		byCid[cid] = append(byCid[cid], tokenId)
+	}
+}
+
+// Save writes the store if anything changed since the last save.
+func (s *Store) Save() error {
+	s.saving.Lock()
+	defer s.saving.Unlock()
+
+	s.mu.Lock()
+	if !s.dirty {
+		s.mu.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(s)
+	s.dirty = err != nil
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := s.write(data); err != nil {
+		s.mu.Lock()
+		s.dirty = true
+		s.mu.Unlock()
+		return err
+	}
+
+	return nil
+}
+
+func (s *Store) write(data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.path)
+}
+
+func (s *Store) token(contract, tokenId string) *Token {
+	tokens, ok := s.Tokens[contract]
+	if !ok {
+		tokens = make(map[string]*Token)
+		s.Tokens[contract] = tokens
+	}
+
+	t, ok := tokens[tokenId]
+	if !ok {
+		t = &Token{}
+		tokens[tokenId] = t
+	}
+
+	return t
+}
+
+// SetOwner records a transfer of the token from from to owner. A transfer
+// from the zero address is the mint.
+func (s *Store) SetOwner(contract, tokenId string, from, owner ethgo.Address, block uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := s.token(contract, tokenId)
+	if from == ethgo.ZeroAddress {
+		t.Creator = owner
+	}
+	t.Owners = append(t.Owners, Owner{owner, block})
+	s.dirty = true
+}
+
+func (s *Store) SetCid(contract, tokenId, cid string, block uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := s.token(contract, tokenId)
+	cid = strings.ToLower(cid)
+	s.index(contract, tokenId, t.Cid, cid)
+	t.Cid = cid
+	t.CidBlock = block
+	s.dirty = true
+}
+
+// SetTokenURI records the token's URI as of block. URIs read live are
+// newer than anything indexed and are recorded at the block after it.
+func (s *Store) SetTokenURI(contract, tokenId, uri string, block uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if block == 0 {
+		block = s.Block + 1
+	}
+
+	t := s.token(contract, tokenId)
+	if t.TokenURI == uri && t.URIBlock >= block {
+		return
+	}
+
+	t.TokenURI = uri
+	t.URIBlock = block
+	s.dirty = true
+}
+
+func (s *Store) TokenURI(contract, tokenId string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if t, ok := s.Tokens[contract][tokenId]; ok && t.TokenURI != "" {
+		return t.TokenURI, true
+	}
+
+	return "", false
+}
+
+// TokenForCid returns the id of the token of contract minted for cid.
+func (s *Store) TokenForCid(contract, cid string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ids := s.cids[contract][strings.ToLower(cid)]
+	if len(ids) == 0 {
+		return "", false
+	}
+
+	return ids[0], true
+}
+
+func (s *Store) Get(contract, tokenId string) (Token, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t, ok := s.Tokens[contract][tokenId]
+	if !ok {
+		return Token{}, false
+	}
+
+	c := *t
+	c.Owners = append([]Owner(nil), t.Owners...)
+
+	return c, true
+}
+
+// Snapshot copies the tokens of contract.
+func (s *Store) Snapshot(contract string) map[string]Token {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tokens := make(map[string]Token, len(s.Tokens[contract]))
+	for id, t := range s.Tokens[contract] {
+		c := *t
+		c.Owners = append([]Owner(nil), t.Owners...)
+		tokens[id] = c
+	}
+
+	return tokens
+}
+
+// Owns reports whether address holds a token of contract minted for cid.
+func (s *Store) Owns(contract, cid string, address ethgo.Address) bool {
+	_, ok := s.Held(contract, cid, address)
+	return ok
+}
+
+// Held returns the id of a token of contract minted for cid that address
+// holds.
+func (s *Store) Held(contract, cid string, address ethgo.Address) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, id := range s.cids[contract][strings.ToLower(cid)] {
+		if s.Tokens[contract][id].Owner() == address {
+			return id, true
+		}
+	}
+
+	return "", false
+}
+
+// Synced records that the store has caught up with the chain at block.
+func (s *Store) Synced(block uint64, hash ethgo.Hash, depth uint64) {
+	s.Progress(block, hash, depth)
+
+	s.mu.Lock()
+	s.UpdatedAt = time.Now()
+	s.mu.Unlock()
+}
+
+// Progress records that everything up to block is indexed, without
+// marking the store fresh.
+func (s *Store) Progress(block uint64, hash ethgo.Hash, depth uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Block != block || s.Hashes[block] != hash {
+		s.dirty = true
+	}
+
+	s.Block = block
+	s.Hashes[block] = hash
+
+	for n := range s.Hashes {
+		if n+depth < block {
+			delete(s.Hashes, n)
+		}
+	}
+
+	// Only the newest owner at or below the finalized block is needed.
+	for _, tokens := range s.Tokens {
+		for _, t := range tokens {
+			keep := 0
+			for i, o := range t.Owners {
+				if o.Block+depth < block {
+					keep = i
+				}
+			}
+			if keep > 0 {
+				t.Owners = t.Owners[keep:]
+				s.dirty = true
+			}
+		}
+	}
+}
+
+// Rewind drops everything indexed after block. A CID or URI set after it
+// is cleared, leaving the URI to be read live again.
+func (s *Store) Rewind(block uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for n := range s.Hashes {
+		if n > block {
+			delete(s.Hashes, n)
+		}
+	}
+
+	for contract, tokens := range s.Tokens {
+		for id, t := range tokens {
+			i := len(t.Owners)
+			for i > 0 && t.Owners[i-1].Block > block {
+				i--
+			}
+			t.Owners = t.Owners[:i]
+
+			if t.CidBlock > block {
+				s.index(contract, id, t.Cid, "")
+				t.Cid = ""
+				t.CidBlock = 0
+			}
+			if t.URIBlock > block {
+				t.TokenURI = ""
+				t.URIBlock = 0
+			}
+
+			if len(t.Owners) == 0 {
+				s.index(contract, id, t.Cid, "")
+				delete(tokens, id)
+			}
+		}
+	}
+
+	s.Block = block
+	s.dirty = true
+}
+
+func (s *Store) Fresh(stale time.Duration) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return !s.UpdatedAt.IsZero() && time.Since(s.UpdatedAt) <= stale
+}
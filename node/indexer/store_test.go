@@ -0,0 +1,156 @@
+package indexer
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/umbracle/ethgo"
+)
+
+var (
+	alice = ethgo.HexToAddress("0x00000000000000000000000000000000000000a1")
+	bob   = ethgo.HexToAddress("0x00000000000000000000000000000000000000b2")
+)
+
+func newStore(t *testing.T) *Store {
+	s, err := LoadStore(filepath.Join(t.TempDir(), "index.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+func TestRewind(t *testing.T) {
+	s := newStore(t)
+
+	s.SetOwner("BUIBlockNFT", "1", ethgo.ZeroAddress, alice, 10)
+	s.SetCid("BUIBlockNFT", "1", "0xAA", 10)
+	s.SetTokenURI("BUIBlockNFT", "1", "ipfs://one", 10)
+	s.SetOwner("BUIBlockNFT", "1", alice, bob, 20)
+	s.SetTokenURI("BUIBlockNFT", "1", "ipfs://two", 20)
+	s.SetOwner("BUIBlockNFT", "2", ethgo.ZeroAddress, bob, 30)
+	s.SetCid("BUIBlockNFT", "2", "0xbb", 30)
+
+	s.Rewind(15)
+
+	tests := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{"owner", s.Tokens["BUIBlockNFT"]["1"].Owner(), alice},
+		{"creator", s.Tokens["BUIBlockNFT"]["1"].Creator, alice},
+		{"uri", s.Tokens["BUIBlockNFT"]["1"].TokenURI, ""},
+		{"cid", s.Tokens["BUIBlockNFT"]["1"].Cid, "0xaa"},
+		{"later mint", len(s.Tokens["BUIBlockNFT"]), 1},
+		{"block", s.Block, uint64(15)},
+		{"owns", s.Owns("BUIBlockNFT", "0xaa", alice), true},
+		{"owned before", s.Owns("BUIBlockNFT", "0xaa", bob), false},
+		{"later cid", s.Owns("BUIBlockNFT", "0xbb", bob), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("got %v, want %v", tt.got, tt.want)
+			}
+		})
+	}
+
+	if _, ok := s.TokenForCid("BUIBlockNFT", "0xbb"); ok {
+		t.Error("got a token for a rewound mint, want none")
+	}
+}
+
+func TestCreator(t *testing.T) {
+	s := newStore(t)
+
+	s.SetOwner("BUIBlockNFT", "1", ethgo.ZeroAddress, alice, 1)
+	s.SetOwner("BUIBlockNFT", "1", alice, bob, 2)
+	// Indexed from after its mint
+	s.SetOwner("BUIBlockNFT", "2", alice, bob, 3)
+
+	tests := []struct {
+		tokenId string
+		want    ethgo.Address
+	}{
+		{"1", alice},
+		{"2", ethgo.ZeroAddress},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tokenId, func(t *testing.T) {
+			if got := s.Tokens["BUIBlockNFT"][tt.tokenId].Creator; got != tt.want {
+				t.Errorf("got creator %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenForCid(t *testing.T) {
+	s := newStore(t)
+
+	s.SetOwner("BUILicenseNFT", "7", ethgo.ZeroAddress, alice, 1)
+	s.SetCid("BUILicenseNFT", "7", "0xAA", 1)
+	s.SetOwner("BUILicenseNFT", "8", ethgo.ZeroAddress, bob, 2)
+	s.SetCid("BUILicenseNFT", "8", "0xaa", 2)
+	s.SetOwner("BUIBlockNFT", "1", ethgo.ZeroAddress, alice, 3)
+	s.SetCid("BUIBlockNFT", "1", "0xaa", 3)
+	// A token can only be minted for one CID
+	s.SetCid("BUIBlockNFT", "1", "0xcc", 4)
+
+	tests := []struct {
+		contract string
+		cid      string
+		want     string
+		ok       bool
+	}{
+		{"BUILicenseNFT", "0xaa", "7", true},
+		{"BUILicenseNFT", "0xAA", "7", true},
+		{"BUIBlockNFT", "0xaa", "", false},
+		{"BUIBlockNFT", "0xcc", "1", true},
+		{"BUIBlockNFT", "0xdd", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.contract+" "+tt.cid, func(t *testing.T) {
+			got, ok := s.TokenForCid(tt.contract, tt.cid)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("got %q %v, want %q %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+
+	// Every licence for a block counts, not just the first
+	if id, ok := s.Held("BUILicenseNFT", "0xaa", bob); id != "8" || !ok {
+		t.Errorf("got %q %v for the second licence holder, want \"8\" true", id, ok)
+	}
+}
+
+func TestLoadStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.json")
+
+	s, err := LoadStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Reset(100)
+	s.SetOwner("BUIBlockNFT", "1", ethgo.ZeroAddress, alice, 120)
+	s.SetCid("BUIBlockNFT", "1", "0xaa", 120)
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.Start != 100 || loaded.Block != 99 {
+		t.Errorf("got start %d block %d, want 100 and 99", loaded.Start, loaded.Block)
+	}
+	if !loaded.Owns("BUIBlockNFT", "0xaa", alice) {
+		t.Error("got false after a reload, want the CID index rebuilt")
+	}
+}
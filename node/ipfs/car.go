@@ -0,0 +1,127 @@
+package ipfs
+
+import (
+	"context"
+	"io"
+
+	blocks "github.com/ipfs/go-block-format"
+	goCid "github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/ipld/go-car"
+)
+
+// WriteCar streams the DAGs under roots from the store as a single CAR.
+// Blocks shared between roots are only written once.
+func WriteCar(ctx context.Context, store BlockStore, roots []string, w io.Writer) error {
+	cids := make([]goCid.Cid, len(roots))
+	for i, root := range roots {
+		c, err := goCid.Parse(root)
+		if err != nil {
+			return err
+		}
+		cids[i] = c
+	}
+
+	return car.WriteCar(ctx, &nodeGetter{store}, cids, w)
+}
+
+// readCar puts every block of a CAR into bs after checking it against its
+// CID. A CAR is only as trustworthy as where it came from.
+func readCar(ctx context.Context, r io.Reader, bs car.Store) ([]goCid.Cid, error) {
+	cr, err := car.NewCarReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		b, err := cr.Next()
+		if err == io.EOF {
+			return cr.Header.Roots, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		vb, err := verify(b.Cid(), b.RawData())
+		if err != nil {
+			return nil, err
+		}
+
+		if err := bs.Put(ctx, vb); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func cidStrings(cids []goCid.Cid) []string {
+	out := make([]string, len(cids))
+	for i, c := range cids {
+		out[i] = c.String()
+	}
+
+	return out
+}
+
+// nodeGetter decodes blocks from any BlockStore so go-car can walk them.
+type nodeGetter struct {
+	store BlockStore
+}
+
+func (n *nodeGetter) Get(ctx context.Context, c goCid.Cid) (ipld.Node, error) {
+	b, err := n.store.GetBlock(ctx, c.String())
+	if err != nil {
+		return nil, err
+	}
+
+	return ipld.Decode(b)
+}
+
+func (n *nodeGetter) GetMany(ctx context.Context, cids []goCid.Cid) <-chan *ipld.NodeOption {
+	out := make(chan *ipld.NodeOption, len(cids))
+
+	go func() {
+		defer close(out)
+		for _, c := range cids {
+			node, err := n.Get(ctx, c)
+			out <- &ipld.NodeOption{Node: node, Err: err}
+		}
+	}()
+
+	return out
+}
+
+func blockOf(c string, data []byte) (blocks.Block, error) {
+	cid, err := goCid.Parse(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return verify(cid, data)
+}
+
+// ReadFiles copies the directory DAG at cid out of the store in one pass
+// and returns every file in it keyed by its path, such as blocks/Button.js.
+func ReadFiles(ctx context.Context, store BlockStore, cid string) (map[string][]byte, error) {
+	mem := NewMemStore()
+
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	go func() {
+		pw.CloseWithError(WriteCar(ctx, store, []string{cid}, pw))
+	}()
+
+	if _, err := mem.PutCar(ctx, pr); err != nil {
+		return nil, err
+	}
+
+	root, err := mem.resolve(ctx, cid)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string][]byte)
+	if err := mem.readTree(ctx, root, "", files); err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
@@ -2,29 +2,127 @@ package ipfs
 
 import (
 	"encoding/hex"
+	"fmt"
+	"strings"
 
+	goCid "github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multibase"
 	"github.com/multiformats/go-multihash"
 )
 
-func CidToBytes32(cid string) string {
-	mh, err := multihash.FromB58String(cid)
+// The contracts store a CID as bytes32, which only has room for the hash
+// digest. These are the codecs and hash functions whose CIDs fit: every
+// hash listed produces a 32 byte digest.
+var (
+	Bytes32Codecs = map[uint64]string{
+		goCid.DagProtobuf: "dag-pb",
+		goCid.Raw:         "raw",
+	}
+	Bytes32Hashes = map[uint64]string{
+		multihash.SHA2_256:         "sha2-256",
+		multihash.SHA3_256:         "sha3-256",
+		multihash.KECCAK_256:       "keccak-256",
+		multihash.BLAKE2B_MIN + 31: "blake2b-256",
+		multihash.BLAKE3:           "blake3",
+	}
+)
+
+// CidHint is everything about a CID that isn't in its bytes32 digest. It
+// travels in the block metadata so the round trip is lossless. Without a
+// hint a digest is read as a CIDv0.
+type CidHint struct {
+	Version uint64 `json:"version"`
+	Codec   uint64 `json:"codec"`
+	Hash    uint64 `json:"hash"`
+	Base    int    `json:"base,omitempty"`
+}
+
+func CidToBytes32(cid string) (string, *CidHint, error) {
+	c, err := goCid.Decode(cid)
 	if err != nil {
-		panic(err)
+		return "", nil, err
+	}
+
+	prefix := c.Prefix()
+	if _, ok := Bytes32Codecs[prefix.Codec]; !ok {
+		return "", nil, fmt.Errorf("CID codec 0x%x does not fit in bytes32", prefix.Codec)
 	}
 
-	dmh, err := multihash.Decode(mh)
+	if _, ok := Bytes32Hashes[prefix.MhType]; !ok {
+		return "", nil, fmt.Errorf("CID hash 0x%x does not fit in bytes32", prefix.MhType)
+	}
+
+	dmh, err := multihash.Decode(c.Hash())
 	if err != nil {
-		panic(err)
+		return "", nil, err
+	}
+
+	if len(dmh.Digest) != 32 {
+		return "", nil, fmt.Errorf("CID digest is %d bytes, expected 32", len(dmh.Digest))
+	}
+
+	hint := &CidHint{
+		Version: prefix.Version,
+		Codec:   prefix.Codec,
+		Hash:    prefix.MhType,
+	}
+
+	if prefix.Version == 1 {
+		base, err := goCid.ExtractEncoding(cid)
+		if err != nil {
+			return "", nil, err
+		}
+
+		if base != multibase.Base32 {
+			hint.Base = int(base)
+		}
 	}
 
-	return "0x" + hex.EncodeToString(dmh.Digest)
+	return "0x" + hex.EncodeToString(dmh.Digest), hint, nil
 }
 
-func Bytes32ToCid(b32 string) string {
-	mh, err := multihash.FromHexString("1220" + b32[2:])
+func Bytes32ToCid(b32 string, hint *CidHint) (string, error) {
+	digest, err := hex.DecodeString(strings.TrimPrefix(b32, "0x"))
 	if err != nil {
-		panic(err)
+		return "", err
+	}
+
+	if len(digest) != 32 {
+		return "", fmt.Errorf("Expected 32 bytes, got %d", len(digest))
+	}
+
+	if hint == nil {
+		hint = &CidHint{Version: 0, Codec: goCid.DagProtobuf, Hash: multihash.SHA2_256}
+	}
+
+	if _, ok := Bytes32Hashes[hint.Hash]; !ok {
+		return "", fmt.Errorf("Unsupported hash 0x%x", hint.Hash)
 	}
 
-	return mh.B58String()
+	mh, err := multihash.Encode(digest, hint.Hash)
+	if err != nil {
+		return "", err
+	}
+
+	switch hint.Version {
+	case 0:
+		if hint.Codec != goCid.DagProtobuf || hint.Hash != multihash.SHA2_256 {
+			return "", fmt.Errorf("CIDv0 must be dag-pb with sha2-256")
+		}
+
+		return goCid.NewCidV0(mh).String(), nil
+	case 1:
+		if _, ok := Bytes32Codecs[hint.Codec]; !ok {
+			return "", fmt.Errorf("Unsupported codec 0x%x", hint.Codec)
+		}
+
+		c := goCid.NewCidV1(hint.Codec, mh)
+		if hint.Base != 0 {
+			return c.StringOfBase(multibase.Encoding(hint.Base))
+		}
+
+		return c.String(), nil
+	default:
+		return "", fmt.Errorf("Unsupported CID version %d", hint.Version)
+	}
 }
@@ -0,0 +1,124 @@
+package ipfs
+
+import (
+	"strings"
+	"testing"
+
+	goCid "github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multibase"
+	"github.com/multiformats/go-multihash"
+)
+
+func testCid(t *testing.T, version, codec, hash uint64, base multibase.Encoding) string {
+	mh, err := multihash.Sum([]byte("blocks ui"), hash, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if version == 0 {
+		return goCid.NewCidV0(mh).String()
+	}
+
+	s, err := goCid.NewCidV1(codec, mh).StringOfBase(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+func TestCidBytes32RoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		version uint64
+		codec   uint64
+		hash    uint64
+		base    multibase.Encoding
+		hinted  bool
+	}{
+		{"v0", 0, goCid.DagProtobuf, multihash.SHA2_256, multibase.Base58BTC, false},
+		{"v1 dag-pb", 1, goCid.DagProtobuf, multihash.SHA2_256, multibase.Base32, true},
+		{"v1 raw", 1, goCid.Raw, multihash.SHA2_256, multibase.Base32, true},
+		{"v1 base58", 1, goCid.Raw, multihash.SHA2_256, multibase.Base58BTC, true},
+		{"v1 base36", 1, goCid.DagProtobuf, multihash.SHA2_256, multibase.Base36, true},
+		{"sha3-256", 1, goCid.Raw, multihash.SHA3_256, multibase.Base32, true},
+		{"keccak-256", 1, goCid.Raw, multihash.KECCAK_256, multibase.Base32, true},
+		{"blake2b-256", 1, goCid.Raw, multihash.BLAKE2B_MIN + 31, multibase.Base32, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cid := testCid(t, tt.version, tt.codec, tt.hash, tt.base)
+
+			b32, hint, err := CidToBytes32(cid)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(b32) != 66 {
+				t.Fatalf("bytes32 %s is %d characters, want 66", b32, len(b32))
+			}
+
+			got, err := Bytes32ToCid(b32, hint)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != cid {
+				t.Errorf("round trip gave %s, want %s", got, cid)
+			}
+
+			// Without the hint a digest is read as a CIDv0
+			got, err = Bytes32ToCid(b32, nil)
+			if tt.hinted {
+				if got == cid {
+					t.Errorf("%s round tripped without its hint", cid)
+				}
+			} else if err != nil || got != cid {
+				t.Errorf("without a hint got %s, %v, want %s", got, err, cid)
+			}
+		})
+	}
+}
+
+func TestCidToBytes32Rejects(t *testing.T) {
+	tests := []struct {
+		name string
+		cid  string
+	}{
+		{"not a CID", "bafy-not-a-cid"},
+		{"dag-cbor", testCid(t, 1, goCid.DagCBOR, multihash.SHA2_256, multibase.Base32)},
+		{"sha2-512", testCid(t, 1, goCid.Raw, multihash.SHA2_512, multibase.Base32)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if b32, _, err := CidToBytes32(tt.cid); err == nil {
+				t.Errorf("got %s, want an error", b32)
+			}
+		})
+	}
+}
+
+func TestBytes32ToCidRejects(t *testing.T) {
+	digest := "0x" + strings.Repeat("ab", 32)
+
+	tests := []struct {
+		name string
+		b32  string
+		hint *CidHint
+	}{
+		{"short", "0xabcd", nil},
+		{"not hex", "0x" + strings.Repeat("zz", 32), nil},
+		{"v0 raw", digest, &CidHint{Version: 0, Codec: goCid.Raw, Hash: multihash.SHA2_256}},
+		{"unknown hash", digest, &CidHint{Version: 1, Codec: goCid.Raw, Hash: multihash.SHA2_512}},
+		{"unknown codec", digest, &CidHint{Version: 1, Codec: goCid.DagCBOR, Hash: multihash.SHA2_256}},
+		{"unknown version", digest, &CidHint{Version: 2, Codec: goCid.Raw, Hash: multihash.SHA2_256}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if cid, err := Bytes32ToCid(tt.b32, tt.hint); err == nil {
+				t.Errorf("got %s, want an error", cid)
+			}
+		})
+	}
+}
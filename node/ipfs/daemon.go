@@ -0,0 +1,313 @@
+package ipfs
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+
+	sh "github.com/ipfs/go-ipfs-api"
+)
+
+const (
+	DaemonStopped     = "stopped"
+	DaemonStarting    = "starting"
+	DaemonRunning     = "running"
+	DaemonAttached    = "attached"
+	DaemonRestarting  = "restarting"
+	DaemonUnreachable = "unreachable"
+
+	readyTimeout = 2 * time.Minute
+	stopTimeout  = 30 * time.Second
+	minBackoff   = time.Second
+	maxBackoff   = time.Minute
+)
+
+type DaemonStatus struct {
+	State     string    `json:"state"`
+	Pid       int       `json:"pid,omitempty"`
+	Restarts  int       `json:"restarts"`
+	StartedAt time.Time `json:"startedAt,omitempty"`
+	LastError string    `json:"lastError,omitempty"`
+}
+
+// Supervisor runs `ipfs daemon` for the node, or attaches to one that is
+// already serving the API, and restarts it with backoff if it exits.
+type Supervisor struct {
+	shell *sh.Shell
+
+	mu       sync.Mutex
+	status   DaemonStatus
+	cmd      *exec.Cmd
+	stopping bool
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func NewSupervisor(api string) *Supervisor {
+	return &Supervisor{
+		shell:  sh.NewShell(api),
+		status: DaemonStatus{State: DaemonStopped},
+	}
+}
+
+// Status pings an attached daemon since nothing else watches it.
+func (s *Supervisor) Status() DaemonStatus {
+	s.mu.Lock()
+	status := s.status
+	s.mu.Unlock()
+
+	if status.State == DaemonAttached {
+		if _, err := s.shell.ID(); err != nil {
+			status.State = DaemonUnreachable
+			status.LastError = err.Error()
+		}
+	}
+
+	return status
+}
+
+func (s *Supervisor) Ready() bool {
+	state := s.Status().State
+	return state == DaemonRunning || state == DaemonAttached
+}
+
+func (s *Supervisor) setState(state string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.status.State = state
+	if err != nil {
+		s.status.LastError = err.Error()
+	}
+}
+
+// Start returns once the API answers, either from an existing daemon or
+// from one it launched.
+func (s *Supervisor) Start() error {
+	if _, err := s.shell.ID(); err == nil {
+		fmt.Println("[ipfs]\tAttached to a running node.")
+		s.setState(DaemonAttached, nil)
+		return nil
+	}
+
+	fmt.Println("[ipfs]\tIPFS not found. Starting a new node.")
+
+	s.mu.Lock()
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	s.mu.Unlock()
+
+	exited, err := s.launch()
+	if err != nil {
+		s.setState(DaemonStopped, err)
+		close(s.done)
+		return err
+	}
+
+	if err := s.waitReady(exited); err != nil {
+		s.terminate()
+		select {
+		case <-exited:
+		case <-time.After(stopTimeout):
+			s.kill()
+		}
+
+		s.setState(DaemonStopped, err)
+		close(s.done)
+		return err
+	}
+
+	go s.supervise(exited)
+
+	return nil
+}
+
+func (s *Supervisor) launch() (chan error, error) {
+	s.setState(DaemonStarting, nil)
+
+	cmd := exec.Command("ipfs", "daemon")
+	// Keep a terminal's SIGINT away from the daemon so only Stop ends it
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	// Starting under the lock means Stop either sees this daemon or
+	// prevents it
+	s.mu.Lock()
+	if s.stopping {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("Stopping")
+	}
+	if err := cmd.Start(); err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	s.cmd = cmd
+	s.status.Pid = cmd.Process.Pid
+	s.status.StartedAt = time.Now()
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go pipeLogs(stdout, &wg)
+	go pipeLogs(stderr, &wg)
+
+	exited := make(chan error, 1)
+	go func() {
+		wg.Wait()
+		exited <- cmd.Wait()
+	}()
+
+	return exited, nil
+}
+
+func pipeLogs(r io.Reader, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fmt.Printf("[ipfs]\t%s\n", scanner.Text())
+	}
+}
+
+func (s *Supervisor) waitReady(exited chan error) error {
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+
+	deadline := time.After(readyTimeout)
+
+	for {
+		select {
+		case err := <-exited:
+			exited <- err
+			return fmt.Errorf("IPFS daemon exited before it was ready: %v", err)
+		case <-deadline:
+			return fmt.Errorf("IPFS daemon was not ready after %s", readyTimeout)
+		case <-ticker.C:
+			if _, err := s.shell.ID(); err == nil {
+				fmt.Println("[ipfs]\tNode ready.")
+				s.setState(DaemonRunning, nil)
+				return nil
+			}
+		}
+	}
+}
+
+func (s *Supervisor) supervise(exited chan error) {
+	defer close(s.done)
+
+	backoff := minBackoff
+
+	for {
+		err := <-exited
+
+		s.mu.Lock()
+		stopping := s.stopping
+		started := s.status.StartedAt
+		s.mu.Unlock()
+
+		if stopping {
+			s.setState(DaemonStopped, nil)
+			return
+		}
+
+		if err == nil {
+			err = fmt.Errorf("exited")
+		}
+		fmt.Printf("[ipfs]\tDaemon %v. Restarting in %s.\n", err, backoff)
+		s.setState(DaemonRestarting, err)
+
+		// A daemon that stayed up for a while gets a fresh backoff
+		if time.Since(started) > maxBackoff {
+			backoff = minBackoff
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-s.stop:
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+
+		s.mu.Lock()
+		s.status.Restarts++
+		stopping = s.stopping
+		s.mu.Unlock()
+
+		if stopping {
+			s.setState(DaemonStopped, nil)
+			return
+		}
+
+		var lerr error
+		if exited, lerr = s.launch(); lerr != nil {
+			exited = make(chan error, 1)
+			exited <- lerr
+			continue
+		}
+
+		if err := s.waitReady(exited); err != nil {
+			fmt.Printf("[ipfs]\t%v\n", err)
+			s.terminate()
+		}
+	}
+}
+
+func (s *Supervisor) terminate() {
+	s.mu.Lock()
+	cmd := s.cmd
+	s.mu.Unlock()
+
+	if cmd == nil || cmd.Process == nil {
+		return
+	}
+
+	cmd.Process.Signal(syscall.SIGTERM)
+}
+
+func (s *Supervisor) kill() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cmd != nil && s.cmd.Process != nil {
+		s.cmd.Process.Kill()
+	}
+}
+
+// Stop sends SIGTERM to a launched daemon and waits for it to exit. An
+// attached daemon is left running.
+func (s *Supervisor) Stop() {
+	s.mu.Lock()
+	if !s.stopping && s.stop != nil {
+		close(s.stop)
+	}
+	s.stopping = true
+	done := s.done
+	s.mu.Unlock()
+
+	if done == nil {
+		s.setState(DaemonStopped, nil)
+		return
+	}
+
+	s.terminate()
+
+	select {
+	case <-done:
+	case <-time.After(stopTimeout):
+		s.kill()
+	}
+
+	s.setState(DaemonStopped, nil)
+}
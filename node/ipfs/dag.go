@@ -0,0 +1,398 @@
+package ipfs
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-blockservice"
+	goCid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	dsq "github.com/ipfs/go-datastore/query"
+	dssync "github.com/ipfs/go-datastore/sync"
+	flatfs "github.com/ipfs/go-ds-flatfs"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	chunker "github.com/ipfs/go-ipfs-chunker"
+	dshelp "github.com/ipfs/go-ipfs-ds-help"
+	exchange "github.com/ipfs/go-ipfs-exchange-interface"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-merkledag"
+	"github.com/ipfs/go-unixfs/importer"
+	uio "github.com/ipfs/go-unixfs/io"
+)
+
+// DagStore chunks content into a UnixFS DAG the same way `ipfs add` does,
+// so CIDs match what a Kubo node would produce for the same bytes.
+type DagStore struct {
+	bs    blockstore.Blockstore
+	bserv blockservice.BlockService
+	dag   ipld.DAGService
+
+	// pins holds one key per pinned root, so the pin set outlives the
+	// process and Unpin never collects blocks another pin still needs.
+	// mu keeps a Pin from landing in the middle of that collection.
+	mu   sync.Mutex
+	pins ds.Datastore
+}
+
+func newDagStore(bs blockstore.Blockstore, rem exchange.Interface, pins ds.Datastore) *DagStore {
+	bserv := blockservice.New(bs, rem)
+
+	return &DagStore{
+		bs:    bs,
+		bserv: bserv,
+		dag:   merkledag.NewDAGService(bserv),
+		pins:  pins,
+	}
+}
+
+func NewMemStore() *DagStore {
+	d := dssync.MutexWrap(ds.NewMapDatastore())
+
+	return newDagStore(blockstore.NewBlockstore(d), nil, namespace.Wrap(d, ds.NewKey("/pins")))
+}
+
+// NewDirStore keeps blocks in dir and the pin set in dir/pins.
+func NewDirStore(dir string) (*DagStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	pins, err := openPins(filepath.Join(dir, "pins"))
+	if err != nil {
+		return nil, err
+	}
+
+	return newDagStore(&dirBlockstore{dir}, nil, pins), nil
+}
+
+func openPins(dir string) (ds.Datastore, error) {
+	return flatfs.CreateOrOpen(dir, flatfs.NextToLast(2), false)
+}
+
+func importDAG(dag ipld.DAGService, r io.Reader) (ipld.Node, error) {
+	return importer.BuildDagFromReader(dag, chunker.DefaultSplitter(r))
+}
+
+func (s *DagStore) resolve(ctx context.Context, path string) (ipld.Node, error) {
+	root, names := splitPath(path)
+
+	c, err := goCid.Parse(root)
+	if err != nil {
+		return nil, err
+	}
+
+	node, err := s.dag.Get(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range names {
+		dir, err := uio.NewDirectoryFromNode(s.dag, node)
+		if err != nil {
+			return nil, err
+		}
+
+		if node, err = dir.Find(ctx, name); err != nil {
+			return nil, err
+		}
+	}
+
+	return node, nil
+}
+
+func (s *DagStore) readTree(ctx context.Context, node ipld.Node, prefix string, files map[string][]byte) error {
+	dir, err := uio.NewDirectoryFromNode(s.dag, node)
+	if err == uio.ErrNotADir {
+		r, err := uio.NewDagReader(ctx, node, s.dag)
+		if err != nil {
+			return err
+		}
+
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+
+		files[prefix] = data
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	return dir.ForEachLink(ctx, func(link *ipld.Link) error {
+		child, err := link.GetNode(ctx, s.dag)
+		if err != nil {
+			return err
+		}
+
+		return s.readTree(ctx, child, path.Join(prefix, link.Name), files)
+	})
+}
+
+func (s *DagStore) Put(ctx context.Context, r io.Reader) (string, error) {
+	node, err := importDAG(s.dag, r)
+	if err != nil {
+		return "", err
+	}
+
+	return node.Cid().String(), nil
+}
+
+func (s *DagStore) Get(ctx context.Context, path string) (io.ReadCloser, error) {
+	node, err := s.resolve(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	return uio.NewDagReader(ctx, node, s.dag)
+}
+
+func (s *DagStore) Stat(ctx context.Context, path string) (*Stat, error) {
+	node, err := s.resolve(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	size, err := node.Size()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Stat{node.Cid().String(), size}, nil
+}
+
+// Pin records the CID so Unpin keeps any blocks it shares with other DAGs.
+func (s *DagStore) Pin(ctx context.Context, cid string) error {
+	if _, err := s.Stat(ctx, cid); err != nil {
+		return err
+	}
+
+	c, err := goCid.Parse(cid)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.pins.Put(ctx, dshelp.NewKeyFromBinary(c.Bytes()), nil); err != nil {
+		return err
+	}
+
+	return s.pins.Sync(ctx, ds.NewKey("/"))
+}
+
+// pinned lists the pinned roots.
+func (s *DagStore) pinned(ctx context.Context) ([]goCid.Cid, error) {
+	res, err := s.pins.Query(ctx, dsq.Query{KeysOnly: true})
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := res.Rest()
+	if err != nil {
+		return nil, err
+	}
+
+	roots := make([]goCid.Cid, 0, len(entries))
+	for _, e := range entries {
+		raw, err := dshelp.BinaryFromDsKey(ds.RawKey(e.Key))
+		if err != nil {
+			continue
+		}
+		if _, c, err := goCid.CidFromBytes(raw); err == nil {
+			roots = append(roots, c)
+		}
+	}
+
+	return roots, nil
+}
+
+func (s *DagStore) GetBlock(ctx context.Context, cid string) (blocks.Block, error) {
+	c, err := goCid.Parse(cid)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.bserv.GetBlock(ctx, c)
+}
+
+// PutCar keeps every block in the CAR and pins its roots.
+func (s *DagStore) PutCar(ctx context.Context, r io.Reader) ([]string, error) {
+	roots, err := readCar(ctx, r, s.bs)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, root := range cidStrings(roots) {
+		if err := s.Pin(ctx, root); err != nil {
+			return nil, err
+		}
+	}
+
+	return cidStrings(roots), nil
+}
+
+// Unpin drops the pin and deletes the DAG's blocks, except those still
+// reachable from another pin.
+func (s *DagStore) Unpin(ctx context.Context, cid string) error {
+	root, err := goCid.Parse(cid)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.pins.Delete(ctx, dshelp.NewKeyFromBinary(root.Bytes())); err != nil {
+		return err
+	}
+	if err := s.pins.Sync(ctx, ds.NewKey("/")); err != nil {
+		return err
+	}
+
+	pinned, err := s.pinned(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Only walk what is stored locally, never fetch for a GC
+	local := merkledag.NewDAGService(blockservice.New(s.bs, nil))
+
+	keep := goCid.NewSet()
+	for _, c := range pinned {
+		collectBlocks(ctx, local, c, keep)
+	}
+
+	drop := goCid.NewSet()
+	collectBlocks(ctx, local, root, drop)
+
+	return drop.ForEach(func(c goCid.Cid) error {
+		if keep.Has(c) {
+			return nil
+		}
+
+		return s.bs.DeleteBlock(ctx, c)
+	})
+}
+
+func collectBlocks(ctx context.Context, dag ipld.DAGService, c goCid.Cid, set *goCid.Set) {
+	if !set.Visit(c) {
+		return
+	}
+
+	node, err := dag.Get(ctx, c)
+	if err != nil {
+		return
+	}
+
+	for _, link := range node.Links() {
+		collectBlocks(ctx, dag, link.Cid, set)
+	}
+}
+
+// dirBlockstore keeps one file per block, named by its CID.
+type dirBlockstore struct {
+	dir string
+}
+
+func (d *dirBlockstore) path(c goCid.Cid) string {
+	return filepath.Join(d.dir, c.String())
+}
+
+func (d *dirBlockstore) DeleteBlock(ctx context.Context, c goCid.Cid) error {
+	if err := os.Remove(d.path(c)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (d *dirBlockstore) Has(ctx context.Context, c goCid.Cid) (bool, error) {
+	_, err := os.Stat(d.path(c))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func (d *dirBlockstore) Get(ctx context.Context, c goCid.Cid) (blocks.Block, error) {
+	data, err := os.ReadFile(d.path(c))
+	if os.IsNotExist(err) {
+		return nil, ipld.ErrNotFound{Cid: c}
+	} else if err != nil {
+		return nil, err
+	}
+
+	return blocks.NewBlockWithCid(data, c)
+}
+
+func (d *dirBlockstore) GetSize(ctx context.Context, c goCid.Cid) (int, error) {
+	info, err := os.Stat(d.path(c))
+	if os.IsNotExist(err) {
+		return -1, ipld.ErrNotFound{Cid: c}
+	} else if err != nil {
+		return -1, err
+	}
+
+	return int(info.Size()), nil
+}
+
+func (d *dirBlockstore) Put(ctx context.Context, b blocks.Block) error {
+	path := d.path(b.Cid())
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b.RawData(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+func (d *dirBlockstore) PutMany(ctx context.Context, bs []blocks.Block) error {
+	for _, b := range bs {
+		if err := d.Put(ctx, b); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *dirBlockstore) AllKeysChan(ctx context.Context) (<-chan goCid.Cid, error) {
+	entries, err := os.ReadDir(d.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan goCid.Cid)
+	go func() {
+		defer close(ch)
+		for _, e := range entries {
+			c, err := goCid.Parse(e.Name())
+			if err != nil {
+				continue
+			}
+
+			select {
+			case ch <- c:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+func (d *dirBlockstore) HashOnRead(enabled bool) {}
@@ -0,0 +1,69 @@
+package ipfs
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+)
+
+// chunk is one default-sized chunk of a single repeated byte.
+func chunk(b byte) []byte {
+	return bytes.Repeat([]byte{b}, 256*1024)
+}
+
+func TestUnpinAfterReopen(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s, err := NewDirStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Both files start with the same chunk, so they share its block
+	one := append(chunk('x'), chunk('y')...)
+	two := append(chunk('x'), chunk('z')...)
+
+	cids := make([]string, 2)
+	for i, data := range [][]byte{one, two} {
+		if cids[i], err = s.Put(ctx, bytes.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Pin(ctx, cids[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A restart must not forget the pins
+	if s, err = NewDirStore(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Unpin(ctx, cids[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := s.Get(ctx, cids[1])
+	if err != nil {
+		t.Fatalf("got %v reading the file still pinned, want its blocks kept", err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("got %v reading the file still pinned, want its blocks kept", err)
+	}
+	if !bytes.Equal(got, two) {
+		t.Errorf("got %d bytes back, want the %d that were pinned", len(got), len(two))
+	}
+
+	if _, err := s.Get(ctx, cids[0]); err == nil {
+		t.Error("got the unpinned file back, want its root deleted")
+	}
+
+	pinned, err := s.pinned(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pinned) != 1 || pinned[0].String() != cids[1] {
+		t.Errorf("got pins %v, want only %s", pinned, cids[1])
+	}
+}
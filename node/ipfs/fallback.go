@@ -0,0 +1,95 @@
+package ipfs
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	blocks "github.com/ipfs/go-block-format"
+	goCid "github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+)
+
+// localReader is implemented by stores that can read without going out to
+// the network, so a miss fails fast instead of hanging.
+type localReader interface {
+	GetLocal(ctx context.Context, path string) (io.ReadCloser, error)
+}
+
+// FallbackStore reads from the gateways whatever the wrapped store doesn't
+// have locally. Writes and pins only go to the wrapped store.
+type FallbackStore struct {
+	BlockStore
+	gateways *Gateways
+}
+
+func NewFallbackStore(store BlockStore, gateways *Gateways) *FallbackStore {
+	return &FallbackStore{store, gateways}
+}
+
+func (s *FallbackStore) Gateways() *Gateways {
+	return s.gateways
+}
+
+// fetch fills a throwaway DAG with the path's blocks. The CAR covers most
+// of it and the rest is fetched a block at a time while reading.
+func (s *FallbackStore) fetch(ctx context.Context, path string) *DagStore {
+	d := dssync.MutexWrap(ds.NewMapDatastore())
+	bs := blockstore.NewBlockstore(d)
+
+	if err := s.gateways.FetchCar(ctx, path, bs); err != nil {
+		fmt.Printf("[gateway]\tCAR for %s failed, fetching blocks: %v\n", path, err)
+	}
+
+	return newDagStore(bs, s.gateways, d)
+}
+
+func (s *FallbackStore) Get(ctx context.Context, path string) (io.ReadCloser, error) {
+	var (
+		r   io.ReadCloser
+		err error
+	)
+
+	if local, ok := s.BlockStore.(localReader); ok {
+		r, err = local.GetLocal(ctx, path)
+	} else {
+		r, err = s.BlockStore.Get(ctx, path)
+	}
+
+	if err == nil {
+		return r, nil
+	}
+
+	return s.fetch(ctx, path).Get(ctx, path)
+}
+
+func (s *FallbackStore) Stat(ctx context.Context, path string) (*Stat, error) {
+	sctx, cancel := context.WithTimeout(ctx, s.gateways.timeout)
+	stat, err := s.BlockStore.Stat(sctx, path)
+	cancel()
+
+	if err == nil {
+		return stat, nil
+	}
+
+	return s.fetch(ctx, path).Stat(ctx, path)
+}
+
+func (s *FallbackStore) GetBlock(ctx context.Context, cid string) (blocks.Block, error) {
+	sctx, cancel := context.WithTimeout(ctx, s.gateways.timeout)
+	b, err := s.BlockStore.GetBlock(sctx, cid)
+	cancel()
+
+	if err == nil {
+		return b, nil
+	}
+
+	c, err := goCid.Parse(cid)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.gateways.GetBlock(ctx, c)
+}
@@ -0,0 +1,274 @@
+package ipfs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	blocks "github.com/ipfs/go-block-format"
+	goCid "github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+)
+
+const (
+	maxBlockSize = 2 << 20
+	maxCarSize   = 256 << 20
+	maxCooldown  = 5 * time.Minute
+)
+
+type GatewayHealth struct {
+	URL       string        `json:"url"`
+	Successes int           `json:"successes"`
+	Failures  int           `json:"failures"`
+	Latency   time.Duration `json:"latency"`
+	LastError string        `json:"lastError,omitempty"`
+	DownUntil time.Time     `json:"downUntil,omitempty"`
+}
+
+// Gateways reads from trustless HTTP gateways. Gateways are untrusted:
+// every block is hashed and compared with its CID before it is used.
+// Gateways that keep failing are skipped for a while, and the rest are
+// tried fastest first.
+type Gateways struct {
+	timeout time.Duration
+	client  *http.Client
+
+	mu   sync.Mutex
+	list []*GatewayHealth
+}
+
+func NewGateways(urls []string, timeout time.Duration) *Gateways {
+	g := &Gateways{
+		timeout: timeout,
+		client:  &http.Client{},
+	}
+
+	for _, url := range urls {
+		if url = strings.TrimRight(strings.TrimSpace(url), "/"); url != "" {
+			g.list = append(g.list, &GatewayHealth{URL: url})
+		}
+	}
+
+	return g
+}
+
+func (g *Gateways) Len() int {
+	return len(g.list)
+}
+
+func (g *Gateways) Health() []GatewayHealth {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	health := make([]GatewayHealth, len(g.list))
+	for i, gw := range g.list {
+		health[i] = *gw
+	}
+
+	return health
+}
+
+// ordered puts gateways that are up first, then the fewest consecutive
+// failures and lowest latency. Gateways cooling down are still tried last
+// so a read never fails just because every gateway had a bad minute.
+func (g *Gateways) ordered() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	list := make([]*GatewayHealth, len(g.list))
+	copy(list, g.list)
+
+	sort.SliceStable(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if aUp, bUp := a.DownUntil.Before(now), b.DownUntil.Before(now); aUp != bUp {
+			return aUp
+		}
+		if a.Failures != b.Failures {
+			return a.Failures < b.Failures
+		}
+		return a.Latency < b.Latency
+	})
+
+	urls := make([]string, len(list))
+	for i, gw := range list {
+		urls[i] = gw.URL
+	}
+
+	return urls
+}
+
+func (g *Gateways) record(url string, took time.Duration, err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, gw := range g.list {
+		if gw.URL != url {
+			continue
+		}
+
+		if err == nil {
+			gw.Successes++
+			gw.Failures = 0
+			gw.DownUntil = time.Time{}
+			if gw.Latency == 0 {
+				gw.Latency = took
+			} else {
+				gw.Latency = (gw.Latency*3 + took) / 4
+			}
+			return
+		}
+
+		gw.Failures++
+		gw.LastError = err.Error()
+
+		cooldown := time.Second << gw.Failures
+		if cooldown > maxCooldown || cooldown <= 0 {
+			cooldown = maxCooldown
+		}
+		gw.DownUntil = time.Now().Add(cooldown)
+		return
+	}
+}
+
+// try calls fn against each gateway in turn, each with its own timeout,
+// until one succeeds.
+func (g *Gateways) try(ctx context.Context, fn func(ctx context.Context, url string) error) error {
+	if len(g.list) == 0 {
+		return fmt.Errorf("No IPFS gateways are configured")
+	}
+
+	var lastErr error
+	for _, url := range g.ordered() {
+		start := time.Now()
+		gctx, cancel := context.WithTimeout(ctx, g.timeout)
+		err := fn(gctx, url)
+		cancel()
+
+		// Don't blame the gateway for the caller giving up
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		g.record(url, time.Since(start), err)
+		if err == nil {
+			return nil
+		}
+
+		lastErr = err
+	}
+
+	return lastErr
+}
+
+func (g *Gateways) request(ctx context.Context, url, accept string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+
+	res, err := g.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, fmt.Errorf("%s returned %d", url, res.StatusCode)
+	}
+
+	return res, nil
+}
+
+func verify(c goCid.Cid, data []byte) (blocks.Block, error) {
+	sum, err := c.Prefix().Sum(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if !sum.Equals(c) {
+		return nil, fmt.Errorf("Block data does not match %s", c)
+	}
+
+	return blocks.NewBlockWithCid(data, c)
+}
+
+// FetchCar loads the blocks needed to read path into bs. Blocks are
+// verified one by one, so a gateway can at worst leave some out.
+func (g *Gateways) FetchCar(ctx context.Context, path string, bs blockstore.Blockstore) error {
+	return g.try(ctx, func(ctx context.Context, gw string) error {
+		res, err := g.request(ctx, gw+"/ipfs/"+path+"?format=car", "application/vnd.ipld.car")
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+
+		_, err = readCar(ctx, io.LimitReader(res.Body, maxCarSize), bs)
+		return err
+	})
+}
+
+// GetBlock makes Gateways usable as the exchange behind a block service,
+// fetching any block that is missing locally.
+func (g *Gateways) GetBlock(ctx context.Context, c goCid.Cid) (blocks.Block, error) {
+	var block blocks.Block
+
+	err := g.try(ctx, func(ctx context.Context, gw string) error {
+		res, err := g.request(ctx, gw+"/ipfs/"+c.String()+"?format=raw", "application/vnd.ipld.raw")
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+
+		data, err := io.ReadAll(io.LimitReader(res.Body, maxBlockSize+1))
+		if err != nil {
+			return err
+		}
+
+		if len(data) > maxBlockSize {
+			return fmt.Errorf("%s returned an oversized block for %s", gw, c)
+		}
+
+		block, err = verify(c, data)
+		return err
+	})
+
+	return block, err
+}
+
+func (g *Gateways) GetBlocks(ctx context.Context, cids []goCid.Cid) (<-chan blocks.Block, error) {
+	out := make(chan blocks.Block)
+
+	go func() {
+		defer close(out)
+		for _, c := range cids {
+			b, err := g.GetBlock(ctx, c)
+			if err != nil {
+				continue
+			}
+
+			select {
+			case out <- b:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// NotifyNewBlocks is a no-op. Blocks are only served to this node's clients.
+func (g *Gateways) NotifyNewBlocks(ctx context.Context, bs ...blocks.Block) error {
+	return nil
+}
+
+func (g *Gateways) Close() error {
+	return nil
+}
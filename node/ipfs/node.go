@@ -0,0 +1,261 @@
+package ipfs
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	bitswap "github.com/ipfs/go-bitswap"
+	bsnet "github.com/ipfs/go-bitswap/network"
+	ds "github.com/ipfs/go-datastore"
+	flatfs "github.com/ipfs/go-ds-flatfs"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	dht "github.com/libp2p/go-libp2p-kad-dht"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	basichost "github.com/libp2p/go-libp2p/p2p/host/basic"
+	"github.com/libp2p/go-libp2p/p2p/host/peerstore/pstoremem"
+	msmux "github.com/libp2p/go-libp2p/p2p/muxer/muxer-multistream"
+	"github.com/libp2p/go-libp2p/p2p/muxer/yamux"
+	csms "github.com/libp2p/go-libp2p/p2p/net/conn-security-multistream"
+	"github.com/libp2p/go-libp2p/p2p/net/swarm"
+	"github.com/libp2p/go-libp2p/p2p/net/upgrader"
+	"github.com/libp2p/go-libp2p/p2p/security/noise"
+	"github.com/libp2p/go-libp2p/p2p/transport/tcp"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// Node is an IPFS node running inside the process, so a single `bui node`
+// serves blocks without a Kubo daemon. Blocks are kept in a flatfs
+// datastore under the repo, fetched from peers over bitswap and announced
+// to the DHT, which is also how the peers holding a block are found.
+type Node struct {
+	*DagStore
+
+	host    host.Host
+	routing *dht.IpfsDHT
+	bitswap *bitswap.Bitswap
+	blocks  ds.Batching
+	pins    ds.Datastore
+	cancel  context.CancelFunc
+}
+
+// NewNode opens the repo, listens on the listen multiaddrs and joins the
+// DHT through the bootstrap peers.
+func NewNode(repo string, listen []string, bootstrap []string) (*Node, error) {
+	if err := os.MkdirAll(repo, 0755); err != nil {
+		return nil, err
+	}
+
+	key, err := loadIdentity(filepath.Join(repo, "identity"))
+	if err != nil {
+		return nil, err
+	}
+
+	peers, err := parsePeers(bootstrap)
+	if err != nil {
+		return nil, err
+	}
+
+	blocks, err := flatfs.CreateOrOpen(filepath.Join(repo, "blocks"), flatfs.NextToLast(2), false)
+	if err != nil {
+		return nil, err
+	}
+
+	pins, err := openPins(filepath.Join(repo, "pins"))
+	if err != nil {
+		blocks.Close()
+		return nil, err
+	}
+
+	h, err := newHost(key, listen)
+	if err != nil {
+		blocks.Close()
+		pins.Close()
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	routing, err := dht.New(ctx, h, dht.Mode(dht.ModeClient), dht.BootstrapPeers(peers...))
+	if err != nil {
+		cancel()
+		h.Close()
+		blocks.Close()
+		pins.Close()
+		return nil, err
+	}
+
+	for _, p := range peers {
+		go func(p peer.AddrInfo) {
+			if err := h.Connect(ctx, p); err != nil {
+				fmt.Printf("[ipfs]\tCould not reach bootstrap peer %s: %v\n", p.ID, err)
+			}
+		}(p)
+	}
+	if err := routing.Bootstrap(ctx); err != nil {
+		fmt.Printf("[ipfs]\tDHT bootstrap: %v\n", err)
+	}
+
+	// flatfs keys are a single path segment, so no /blocks prefix
+	bs := blockstore.NewBlockstoreNoPrefix(blocks)
+	exchange := bitswap.New(ctx, bsnet.NewFromIpfsHost(h, routing), bs)
+
+	fmt.Printf("[ipfs]\tEmbedded node %s at %s, listening on %v.\n", h.ID(), repo, h.Addrs())
+
+	return &Node{
+		DagStore: newDagStore(bs, exchange, pins),
+		host:     h,
+		routing:  routing,
+		bitswap:  exchange,
+		blocks:   blocks,
+		pins:     pins,
+		cancel:   cancel,
+	}, nil
+}
+
+// Host is the node's libp2p host.
+func (n *Node) Host() host.Host {
+	return n.host
+}
+
+// Close leaves the network and closes the repo's datastores.
+func (n *Node) Close() error {
+	var errs []error
+	for _, closer := range []func() error{n.bitswap.Close, n.routing.Close, n.host.Close, n.blocks.Close, n.pins.Close} {
+		if err := closer(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	n.cancel()
+
+	if len(errs) > 0 {
+		return errs[0]
+	}
+
+	return nil
+}
+
+// newHost builds the host from its parts, TCP with noise and yamux, which
+// is what Kubo nodes speak.
+func newHost(key crypto.PrivKey, listen []string) (host.Host, error) {
+	id, err := peer.IDFromPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	ps, err := pstoremem.NewPeerstore()
+	if err != nil {
+		return nil, err
+	}
+	if err := ps.AddPrivKey(id, key); err != nil {
+		return nil, err
+	}
+	if err := ps.AddPubKey(id, key.GetPublic()); err != nil {
+		return nil, err
+	}
+
+	sw, err := swarm.NewSwarm(id, ps)
+	if err != nil {
+		return nil, err
+	}
+
+	secure, err := noise.New(key)
+	if err != nil {
+		return nil, err
+	}
+
+	sec := new(csms.SSMuxer)
+	sec.AddTransport(noise.ID, secure)
+
+	mux := msmux.NewBlankTransport()
+	mux.AddTransport("/yamux/1.0.0", yamux.DefaultTransport)
+
+	up, err := upgrader.New(sec, mux)
+	if err != nil {
+		return nil, err
+	}
+
+	tpt, err := tcp.NewTCPTransport(up, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := sw.AddTransport(tpt); err != nil {
+		return nil, err
+	}
+
+	addrs := make([]ma.Multiaddr, 0, len(listen))
+	for _, l := range listen {
+		addr, err := ma.NewMultiaddr(l)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid listen address %s: %v", l, err)
+		}
+		addrs = append(addrs, addr)
+	}
+	if err := sw.Listen(addrs...); err != nil {
+		sw.Close()
+		return nil, err
+	}
+
+	h, err := basichost.NewHost(sw, nil)
+	if err != nil {
+		sw.Close()
+		return nil, err
+	}
+	h.Start()
+
+	return h, nil
+}
+
+// loadIdentity reads the node's key, creating it on first run so the peer
+// ID stays the same across restarts.
+func loadIdentity(path string) (crypto.PrivKey, error) {
+	if data, err := os.ReadFile(path); err == nil {
+		return crypto.UnmarshalPrivateKey(data)
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	key, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := crypto.MarshalPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return nil, err
+	}
+
+	return key, os.Rename(tmp, path)
+}
+
+func parsePeers(addrs []string) ([]peer.AddrInfo, error) {
+	mas := make([]ma.Multiaddr, 0, len(addrs))
+	for _, a := range addrs {
+		addr, err := ma.NewMultiaddr(a)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid bootstrap peer %s: %v", a, err)
+		}
+		mas = append(mas, addr)
+	}
+
+	return peer.AddrInfosFromP2pAddrs(mas...)
+}
+
+// defaultBootstrap is the public bootstrap peers Kubo uses.
+func defaultBootstrap() []string {
+	addrs := make([]string, len(dht.DefaultBootstrapPeers))
+	for i, addr := range dht.DefaultBootstrapPeers {
+		addrs[i] = addr.String()
+	}
+
+	return addrs
+}
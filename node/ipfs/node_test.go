@@ -0,0 +1,73 @@
+package ipfs
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+func newTestNode(t *testing.T) *Node {
+	n, err := NewNode(t.TempDir(), []string{"/ip4/127.0.0.1/tcp/0"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { n.Close() })
+
+	return n
+}
+
+func TestNodeBitswap(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	a, b := newTestNode(t), newTestNode(t)
+
+	data := append(chunk('x'), []byte("from the other node")...)
+	cid, err := a.Put(ctx, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Host().Connect(ctx, peer.AddrInfo{ID: a.Host().ID(), Addrs: a.Host().Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+
+	// b has none of the blocks, so every one comes over bitswap
+	r, err := b.Get(ctx, cid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("got %d bytes, want the %d a added", len(got), len(data))
+	}
+
+	if err := b.Pin(ctx, cid); err != nil {
+		t.Errorf("got %v pinning what was fetched, want it stored", err)
+	}
+}
+
+func TestNodeIdentity(t *testing.T) {
+	repo := t.TempDir()
+
+	ids := make([]peer.ID, 2)
+	for i := range ids {
+		n, err := NewNode(repo, []string{"/ip4/127.0.0.1/tcp/0"}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = n.Host().ID()
+		n.Close()
+	}
+
+	if ids[0] != ids[1] {
+		t.Errorf("got peer %s after a restart, want %s", ids[1], ids[0])
+	}
+}
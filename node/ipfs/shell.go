@@ -0,0 +1,120 @@
+package ipfs
+
+import (
+	"context"
+	"io"
+
+	blocks "github.com/ipfs/go-block-format"
+	sh "github.com/ipfs/go-ipfs-api"
+	files "github.com/ipfs/go-ipfs-files"
+	"github.com/ipld/go-car"
+)
+
+// ShellStore talks to a Kubo daemon over its HTTP API. The daemon itself
+// is managed by the Supervisor.
+type ShellStore struct {
+	shell *sh.Shell
+}
+
+func NewShellStore(api string) *ShellStore {
+	return &ShellStore{sh.NewShell(api)}
+}
+
+func (s *ShellStore) Put(ctx context.Context, r io.Reader) (string, error) {
+	return s.shell.Add(r)
+}
+
+func (s *ShellStore) Get(ctx context.Context, path string) (io.ReadCloser, error) {
+	return s.cat(ctx, path, false)
+}
+
+// GetLocal fails straight away when the daemon doesn't have the content
+// instead of searching the network for it.
+func (s *ShellStore) GetLocal(ctx context.Context, path string) (io.ReadCloser, error) {
+	return s.cat(ctx, path, true)
+}
+
+func (s *ShellStore) cat(ctx context.Context, path string, offline bool) (io.ReadCloser, error) {
+	req := s.shell.Request("cat", path)
+	if offline {
+		req.Option("offline", true)
+	}
+
+	res, err := req.Send(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.Error != nil {
+		res.Close()
+		return nil, res.Error
+	}
+
+	return res.Output, nil
+}
+
+func (s *ShellStore) Stat(ctx context.Context, path string) (*Stat, error) {
+	stat, err := s.shell.FilesStat(ctx, "/ipfs/"+path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Stat{stat.Hash, stat.CumulativeSize}, nil
+}
+
+func (s *ShellStore) Pin(ctx context.Context, cid string) error {
+	return s.shell.Pin(cid)
+}
+
+// Unpin leaves removal of the blocks to the daemon's own garbage collector.
+func (s *ShellStore) Unpin(ctx context.Context, cid string) error {
+	return s.shell.Unpin(cid)
+}
+
+func (s *ShellStore) GetBlock(ctx context.Context, cid string) (blocks.Block, error) {
+	res, err := s.shell.Request("block/get", cid).Send(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	data, err := io.ReadAll(io.LimitReader(res.Output, maxBlockSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	return blockOf(cid, data)
+}
+
+// PutCar checks the CAR before handing it to `ipfs dag import`, which pins
+// the roots.
+func (s *ShellStore) PutCar(ctx context.Context, r io.Reader) ([]string, error) {
+	mem := NewMemStore()
+
+	roots, err := readCar(ctx, r, mem.bs)
+	if err != nil {
+		return nil, err
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(car.WriteCar(ctx, mem.dag, roots, pw))
+	}()
+
+	body := files.NewMultiFileReader(
+		files.NewSliceDirectory([]files.DirEntry{files.FileEntry("", files.NewReaderFile(pr))}),
+		true,
+	)
+
+	// Unblock the writer if the import stops reading early
+	if err := s.shell.Request("dag/import").Body(body).Exec(ctx, nil); err != nil {
+		pr.CloseWithError(err)
+		return nil, err
+	}
+
+	return cidStrings(roots), nil
+}
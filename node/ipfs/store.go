@@ -0,0 +1,81 @@
+package ipfs
+
+import (
+	"blocksui-node/config"
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	blocks "github.com/ipfs/go-block-format"
+)
+
+type Stat struct {
+	Cid  string `json:"cid"`
+	Size uint64 `json:"size"`
+}
+
+// BlockStore is where the node keeps block content. Get and Stat accept a
+// bare CID or an IPFS path such as <cid>/blocks/Button.js. GetBlock and
+// PutCar work on raw DAG blocks for export and import.
+type BlockStore interface {
+	Put(ctx context.Context, r io.Reader) (string, error)
+	Get(ctx context.Context, path string) (io.ReadCloser, error)
+	Stat(ctx context.Context, path string) (*Stat, error)
+	Pin(ctx context.Context, cid string) error
+	Unpin(ctx context.Context, cid string) error
+	GetBlock(ctx context.Context, cid string) (blocks.Block, error)
+	PutCar(ctx context.Context, r io.Reader) ([]string, error)
+}
+
+// Open returns the store selected by the STORE setting. Reads fall back
+// to the gateways, when there are any, for content the store can't find.
+func Open(c *config.Config) (BlockStore, error) {
+	gateways := NewGateways(c.IPFSGateways, c.IPFSGatewayTimeout)
+
+	var (
+		store BlockStore
+		err   error
+	)
+
+	switch c.Store {
+	case "", "kubo":
+		store = NewShellStore(c.IPFSApi)
+	case "web3":
+		if store, err = NewWeb3Store(c.Web3Token); err != nil {
+			return nil, err
+		}
+	case "memory":
+		store = NewMemStore()
+	case "dir":
+		dir := c.StoreDir
+		if dir == "" {
+			dir = filepath.Join(c.HomeDir, ".bui", "blocks")
+		}
+		if store, err = NewDirStore(dir); err != nil {
+			return nil, err
+		}
+	case "embedded":
+		bootstrap := c.IPFSBootstrap
+		if len(bootstrap) == 0 {
+			bootstrap = defaultBootstrap()
+		}
+		if store, err = NewNode(filepath.Join(c.HomeDir, ".bui", "ipfs"), c.IPFSListen, bootstrap); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("Unknown store: %s", c.Store)
+	}
+
+	if gateways.Len() == 0 {
+		return store, nil
+	}
+
+	return NewFallbackStore(store, gateways), nil
+}
+
+func splitPath(path string) (string, []string) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(path, "/ipfs/"), "/"), "/")
+	return parts[0], parts[1:]
+}
@@ -0,0 +1,158 @@
+package ipfs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+
+	blocks "github.com/ipfs/go-block-format"
+	goCid "github.com/ipfs/go-cid"
+	"github.com/ipld/go-car"
+	w3s "github.com/web3-storage/go-w3s-client"
+)
+
+// Web3Store uploads to and reads from web3.storage.
+type Web3Store struct {
+	client w3s.Client
+}
+
+func NewWeb3Store(token string) (*Web3Store, error) {
+	client, err := w3s.NewClient(w3s.WithToken(token))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Web3Store{client}, nil
+}
+
+// Put builds the DAG locally and uploads it as a CAR. The client's own Put
+// wraps single files in a directory, which would change the returned CID.
+func (s *Web3Store) Put(ctx context.Context, r io.Reader) (string, error) {
+	mem := NewMemStore()
+
+	node, err := importDAG(mem.dag, r)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.upload(ctx, mem, []goCid.Cid{node.Cid()}); err != nil {
+		return "", err
+	}
+
+	return node.Cid().String(), nil
+}
+
+func (s *Web3Store) upload(ctx context.Context, mem *DagStore, roots []goCid.Cid) error {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(car.WriteCar(ctx, mem.dag, roots, pw))
+	}()
+
+	// Unblock the writer if the upload stops reading early
+	if _, err := s.client.PutCar(ctx, pr); err != nil {
+		pr.CloseWithError(err)
+		return err
+	}
+
+	return nil
+}
+
+type web3File struct {
+	fs.File
+	cancel context.CancelFunc
+}
+
+func (f *web3File) Close() error {
+	f.cancel()
+	return f.File.Close()
+}
+
+func (s *Web3Store) Get(ctx context.Context, path string) (io.ReadCloser, error) {
+	root, names := splitPath(path)
+
+	c, err := goCid.Parse(root)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	res, err := s.client.Get(ctx, c)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	if res.StatusCode != 200 {
+		cancel()
+		return nil, fmt.Errorf("web3.storage returned %d for %s", res.StatusCode, path)
+	}
+
+	file, fsys, err := res.Files()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	if len(names) > 0 {
+		file.Close()
+		if file, err = fsys.Open("/" + strings.Join(names, "/")); err != nil {
+			cancel()
+			return nil, err
+		}
+	}
+
+	return &web3File{file, cancel}, nil
+}
+
+func (s *Web3Store) Stat(ctx context.Context, path string) (*Stat, error) {
+	root, names := splitPath(path)
+	if len(names) > 0 {
+		return nil, fmt.Errorf("web3.storage can only stat root CIDs")
+	}
+
+	c, err := goCid.Parse(root)
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := s.client.Status(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Stat{status.Cid.String(), status.DagSize}, nil
+}
+
+// Pin is a no-op. web3.storage pins everything it stores.
+func (s *Web3Store) Pin(ctx context.Context, cid string) error {
+	return nil
+}
+
+// Unpin is a no-op. Uploads can only be removed from the web3.storage account.
+func (s *Web3Store) Unpin(ctx context.Context, cid string) error {
+	return nil
+}
+
+// GetBlock is unsupported. Wrapped in a FallbackStore, blocks are read from
+// the gateways instead.
+func (s *Web3Store) GetBlock(ctx context.Context, cid string) (blocks.Block, error) {
+	return nil, fmt.Errorf("web3.storage does not serve raw blocks")
+}
+
+func (s *Web3Store) PutCar(ctx context.Context, r io.Reader) ([]string, error) {
+	mem := NewMemStore()
+
+	roots, err := readCar(ctx, r, mem.bs)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.upload(ctx, mem, roots); err != nil {
+		return nil, err
+	}
+
+	return cidStrings(roots), nil
+}
@@ -0,0 +1,155 @@
+// Package licenses reads the terms a licence was sold under and meters its
+// use. A licence without terms never expires and is unmetered.
+package licenses
+
+import (
+	"blocksui-node/contracts"
+	"blocksui-node/indexer"
+	"blocksui-node/ipfs"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	termsTTL        = 5 * time.Minute
+	fetchTimeout    = 30 * time.Second
+	maxMetadataSize = 64 << 10
+)
+
+// Terms limit a licence. Quota is the number of reads allowed per Period,
+// or in total when Period is zero. Origins limits the sites a licence can
+// be used on.
+type Terms struct {
+	ExpiresAt time.Time     `json:"expiresAt,omitempty"`
+	Origins   []string      `json:"origins,omitempty"`
+	Quota     uint64        `json:"quota,omitempty"`
+	Period    time.Duration `json:"period,omitempty"`
+}
+
+func (t *Terms) Expired() bool {
+	return !t.ExpiresAt.IsZero() && time.Now().After(t.ExpiresAt)
+}
+
+func (t *Terms) AllowsOrigin(origin string) bool {
+	if len(t.Origins) == 0 {
+		return true
+	}
+
+	for _, o := range t.Origins {
+		if strings.EqualFold(strings.TrimRight(o, "/"), strings.TrimRight(origin, "/")) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// metadataTerms is how terms are written in licence metadata, with times
+// in unix seconds.
+type metadataTerms struct {
+	Terms *struct {
+		ExpiresAt int64    `json:"expiresAt"`
+		Origins   []string `json:"origins"`
+		Quota     uint64   `json:"quota"`
+		Period    int64    `json:"period"`
+	} `json:"terms"`
+}
+
+type cached struct {
+	terms   *Terms
+	fetched time.Time
+}
+
+var (
+	store ipfs.BlockStore
+	mu    sync.Mutex
+	cache = make(map[uint64]cached)
+)
+
+// Lookup returns the terms written in the licence's metadata.
+func Lookup(ctx context.Context, tokenId uint64) (*Terms, error) {
+	mu.Lock()
+	c, ok := cache[tokenId]
+	mu.Unlock()
+
+	if ok && time.Since(c.fetched) < termsTTL {
+		return c.terms, nil
+	}
+
+	terms, err := fetch(ctx, tokenId)
+	if err != nil {
+		return nil, err
+	}
+
+	mu.Lock()
+	cache[tokenId] = cached{terms, time.Now()}
+	mu.Unlock()
+
+	return terms, nil
+}
+
+func fetch(ctx context.Context, tokenId uint64) (*Terms, error) {
+	cnt, ok := contracts.GetContract("BUILicenseNFT")
+	if !ok {
+		return nil, fmt.Errorf("Contract not found BUILicenseNFT")
+	}
+
+	if cnt.Abi.GetMethod("tokenURI") == nil {
+		return &Terms{}, nil
+	}
+
+	uri, err := indexer.FetchTokenURI("BUILicenseNFT", tokenId)
+	if err != nil {
+		return nil, err
+	}
+
+	return readTerms(ctx, uri)
+}
+
+func readTerms(ctx context.Context, uri string) (*Terms, error) {
+	if store == nil {
+		return nil, fmt.Errorf("Licences are not initialized")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+
+	data, err := store.Get(ctx, strings.TrimPrefix(uri, "ipfs://"))
+	if err != nil {
+		return nil, err
+	}
+	defer data.Close()
+
+	buf, err := io.ReadAll(io.LimitReader(data, maxMetadataSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(buf) > maxMetadataSize {
+		return nil, fmt.Errorf("Licence metadata is larger than %d bytes", maxMetadataSize)
+	}
+
+	var meta metadataTerms
+	if err := json.Unmarshal(buf, &meta); err != nil {
+		return nil, err
+	}
+
+	terms := &Terms{}
+	if meta.Terms == nil {
+		return terms, nil
+	}
+
+	terms.Origins = meta.Terms.Origins
+	terms.Quota = meta.Terms.Quota
+	terms.Period = time.Duration(meta.Terms.Period) * time.Second
+	if meta.Terms.ExpiresAt > 0 {
+		terms.ExpiresAt = time.Unix(meta.Terms.ExpiresAt, 0)
+	}
+
+	return terms, nil
+}
@@ -0,0 +1,199 @@
+package licenses
+
+import (
+	"blocksui-node/config"
+	"blocksui-node/ipfs"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Usage counts reads of one licence in its current period.
+type Usage struct {
+	PeriodStart time.Time `json:"periodStart"`
+	Count       uint64    `json:"count"`
+}
+
+const saveInterval = 5 * time.Second
+
+// Entitlement is what a licence has left after a read.
+type Entitlement struct {
+	Remaining uint64
+	ResetsAt  time.Time
+}
+
+type counters struct {
+	path string
+
+	mu     sync.Mutex
+	usage  map[string]*Usage
+	dirty  bool
+	saving sync.Mutex
+}
+
+var usage *counters
+
+// Start loads the usage counters, which survive restarts so a quota can't
+// be reset by restarting the node. Changes are saved in batches.
+func Start(c *config.Config, s ipfs.BlockStore) error {
+	if usage != nil {
+		return fmt.Errorf("Already initialized")
+	}
+
+	u := &counters{
+		path:  filepath.Join(c.HomeDir, ".bui", "usage.json"),
+		usage: make(map[string]*Usage),
+	}
+
+	data, err := os.ReadFile(u.path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	} else if err == nil {
+		if err := json.Unmarshal(data, &u.usage); err != nil {
+			return err
+		}
+	}
+
+	store = s
+	usage = u
+	go u.run()
+
+	return nil
+}
+
+func (u *counters) run() {
+	for {
+		time.Sleep(saveInterval)
+
+		if err := u.save(); err != nil {
+			fmt.Printf("[licenses]\t%v\n", err)
+		}
+	}
+}
+
+// current returns the licence's usage, starting a new period once the
+// last one is over. Callers hold the lock.
+func (u *counters) current(tokenId uint64, terms *Terms) *Usage {
+	key := strconv.FormatUint(tokenId, 10)
+
+	now := time.Now()
+	use, ok := u.usage[key]
+	if !ok || (terms.Period > 0 && now.Sub(use.PeriodStart) >= terms.Period) {
+		use = &Usage{PeriodStart: now}
+		u.usage[key] = use
+	}
+
+	return use
+}
+
+func (u *counters) entitlement(use *Usage, terms *Terms) Entitlement {
+	e := Entitlement{}
+	if use.Count < terms.Quota {
+		e.Remaining = terms.Quota - use.Count
+	}
+
+	if terms.Period > 0 {
+		e.ResetsAt = use.PeriodStart.Add(terms.Period)
+	}
+
+	return e
+}
+
+// Remaining reports what the licence has left without using any of it.
+func Remaining(tokenId uint64, terms *Terms) (Entitlement, error) {
+	if usage == nil {
+		return Entitlement{}, fmt.Errorf("Licences are not initialized")
+	}
+
+	usage.mu.Lock()
+	defer usage.mu.Unlock()
+
+	return usage.entitlement(usage.current(tokenId, terms), terms), nil
+}
+
+// Consume uses one read of a metered licence. It reports false, using
+// nothing, once the quota for the period is spent.
+func Consume(tokenId uint64, terms *Terms) (Entitlement, bool, error) {
+	if usage == nil {
+		return Entitlement{}, false, fmt.Errorf("Licences are not initialized")
+	}
+
+	usage.mu.Lock()
+	defer usage.mu.Unlock()
+
+	use := usage.current(tokenId, terms)
+	if use.Count >= terms.Quota {
+		return usage.entitlement(use, terms), false, nil
+	}
+
+	use.Count++
+	usage.dirty = true
+
+	return usage.entitlement(use, terms), true, nil
+}
+
+// Refund gives back a read Consume returned e for, unless its period has
+// since ended.
+func Refund(tokenId uint64, terms *Terms, e Entitlement) {
+	if usage == nil {
+		return
+	}
+
+	usage.mu.Lock()
+	defer usage.mu.Unlock()
+
+	use := usage.current(tokenId, terms)
+	if use.Count == 0 || usage.entitlement(use, terms).ResetsAt != e.ResetsAt {
+		return
+	}
+
+	use.Count--
+	usage.dirty = true
+}
+
+// Flush saves the counters now, for a shutdown.
+func Flush() error {
+	if usage == nil {
+		return nil
+	}
+
+	return usage.save()
+}
+
+// save writes the counters when they changed since the last save.
+func (u *counters) save() error {
+	u.saving.Lock()
+	defer u.saving.Unlock()
+
+	u.mu.Lock()
+	if !u.dirty {
+		u.mu.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(u.usage)
+	u.dirty = false
+	u.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp := u.path + ".tmp"
+	if err = os.MkdirAll(filepath.Dir(u.path), 0755); err == nil {
+		if err = os.WriteFile(tmp, data, 0644); err == nil {
+			err = os.Rename(tmp, u.path)
+		}
+	}
+
+	if err != nil {
+		// Try again on the next save
+		u.mu.Lock()
+		u.dirty = true
+		u.mu.Unlock()
+	}
+
+	return err
+}
@@ -0,0 +1,75 @@
+package licenses
+
+import (
+	"blocksui-node/config"
+	"testing"
+	"time"
+)
+
+func TestConsume(t *testing.T) {
+	c := &config.Config{HomeDir: t.TempDir()}
+	if err := Start(c, nil); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { usage = nil }()
+
+	metered := &Terms{Quota: 2}
+	monthly := &Terms{Quota: 1, Period: 30 * 24 * time.Hour}
+
+	first, _, err := Consume(1, metered)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		do        func() (Entitlement, bool, error)
+		ok        bool
+		remaining uint64
+	}{
+		{"second read", func() (Entitlement, bool, error) { return Consume(1, metered) }, true, 0},
+		{"used up", func() (Entitlement, bool, error) { return Consume(1, metered) }, false, 0},
+		{"after a refund", func() (Entitlement, bool, error) {
+			Refund(1, metered, first)
+			return Consume(1, metered)
+		}, true, 0},
+		{"another licence", func() (Entitlement, bool, error) { return Consume(2, metered) }, true, 1},
+		{"in a period", func() (Entitlement, bool, error) { return Consume(3, monthly) }, true, 0},
+		{"period used up", func() (Entitlement, bool, error) { return Consume(3, monthly) }, false, 0},
+		{"next period", func() (Entitlement, bool, error) {
+			usage.usage["3"].PeriodStart = time.Now().Add(-monthly.Period)
+			return Consume(3, monthly)
+		}, true, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, ok, err := tt.do()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != tt.ok || e.Remaining != tt.remaining {
+				t.Errorf("got %v with %d left, want %v with %d left", ok, e.Remaining, tt.ok, tt.remaining)
+			}
+		})
+	}
+
+	// A refund for a period that has since ended isn't given back
+	stale := Entitlement{ResetsAt: time.Now().Add(-time.Hour)}
+	Refund(3, monthly, stale)
+	if e, _ := Remaining(3, monthly); e.Remaining != 0 {
+		t.Errorf("got %d left after a stale refund, want 0", e.Remaining)
+	}
+
+	// Counters survive a restart
+	if err := Flush(); err != nil {
+		t.Fatal(err)
+	}
+	usage = nil
+	if err := Start(c, nil); err != nil {
+		t.Fatal(err)
+	}
+	if e, _ := Remaining(1, metered); e.Remaining != 0 {
+		t.Errorf("got %d left after a restart, want 0", e.Remaining)
+	}
+}
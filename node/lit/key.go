@@ -59,6 +59,18 @@ func (c *Client) GetEncryptionKey(
 	return ThresholdDecrypt(shares, params.ToDecrypt, c.NetworkPubKeySet)
 }
 
+// ConditionsHash is what Lit stores a key's conditions under. Changing how
+// conditions marshal orphans every key saved before.
+func ConditionsHash(conditions []EvmContractCondition) (string, error) {
+	condJson, err := json.Marshal(conditions)
+	if err != nil {
+		return "", err
+	}
+
+	cHash := sha256.Sum256(condJson)
+	return hex.EncodeToString(cHash[:]), nil
+}
+
 func (c *Client) SaveEncryptionKey(
 	symmetricKey []byte,
 	authSig account.AuthSig,
@@ -79,15 +91,11 @@ func (c *Client) SaveEncryptionKey(
 	hash.Write(key)
 	hashStr := hex.EncodeToString(hash.Sum(nil))
 
-	condJson, err := json.Marshal(authConditions)
+	cHashStr, err := ConditionsHash(authConditions)
 	if err != nil {
 		return "", err
 	}
 
-	cHash := sha256.New()
-	cHash.Write(condJson)
-	cHashStr := hex.EncodeToString(cHash.Sum(nil))
-
 	ch := make(chan SaveCondMsg)
 
 	for url := range c.ConnectedNodes {
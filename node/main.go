@@ -4,13 +4,24 @@ import (
 	"blocksui-node/account"
 	"blocksui-node/config"
 	"blocksui-node/contracts"
+	"blocksui-node/indexer"
+	"blocksui-node/ipfs"
 	"blocksui-node/server"
+	"bufio"
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"math/big"
+	"net/http"
 	"os"
+	"os/signal"
 	"path"
 	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 )
 
 var (
@@ -27,14 +38,32 @@ var (
 	nodeFlags = flag.NewFlagSet("node", flag.ExitOnError)
 	port      = nodeFlags.String("p", ":80", "-p :8080")
 	privKey   = nodeFlags.String("pk", "", "-pk [Ethereum wallet private key]")
+
+	// Register Flags
+	registerFlags  = flag.NewFlagSet("register", flag.ExitOnError)
+	registerDryRun = registerFlags.Bool("dry-run", false, "--dry-run - Simulate the registration without sending it")
+	registerYes    = registerFlags.Bool("yes", false, "--yes - Skip the confirmation prompt")
+	registerJSON   = registerFlags.Bool("json", false, "--json - Print the transaction plan as JSON")
+
+	// Unregister Flags
+	unregisterFlags  = flag.NewFlagSet("unregister", flag.ExitOnError)
+	unregisterDryRun = unregisterFlags.Bool("dry-run", false, "--dry-run - Simulate the unregistration without sending it")
+	unregisterYes    = unregisterFlags.Bool("yes", false, "--yes - Skip the confirmation prompt")
+	unregisterJSON   = unregisterFlags.Bool("json", false, "--json - Print the transaction plan as JSON")
 )
 
+// shutdownTimeout bounds how long requests in flight get to finish.
+const shutdownTimeout = 30 * time.Second
+
 var CMDS = map[string]string{
+	"analytics":  "Export the blocks served by this node as a signed batch with export [--since day] [--until day].",
 	"balance":    "Returns the node's ether balance. Use --stake to get your staking balance.",
+	"block":      "Export a minted block as a CAR with export <tokenId>, load one with import <file.car>, or re-encrypt owned blocks under new conditions with rekey <tokenId>... | --all.",
 	"init":       "Initialize the CLI.",
 	"node":       "Runs the BUI node.",
-	"register":   "Register this node with the network.",
-	"unregister": "Unregister this node with the network.",
+	"stake":      "Manage the node stake: status, topup <amount>, withdraw <amount>, rewards, claim.",
+	"register":   "Register this node with the network. Use --dry-run to simulate, --yes to skip confirmation and --json for a plan.",
+	"unregister": "Unregister this node with the network. Use --dry-run to simulate, --yes to skip confirmation and --json for a plan.",
 	"help":       "Prints the help context.",
 }
 
@@ -88,6 +117,85 @@ func ensureInit(homeDir string) {
 	}
 }
 
+func printPlan(out io.Writer, plan *contracts.Plan, asJSON bool) {
+	if asJSON {
+		data, err := json.MarshalIndent(plan, "", "  ")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		fmt.Println(string(data))
+		return
+	}
+
+	fmt.Fprintf(out, "Simulated %s.%s at block %d\n", plan.Contract, plan.Method, plan.Block)
+	if plan.Reverted {
+		fmt.Fprintf(out, "Reverted: %s\n", plan.Revert)
+	} else if len(plan.Result) > 0 {
+		fmt.Fprintf(out, "Result: %v\n", plan.Result)
+	}
+	fmt.Fprintf(out, "Value: %s\n", plan.Value)
+	fmt.Fprintf(out, "Gas: %d @ %s\n", plan.Gas, plan.GasPrice)
+	fmt.Fprintf(out, "Total Cost: %s\n", plan.TotalCost)
+}
+
+// approve prints the plan and exits unless the transaction should be sent.
+func approve(out io.Writer, plan *contracts.Plan, dryRun, yes, asJSON bool, prompt string) {
+	printPlan(out, plan, asJSON)
+
+	if plan.Reverted {
+		os.Exit(1)
+	}
+
+	if dryRun {
+		os.Exit(0)
+	}
+
+	if !yes && !confirm(prompt) {
+		fmt.Fprintln(out, "Cancelled.")
+		os.Exit(1)
+	}
+}
+
+// parseFlags parses flags wherever they appear among args, so
+// `bui stake topup 1.5 --yes` works like `bui stake topup --yes 1.5`.
+// The positional arguments are left in fs.Args().
+func parseFlags(fs *flag.FlagSet, args []string) {
+	positionals := []string{}
+	for len(args) > 0 {
+		fs.Parse(args)
+
+		rest := fs.Args()
+		if len(rest) == 0 {
+			break
+		}
+
+		// Everything after "--" is positional
+		if i := len(args) - len(rest) - 1; i >= 0 && args[i] == "--" {
+			positionals = append(positionals, rest...)
+			break
+		}
+
+		positionals = append(positionals, rest[0])
+		args = rest[1:]
+	}
+
+	fs.Parse(append([]string{"--"}, positionals...))
+}
+
+func confirm(prompt string) bool {
+	fmt.Fprintf(os.Stderr, "%s [y/N]: ", prompt)
+
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
 func main() {
 	mainFlags.Parse(os.Args[1:])
 	c := config.New(*env)
@@ -179,70 +287,153 @@ func main() {
 
 			fmt.Printf("Account Loaded: %s\n", a.Address)
 
+			if err := indexer.Start(c); err != nil {
+				fmt.Printf("[Indexer] %v\n", err)
+			}
+
+			if chain, ok := contracts.ChainForName(c.Chain()); ok {
+				go a.WatchStake(chain, 10*time.Minute, 10)
+			}
+
+			var daemon *ipfs.Supervisor
+			if c.Store == "" || c.Store == "kubo" {
+				daemon = ipfs.NewSupervisor(c.IPFSApi)
+			}
+
+			// SIGINT and SIGTERM drain the server and save what is batched
+			// in memory, then stop the supervisor so it can't restart the
+			// daemon on the way out
+			sigs := make(chan os.Signal, 1)
+			signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+			go func() {
+				<-sigs
+				fmt.Println("Shutting down the BUI Node")
+
+				ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+				server.Shutdown(ctx)
+				cancel()
+
+				if daemon != nil {
+					daemon.Stop()
+				}
+				os.Exit(0)
+			}()
+
+			if daemon != nil {
+				if err := daemon.Start(); err != nil {
+					fmt.Printf("[IPFS] %v\n", err)
+					os.Exit(1)
+				}
+			}
+
 			fmt.Println("Starting the BUI Node")
-			server.Start(c, a)
+			if err := server.Start(c, a, daemon); err != http.ErrServerClosed {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			// The signal handler exits once the shutdown is done
+			select {}
 		case "register":
 			ensureInit(c.HomeDir)
+			registerFlags.Parse(os.Args[2:])
+
+			// Keep stdout clean for the JSON plan
+			out := os.Stdout
+			if *registerJSON {
+				out = os.Stderr
+			}
 
 			if err := contracts.LoadContracts(c); err != nil {
-				fmt.Println(err)
+				fmt.Fprintln(out, err)
 				os.Exit(1)
 			}
 
 			a, err := account.LoadAccount(c)
 			if err != nil {
-				fmt.Printf("%v\n", err)
+				fmt.Fprintf(out, "%v\n", err)
 				os.Exit(1)
 			}
 
-			fmt.Printf("Account Loaded: %s\n", a.Address)
+			fmt.Fprintf(out, "Account Loaded: %s\n", a.Address)
 
 			stake, err := contracts.CalcStake(a.Address)
 			if err != nil {
-				fmt.Printf("%v\n", err)
+				fmt.Fprintf(out, "%v\n", err)
 				os.Exit(1)
 			}
-			fmt.Printf("Stake Required: %s\n", stake)
+			fmt.Fprintf(out, "Stake Required: %s\n", stake)
 			balance, err := a.Balance()
 			if err != nil {
-				fmt.Printf("%v\n", err)
+				fmt.Fprintf(out, "%v\n", err)
 				os.Exit(1)
 			}
-			fmt.Printf("Account Balance: %s\n", balance)
+			fmt.Fprintf(out, "Account Balance: %s\n", balance)
 
-			// TODO: Ask for permission to spend the stake amount.
+			plan, err := contracts.SimulateRegister(a.Address, a.IP, stake)
+			if err != nil {
+				fmt.Fprintf(out, "[Simulate] %v\n", err)
+				os.Exit(1)
+			}
+
+			approve(out, plan, *registerDryRun, *registerYes, *registerJSON,
+				fmt.Sprintf("Spend %s to register this node?", plan.TotalCost))
 
 			if contracts.Register(a.Sender(), a.IP, stake) {
-				fmt.Println("Registration complete.")
+				fmt.Fprintln(out, "Registration complete.")
 				os.Exit(0)
 			}
 
 			os.Exit(1)
+		case "stake":
+			ensureInit(c.HomeDir)
+			stake(c, os.Args[2:])
+		case "block":
+			ensureInit(c.HomeDir)
+			block(c, os.Args[2:])
+		case "analytics":
+			ensureInit(c.HomeDir)
+			exportAnalytics(c, os.Args[2:])
 		case "unregister":
 			ensureInit(c.HomeDir)
+			unregisterFlags.Parse(os.Args[2:])
+
+			out := os.Stdout
+			if *unregisterJSON {
+				out = os.Stderr
+			}
 
 			if err := contracts.LoadContracts(c); err != nil {
-				fmt.Println(err)
+				fmt.Fprintln(out, err)
 				os.Exit(1)
 			}
 
 			a, err := account.LoadAccount(c)
 			if err != nil {
-				fmt.Printf("%v\n", err)
+				fmt.Fprintf(out, "%v\n", err)
+				os.Exit(1)
+			}
+
+			fmt.Fprintf(out, "Account Loaded: %s\n", a.Address)
+
+			plan, err := contracts.SimulateUnregister(a.Address)
+			if err != nil {
+				fmt.Fprintf(out, "[Simulate] %v\n", err)
 				os.Exit(1)
 			}
 
-			fmt.Printf("Accouna Loaded: %s\n", a.Address)
+			approve(out, plan, *unregisterDryRun, *unregisterYes, *unregisterJSON,
+				fmt.Sprintf("Spend up to %s in gas to unregister this node?", plan.TotalCost))
 
 			if contracts.Unregister(a.Sender()) {
-				fmt.Println("Successfully unregistered.")
+				fmt.Fprintln(out, "Successfully unregistered.")
 
 				balance, err := a.Balance()
 				if err != nil {
-					fmt.Printf("%v\n", err)
+					fmt.Fprintf(out, "%v\n", err)
 					os.Exit(1)
 				}
-				fmt.Printf("Your balance is now: %s\n", balance)
+				fmt.Fprintf(out, "Your balance is now: %s\n", balance)
 				os.Exit(0)
 			}
 
@@ -0,0 +1,361 @@
+package pins
+
+import (
+	"blocksui-node/config"
+	"blocksui-node/contracts"
+	"blocksui-node/indexer"
+	"blocksui-node/ipfs"
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	checkInterval = 5 * time.Minute
+	saveInterval  = 5 * time.Second
+	pinTimeout    = time.Minute
+)
+
+type Manager struct {
+	grace  time.Duration
+	remote *Remote
+	store  *Store
+	blocks ipfs.BlockStore
+}
+
+var manager *Manager
+
+// Start loads the pin records and checks them in the background. Compiled
+// content is kept until it is minted or its grace period runs out. Changes
+// to the records are saved in batches.
+func Start(c *config.Config, blocks ipfs.BlockStore) error {
+	if manager != nil {
+		return fmt.Errorf("Already initialized")
+	}
+
+	store, err := LoadStore(filepath.Join(c.HomeDir, ".bui", "pins.json"))
+	if err != nil {
+		return err
+	}
+
+	m := &Manager{
+		grace:  c.PinGrace,
+		store:  store,
+		blocks: blocks,
+	}
+
+	if c.PinServiceURL != "" {
+		m.remote = NewRemote(c.PinServiceURL, c.PinServiceToken)
+	}
+
+	manager = m
+	go m.run()
+	go m.save()
+
+	return nil
+}
+
+func (m *Manager) save() {
+	for {
+		time.Sleep(saveInterval)
+
+		if err := m.store.Save(); err != nil {
+			fmt.Printf("[pins]\t%v\n", err)
+		}
+	}
+}
+
+// Flush saves the records now, for a shutdown.
+func Flush() error {
+	if manager == nil {
+		return nil
+	}
+
+	return manager.store.Save()
+}
+
+// Track records the content from one compile and pins it locally. The
+// upload's pending entry, if any, becomes this entry.
+func Track(ctx context.Context, u *Upload, block, metadataURI string, uris ...string) error {
+	return track(ctx, u, &Entry{
+		Block:       strings.ToLower(block),
+		MetadataURI: metadataURI,
+		State:       Compiled,
+	}, uris)
+}
+
+// TrackVersion records a published upgrade of a minted block. It is kept
+// for as long as the token it belongs to, so it starts out minted.
+func TrackVersion(ctx context.Context, u *Upload, tokenId uint64, root, metadataURI string, uris ...string) error {
+	return track(ctx, u, &Entry{
+		Block:       strings.ToLower(root),
+		MetadataURI: metadataURI,
+		State:       Minted,
+		TokenId:     tokenId,
+	}, uris)
+}
+
+// TrackUpdate records new metadata for a minted token. Like a compile it
+// is only kept once the token URI points at it.
+func TrackUpdate(ctx context.Context, u *Upload, tokenId uint64, root, metadataURI string, uris ...string) error {
+	return track(ctx, u, &Entry{
+		Block:       strings.ToLower(root),
+		MetadataURI: metadataURI,
+		State:       Compiled,
+		TokenId:     tokenId,
+	}, uris)
+}
+
+func track(ctx context.Context, u *Upload, e *Entry, uris []string) error {
+	if manager == nil {
+		return nil
+	}
+
+	var cids []string
+	if u != nil {
+		cids = u.Cids()
+	}
+	for _, uri := range append(uris, e.MetadataURI) {
+		if cid := strings.TrimPrefix(uri, "ipfs://"); cid != "" {
+			cids = appendUnique(cids, cid)
+		}
+	}
+
+	for _, cid := range cids {
+		if err := manager.blocks.Pin(ctx, cid); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	e.Cids = cids
+	e.FromBlock = indexer.Block()
+	e.CreatedAt = now
+	e.UpdatedAt = now
+
+	pending := ""
+	if u != nil {
+		pending = u.key
+		if p, ok := manager.store.Snapshot()[pending]; ok {
+			e.FromBlock = p.FromBlock
+			e.CreatedAt = p.CreatedAt
+		}
+	}
+	manager.store.Replace(pending, strings.TrimPrefix(e.MetadataURI, "ipfs://"), e)
+
+	return nil
+}
+
+func appendUnique(list []string, v string) []string {
+	for _, item := range list {
+		if item == v {
+			return list
+		}
+	}
+
+	return append(list, v)
+}
+
+// Tracked reports whether an entry that hasn't been orphaned holds cid.
+func Tracked(cid string) bool {
+	if manager == nil {
+		return false
+	}
+
+	for _, e := range manager.store.Snapshot() {
+		if e.State == Orphaned {
+			continue
+		}
+
+		for _, c := range e.Cids {
+			if c == cid {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (m *Manager) run() {
+	m.restore()
+
+	for {
+		m.check()
+		time.Sleep(checkInterval)
+	}
+}
+
+// restore re-pins everything still wanted, in case the store lost its pins,
+// such as the memory store or a fresh Kubo repo.
+func (m *Manager) restore() {
+	for _, e := range m.store.Snapshot() {
+		if e.State == Orphaned {
+			continue
+		}
+
+		for _, cid := range e.Cids {
+			ctx, cancel := context.WithTimeout(context.Background(), pinTimeout)
+			if err := m.blocks.Pin(ctx, cid); err != nil {
+				fmt.Printf("[pins]\tFailed to restore pin %s: %v\n", cid, err)
+			}
+			cancel()
+		}
+	}
+}
+
+func (m *Manager) check() {
+	entries := m.store.Snapshot()
+
+	for key, e := range entries {
+		if e.State == Compiled {
+			tokenId, ok := m.minted(e)
+			if !ok {
+				if time.Since(e.CreatedAt) <= m.grace {
+					continue
+				}
+
+				// Unpinning can't be undone, so a miss in the index is
+				// confirmed on chain first
+				var err error
+				if tokenId, ok, err = m.mintedLive(e); err != nil {
+					fmt.Printf("[pins]\tCould not confirm block %s: %v\n", key, err)
+					continue
+				} else if !ok {
+					fmt.Printf("[pins]\tBlock %s was never minted with this metadata, unpinning\n", key)
+					m.orphan(key, e, entries)
+					continue
+				}
+			}
+
+			fmt.Printf("[pins]\tBlock %s minted as token %d\n", key, tokenId)
+			m.store.Update(key, func(e *Entry) {
+				e.State = Minted
+				e.TokenId = tokenId
+			})
+			e.State = Minted
+			e.TokenId = tokenId
+		}
+
+		if e.State == Minted && m.remote != nil && !e.RemotePinned {
+			if err := m.pinRemote(key, e); err != nil {
+				fmt.Printf("[pins]\t%v\n", err)
+				continue
+			}
+
+			m.store.Update(key, func(e *Entry) { e.RemotePinned = true })
+		}
+	}
+}
+
+// minted reports whether a token was minted for the block with this
+// compile's metadata as its tokenURI.
+func (m *Manager) minted(e Entry) (uint64, bool) {
+	if e.Block == "" {
+		return 0, false
+	}
+
+	tokenId, ok := indexer.TokenForCid("BUIBlockNFT", e.Block)
+	if !ok {
+		return 0, false
+	}
+
+	uri, ok := indexer.TokenURI("BUIBlockNFT", tokenId)
+	if !ok {
+		cnt, ok := contracts.GetContract("BUIBlockNFT")
+		if !ok {
+			return 0, false
+		}
+
+		result, err := cnt.Call("tokenURI", tokenId)
+		if err != nil {
+			return 0, false
+		}
+
+		uri = result["0"].(string)
+		indexer.SetTokenURI("BUIBlockNFT", tokenId, uri)
+	}
+
+	return tokenId, uri == e.MetadataURI
+}
+
+// mintedLive looks for the mint on chain rather than in the index, from
+// the block the index had reached when the compile was tracked.
+func (m *Manager) mintedLive(e Entry) (uint64, bool, error) {
+	// The compile failed before it produced a block
+	if e.Block == "" {
+		return 0, false, nil
+	}
+
+	// Metadata updates are for a token minted before they were tracked
+	tokenId := e.TokenId
+	if tokenId == 0 {
+		var ok bool
+		var err error
+		if tokenId, ok, err = indexer.FindToken("BUIBlockNFT", e.Block, e.FromBlock); err != nil || !ok {
+			return 0, false, err
+		}
+	}
+
+	cnt, ok := contracts.GetContract("BUIBlockNFT")
+	if !ok {
+		return 0, false, fmt.Errorf("Contract not found BUIBlockNFT")
+	}
+
+	result, err := cnt.Call("tokenURI", tokenId)
+	if err != nil {
+		return 0, false, err
+	}
+
+	uri := result["0"].(string)
+	indexer.SetTokenURI("BUIBlockNFT", tokenId, uri)
+
+	return tokenId, uri == e.MetadataURI, nil
+}
+
+// orphan unpins the entry's content, except CIDs another live entry still
+// uses, such as the same image uploaded twice.
+func (m *Manager) orphan(key string, e Entry, entries map[string]Entry) {
+	inUse := make(map[string]bool)
+	for k, other := range entries {
+		if k == key || other.State == Orphaned {
+			continue
+		}
+
+		for _, cid := range other.Cids {
+			inUse[cid] = true
+		}
+	}
+
+	for _, cid := range e.Cids {
+		if inUse[cid] {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), pinTimeout)
+		if err := m.blocks.Unpin(ctx, cid); err != nil {
+			fmt.Printf("[pins]\tFailed to unpin %s: %v\n", cid, err)
+		}
+		cancel()
+	}
+
+	m.store.Update(key, func(e *Entry) { e.State = Orphaned })
+}
+
+func (m *Manager) pinRemote(key string, e Entry) error {
+	for _, cid := range e.Cids {
+		ctx, cancel := context.WithTimeout(context.Background(), pinTimeout)
+		err := m.remote.Pin(ctx, cid, fmt.Sprintf("bui-token-%d", e.TokenId))
+		cancel()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("[pins]\tBlock %s pinned to the remote service\n", key)
+
+	return nil
+}
@@ -0,0 +1,41 @@
+package pins
+
+import (
+	"blocksui-node/ipfs"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTrackUpdate(t *testing.T) {
+	ctx := context.Background()
+
+	store, err := LoadStore(filepath.Join(t.TempDir(), "pins.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blocks := ipfs.NewMemStore()
+	manager = &Manager{store: store, blocks: blocks}
+	defer func() { manager = nil }()
+
+	meta, err := blocks.Put(ctx, strings.NewReader(`{"name":"updated"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := TrackUpdate(ctx, nil, 7, "0xAA", "ipfs://"+meta); err != nil {
+		t.Fatal(err)
+	}
+
+	e, ok := store.Snapshot()[meta]
+	if !ok {
+		t.Fatalf("got no entry for %s", meta)
+	}
+
+	// Kept only once the token URI points at it, like a compile
+	if e.State != Compiled || e.TokenId != 7 || e.Block != "0xaa" {
+		t.Errorf("got %s token %d block %s, want %s token 7 block 0xaa", e.State, e.TokenId, e.Block, Compiled)
+	}
+}
@@ -0,0 +1,60 @@
+package pins
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Remote is a client for a service implementing the IPFS Pinning Service
+// API, such as Pinata or Filebase.
+type Remote struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+func NewRemote(url, token string) *Remote {
+	return &Remote{
+		url:    strings.TrimRight(url, "/"),
+		token:  token,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+type pinRequest struct {
+	Cid  string `json:"cid"`
+	Name string `json:"name,omitempty"`
+}
+
+// Pin queues the CID on the service. The service fetches it from the
+// network in its own time so success does not mean the pin is complete.
+func (r *Remote) Pin(ctx context.Context, cid, name string) error {
+	body, err := json.Marshal(pinRequest{cid, name})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", r.url+"/pins", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+r.token)
+
+	res, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusAccepted && res.StatusCode != http.StatusOK {
+		return fmt.Errorf("Pinning service returned %d for %s", res.StatusCode, cid)
+	}
+
+	return nil
+}
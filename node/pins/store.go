@@ -0,0 +1,140 @@
+package pins
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	Compiled = "compiled"
+	Minted   = "minted"
+	Orphaned = "orphaned"
+)
+
+// Entry is everything one call to /blocks/compile added to the store. It is
+// keyed by the metadata CID since that is what ends up in the tokenURI.
+type Entry struct {
+	Block        string    `json:"block"`
+	MetadataURI  string    `json:"metadataURI"`
+	Cids         []string  `json:"cids"`
+	State        string    `json:"state"`
+	TokenId      uint64    `json:"tokenId,omitempty"`
+	RemotePinned bool      `json:"remotePinned,omitempty"`
+	FromBlock    uint64    `json:"fromBlock,omitempty"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+type Store struct {
+	Entries map[string]*Entry `json:"entries"`
+
+	path   string
+	mu     sync.RWMutex
+	dirty  bool
+	saving sync.Mutex
+}
+
+func LoadStore(path string) (*Store, error) {
+	s := &Store{
+		Entries: make(map[string]*Entry),
+		path:    path,
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Save writes the entries when they changed since the last save.
+func (s *Store) Save() error {
+	s.saving.Lock()
+	defer s.saving.Unlock()
+
+	s.mu.Lock()
+	if !s.dirty {
+		s.mu.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(s)
+	s.dirty = false
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err = os.MkdirAll(filepath.Dir(s.path), 0755); err == nil {
+		if err = os.WriteFile(tmp, data, 0644); err == nil {
+			err = os.Rename(tmp, s.path)
+		}
+	}
+
+	if err != nil {
+		// Try again on the next save
+		s.mu.Lock()
+		s.dirty = true
+		s.mu.Unlock()
+	}
+
+	return err
+}
+
+func (s *Store) Add(key string, e *Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Entries[key] = e
+	s.dirty = true
+}
+
+// Replace swaps the entry under from for e under key. An empty from only
+// adds, a nil e only removes.
+func (s *Store) Replace(from, key string, e *Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if from != "" {
+		delete(s.Entries, from)
+	}
+	if e != nil {
+		s.Entries[key] = e
+	}
+	s.dirty = true
+}
+
+// Snapshot copies the entries so they can be checked without holding the
+// lock across network calls.
+func (s *Store) Snapshot() map[string]Entry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries := make(map[string]Entry, len(s.Entries))
+	for k, e := range s.Entries {
+		entries[k] = *e
+	}
+
+	return entries
+}
+
+func (s *Store) Update(key string, fn func(e *Entry)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.Entries[key]; ok {
+		fn(e)
+		e.UpdatedAt = time.Now()
+		s.dirty = true
+	}
+}
@@ -0,0 +1,98 @@
+package pins
+
+import (
+	"blocksui-node/indexer"
+	"blocksui-node/ipfs"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"sync"
+	"time"
+)
+
+// Upload is a store that pins and records every CID put into it under one
+// pending entry, in the same step as the put. A request that fails halfway
+// leaves an entry the pin manager unpins, never untracked pins, unless the
+// node dies before the next batched save.
+type Upload struct {
+	ipfs.BlockStore
+	key string
+
+	mu   sync.Mutex
+	cids []string
+}
+
+// Begin starts an upload to store. Track or TrackVersion turn its pending
+// entry into the entry for the finished compile.
+func Begin(store ipfs.BlockStore) *Upload {
+	id := make([]byte, 8)
+	rand.Read(id)
+
+	u := &Upload{BlockStore: store, key: "pending-" + hex.EncodeToString(id)}
+
+	if manager != nil {
+		now := time.Now()
+		manager.store.Add(u.key, &Entry{
+			Cids:      []string{},
+			State:     Compiled,
+			FromBlock: indexer.Block(),
+			CreatedAt: now,
+			UpdatedAt: now,
+		})
+	}
+
+	return u
+}
+
+func (u *Upload) Put(ctx context.Context, r io.Reader) (string, error) {
+	cid, err := u.BlockStore.Put(ctx, r)
+	if err != nil {
+		return "", err
+	}
+
+	u.mu.Lock()
+	u.cids = appendUnique(u.cids, cid)
+	u.mu.Unlock()
+
+	if manager == nil {
+		return cid, nil
+	}
+
+	if err := u.BlockStore.Pin(ctx, cid); err != nil {
+		return "", err
+	}
+
+	manager.store.Update(u.key, func(e *Entry) { e.Cids = appendUnique(e.Cids, cid) })
+
+	return cid, nil
+}
+
+func (u *Upload) Cids() []string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return append([]string{}, u.cids...)
+}
+
+// Discard unpins what a failed request added, except CIDs another entry
+// uses. It does nothing once the upload has been tracked.
+func (u *Upload) Discard() {
+	if manager == nil {
+		for _, cid := range u.Cids() {
+			ctx, cancel := context.WithTimeout(context.Background(), pinTimeout)
+			u.BlockStore.Unpin(ctx, cid)
+			cancel()
+		}
+		return
+	}
+
+	entries := manager.store.Snapshot()
+	e, ok := entries[u.key]
+	if !ok {
+		return
+	}
+
+	manager.orphan(u.key, e, entries)
+	manager.store.Replace(u.key, "", nil)
+}
@@ -0,0 +1,79 @@
+package pins
+
+import (
+	"blocksui-node/ipfs"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiscard(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "pins.json")
+
+	store, err := LoadStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blocks := ipfs.NewMemStore()
+	manager = &Manager{store: store, blocks: blocks}
+	defer func() { manager = nil }()
+
+	// An image another compile already uploaded
+	shared, err := blocks.Put(ctx, strings.NewReader("shared image"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := blocks.Pin(ctx, shared); err != nil {
+		t.Fatal(err)
+	}
+	store.Add("meta", &Entry{Cids: []string{shared}, State: Compiled})
+
+	u := Begin(blocks)
+	if _, err := u.Put(ctx, strings.NewReader("shared image")); err != nil {
+		t.Fatal(err)
+	}
+	own, err := u.Put(ctx, strings.NewReader("only this upload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("got %v, want the records left for the batched save", err)
+	}
+
+	u.Discard()
+
+	tests := []struct {
+		name string
+		cid  string
+		kept bool
+	}{
+		{"shared", shared, true},
+		{"own", own, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := blocks.Stat(ctx, tt.cid)
+			if kept := err == nil; kept != tt.kept {
+				t.Errorf("got kept %v, want %v", kept, tt.kept)
+			}
+		})
+	}
+
+	if err := Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	saved, err := LoadStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := saved.Entries[u.key]; ok || len(saved.Entries) != 1 {
+		t.Errorf("got %d saved entries, want only the other compile's", len(saved.Entries))
+	}
+}
@@ -0,0 +1,111 @@
+package primitives
+
+import (
+	"blocksui-node/ipfs"
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"mime"
+	"path"
+	"sort"
+)
+
+var contentTypes = map[string]string{
+	".css":  "text/css; charset=utf-8",
+	".js":   "text/javascript; charset=utf-8",
+	".json": "application/json",
+	".map":  "application/json",
+	".svg":  "image/svg+xml",
+	".wasm": "application/wasm",
+}
+
+type File struct {
+	Path        string `json:"path"`
+	ContentType string `json:"contentType"`
+	Hash        string `json:"sha256"`
+	Integrity   string `json:"integrity"`
+	Size        int    `json:"size"`
+
+	data []byte
+}
+
+func (f *File) Data() []byte {
+	return f.data
+}
+
+// ETag is strong since the hash covers the exact bytes served.
+func (f *File) ETag() string {
+	return `"` + f.Hash + `"`
+}
+
+type Manifest struct {
+	Cid   string  `json:"cid"`
+	Files []*File `json:"files"`
+}
+
+// Bundle is a primitives build held in memory, indexed by path within the
+// bundle, such as blocks/Button.js.
+type Bundle struct {
+	Cid   string
+	files map[string]*File
+}
+
+// Load reads the whole bundle from the store once.
+func Load(ctx context.Context, store ipfs.BlockStore, cid string) (*Bundle, error) {
+	data, err := ipfs.ReadFiles(ctx, store, cid)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Bundle{
+		Cid:   cid,
+		files: make(map[string]*File, len(data)),
+	}
+
+	for p, d := range data {
+		sum := sha256.Sum256(d)
+		sri := sha512.Sum384(d)
+
+		b.files[p] = &File{
+			Path:        p,
+			ContentType: contentType(p),
+			Hash:        hex.EncodeToString(sum[:]),
+			Integrity:   "sha384-" + base64.StdEncoding.EncodeToString(sri[:]),
+			Size:        len(d),
+			data:        d,
+		}
+	}
+
+	return b, nil
+}
+
+func contentType(p string) string {
+	ext := path.Ext(p)
+	if t, ok := contentTypes[ext]; ok {
+		return t
+	}
+
+	if t := mime.TypeByExtension(ext); t != "" {
+		return t
+	}
+
+	return "application/octet-stream"
+}
+
+func (b *Bundle) File(p string) (*File, bool) {
+	f, ok := b.files[p]
+	return f, ok
+}
+
+func (b *Bundle) Manifest() Manifest {
+	files := make([]*File, 0, len(b.files))
+	for _, f := range b.files {
+		files = append(files, f)
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+
+	return Manifest{b.Cid, files}
+}
@@ -0,0 +1,40 @@
+package primitives
+
+import (
+	"blocksui-node/ipfs"
+	"context"
+	"crypto/sha512"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	ctx := context.Background()
+	s := ipfs.NewMemStore()
+
+	data := "export const Button = () => null"
+	cid, err := s.Put(ctx, strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := Load(ctx, s, cid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, ok := b.File("")
+	if !ok {
+		t.Fatalf("got files %v, want the bundle's one file", b.Manifest().Files)
+	}
+
+	sum := sha512.Sum384([]byte(data))
+	want := "sha384-" + base64.StdEncoding.EncodeToString(sum[:])
+	if f.Integrity != want {
+		t.Errorf("got integrity %s, want %s", f.Integrity, want)
+	}
+	if string(f.Data()) != data || f.Size != len(data) {
+		t.Errorf("got %q, want %q", f.Data(), data)
+	}
+}
@@ -0,0 +1,216 @@
+package primitives
+
+import (
+	"blocksui-node/config"
+	"blocksui-node/ipfs"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	loadTimeout = 2 * time.Minute
+	retryDelay  = 30 * time.Second
+)
+
+// state is what survives a restart: every bundle an admin loaded, the
+// version labels pointing at them and which one is the default.
+type state struct {
+	Default  string            `json:"default"`
+	Cids     []string          `json:"cids"`
+	Versions map[string]string `json:"versions"`
+}
+
+type Info struct {
+	Cid      string   `json:"cid"`
+	Versions []string `json:"versions"`
+	Default  bool     `json:"default"`
+	Loaded   bool     `json:"loaded"`
+	Files    int      `json:"files"`
+}
+
+var (
+	mu        sync.RWMutex
+	store     ipfs.BlockStore
+	statePath string
+	saved     state
+	bundles   = make(map[string]*Bundle)
+)
+
+// Start loads the saved bundles, plus PRIMITIVES_CID, in the background,
+// retrying each until it succeeds so a slow store doesn't hold up the node.
+// PRIMITIVES_CID is only the default until an admin picks another.
+func Start(c *config.Config, s ipfs.BlockStore) error {
+	store = s
+	statePath = filepath.Join(c.HomeDir, ".bui", "primitives.json")
+	saved = state{Versions: make(map[string]string)}
+
+	data, err := os.ReadFile(statePath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	} else if err == nil {
+		if err := json.Unmarshal(data, &saved); err != nil {
+			return err
+		}
+		if saved.Versions == nil {
+			saved.Versions = make(map[string]string)
+		}
+	}
+
+	if c.PrimitivesCID != "" {
+		if saved.Default == "" {
+			saved.Default = c.PrimitivesCID
+		}
+		saved.Cids = appendUnique(saved.Cids, c.PrimitivesCID)
+	}
+
+	if len(saved.Cids) == 0 {
+		fmt.Println("[primitives]\tPRIMITIVES_CID is not set")
+	}
+
+	for _, cid := range saved.Cids {
+		go load(cid)
+	}
+
+	return nil
+}
+
+func appendUnique(list []string, v string) []string {
+	for _, item := range list {
+		if item == v {
+			return list
+		}
+	}
+
+	return append(list, v)
+}
+
+func load(cid string) {
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), loadTimeout)
+		b, err := Load(ctx, store, cid)
+		cancel()
+
+		if err == nil {
+			mu.Lock()
+			bundles[cid] = b
+			mu.Unlock()
+
+			fmt.Printf("[primitives]\tLoaded %s (%d files)\n", b.Cid, len(b.files))
+			return
+		}
+
+		fmt.Printf("[primitives]\tFailed to load %s: %v\n", cid, err)
+		time.Sleep(retryDelay)
+	}
+}
+
+// Resolve turns a version selector into a bundle CID. The selector is a
+// version label or a CID; an empty one means the default bundle.
+func Resolve(selector string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return resolve(selector)
+}
+
+func resolve(selector string) string {
+	if selector == "" {
+		return saved.Default
+	}
+
+	if cid, ok := saved.Versions[selector]; ok {
+		return cid
+	}
+
+	return selector
+}
+
+// Get returns the bundle for a selector, or false if it isn't loaded.
+func Get(selector string) (*Bundle, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	b, ok := bundles[resolve(selector)]
+	return b, ok
+}
+
+// Add loads a bundle while the node keeps serving the others, then
+// records it. version labels it and makeDefault switches unversioned
+// requests over to it.
+func Add(ctx context.Context, cid, version string, makeDefault bool) (*Bundle, error) {
+	b, err := Load(ctx, store, cid)
+	if err != nil {
+		return nil, err
+	}
+
+	mu.Lock()
+	bundles[cid] = b
+	saved.Cids = appendUnique(saved.Cids, cid)
+	if version != "" {
+		saved.Versions[version] = cid
+	}
+	if makeDefault {
+		saved.Default = cid
+	}
+	mu.Unlock()
+
+	fmt.Printf("[primitives]\tAdded %s (%d files)\n", cid, len(b.files))
+
+	return b, save()
+}
+
+func save() error {
+	mu.RLock()
+	data, err := json.Marshal(saved)
+	mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(statePath), 0755); err != nil {
+		return err
+	}
+
+	tmp := statePath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, statePath)
+}
+
+func List() []Info {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	list := make([]Info, 0, len(saved.Cids))
+	for _, cid := range saved.Cids {
+		info := Info{
+			Cid:      cid,
+			Versions: []string{},
+			Default:  cid == saved.Default,
+		}
+
+		for version, vcid := range saved.Versions {
+			if vcid == cid {
+				info.Versions = append(info.Versions, version)
+			}
+		}
+		sort.Strings(info.Versions)
+
+		if b, ok := bundles[cid]; ok {
+			info.Loaded = true
+			info.Files = len(b.files)
+		}
+
+		list = append(list, info)
+	}
+
+	return list
+}
@@ -0,0 +1,70 @@
+package primitives
+
+import (
+	"blocksui-node/config"
+	"blocksui-node/ipfs"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestAdd(t *testing.T) {
+	ctx := context.Background()
+	s := ipfs.NewMemStore()
+
+	put := func(data string) string {
+		cid, err := s.Put(ctx, strings.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cid
+	}
+	v1, v2, v3 := put("button v1"), put("button v2"), put("button v3")
+
+	c := &config.Config{HomeDir: t.TempDir(), PrimitivesCID: v1}
+	if err := Start(c, s); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Add(ctx, v2, "2.0.0", false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Add(ctx, v3, "3.0.0", true); err != nil {
+		t.Fatal(err)
+	}
+
+	// PRIMITIVES_CID no longer picks the default once an admin has
+	restart := func() {
+		mu.Lock()
+		bundles = make(map[string]*Bundle)
+		mu.Unlock()
+
+		if err := Start(c, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, run := range []string{"added", "after a restart"} {
+		if run == "after a restart" {
+			restart()
+		}
+
+		tests := []struct {
+			selector string
+			want     string
+		}{
+			{"", v3},
+			{"2.0.0", v2},
+			{v1, v1},
+			{"9.9.9", "9.9.9"},
+		}
+
+		for _, tt := range tests {
+			t.Run(run+" "+tt.selector, func(t *testing.T) {
+				if got := Resolve(tt.selector); got != tt.want {
+					t.Errorf("got %s, want %s", got, tt.want)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,164 @@
+// Package render turns a block document into static HTML for readers
+// without JavaScript, such as crawlers and no-JS embeds. Each primitive is
+// rendered by the template registered under its name.
+package render
+
+import (
+	"blocksui-node/blocks"
+	"bytes"
+	"fmt"
+	"html/template"
+	"strings"
+	"sync"
+)
+
+// Node is what a primitive's template is executed with. Children holds the
+// component's children, already rendered.
+type Node struct {
+	Id        string
+	Primitive string
+	Props     map[string]interface{}
+	Children  template.HTML
+}
+
+// Options for rendering. Gateway is used to link ipfs:// URLs in props.
+type Options struct {
+	Gateway string
+}
+
+var (
+	mu        sync.RWMutex
+	templates = make(map[string]*template.Template)
+	fallback  *template.Template
+)
+
+// attrs is shared by every template so rendered primitives can be styled
+// by blocksui.css and targeted by id.
+const attrs = `{{define "attrs"}} class="bui-{{lower .Primitive}}"{{with .Id}} id="{{.}}"{{end}}{{end}}`
+
+func base(opts Options) template.FuncMap {
+	return template.FuncMap{
+		"lower": strings.ToLower,
+		"url": func(v interface{}) string {
+			s, _ := v.(string)
+			if strings.HasPrefix(s, "ipfs://") {
+				if opts.Gateway == "" {
+					return ""
+				}
+				return opts.Gateway + "/ipfs/" + strings.TrimPrefix(s, "ipfs://")
+			}
+			return s
+		},
+		"level": func(v interface{}) int {
+			n := 2
+			fmt.Sscan(fmt.Sprint(v), &n)
+			if n < 1 || n > 6 {
+				n = 2
+			}
+			return n
+		},
+	}
+}
+
+func parse(name, text string) (*template.Template, error) {
+	t, err := template.New(name).Funcs(base(Options{})).Parse(attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	return t.New(name).Parse(text)
+}
+
+// Register adds or replaces the template for a primitive.
+func Register(primitive, text string) error {
+	t, err := parse(primitive, text)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	templates[primitive] = t
+	mu.Unlock()
+
+	return nil
+}
+
+func lookup(primitive string) *template.Template {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if t, ok := templates[primitive]; ok {
+		return t
+	}
+
+	return fallback
+}
+
+// Render renders the document's components. References must have been
+// resolved first; unresolved ones are left out.
+func Render(doc *blocks.Document, opts Options) (template.HTML, error) {
+	return components(doc.Components, opts)
+}
+
+func components(list []*blocks.Component, opts Options) (template.HTML, error) {
+	var buf bytes.Buffer
+
+	for _, c := range list {
+		if c.Ref != "" {
+			if c.Block == nil {
+				continue
+			}
+
+			inner, err := components(c.Block.Components, opts)
+			if err != nil {
+				return "", err
+			}
+
+			if err := blockTemplate.Execute(&buf, Node{Id: c.Id, Primitive: "block", Props: map[string]interface{}{"ref": c.Ref}, Children: inner}); err != nil {
+				return "", err
+			}
+			continue
+		}
+
+		children, err := components(c.Children, opts)
+		if err != nil {
+			return "", err
+		}
+
+		t, err := lookup(c.Primitive).Clone()
+		if err != nil {
+			return "", err
+		}
+
+		node := Node{c.Id, c.Primitive, c.Props, children}
+		if err := t.Funcs(base(opts)).ExecuteTemplate(&buf, t.Name(), node); err != nil {
+			return "", fmt.Errorf("Rendering %s: %v", c.Primitive, err)
+		}
+	}
+
+	// Safe: every piece was produced by html/template
+	return template.HTML(buf.String()), nil
+}
+
+// Stylesheet is blocksui.css either inlined or linked with its SRI hash.
+type Stylesheet struct {
+	Inline    template.CSS
+	Href      string
+	Integrity string
+}
+
+type page struct {
+	Title string
+	CSS   Stylesheet
+	Body  template.HTML
+}
+
+// Page wraps rendered components in a standalone HTML document.
+func Page(title string, body template.HTML, css Stylesheet) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := pageTemplate.Execute(&buf, page{title, css, body}); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
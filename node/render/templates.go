@@ -0,0 +1,51 @@
+package render
+
+import "html/template"
+
+// builtin covers the primitives that render without JavaScript. Anything
+// else falls back to a plain container so its children still show.
+var builtin = map[string]string{
+	"Box":       `<div{{template "attrs" .}}>{{.Children}}</div>`,
+	"Container": `<div{{template "attrs" .}}>{{.Children}}</div>`,
+	"Row":       `<div{{template "attrs" .}}>{{.Children}}</div>`,
+	"Column":    `<div{{template "attrs" .}}>{{.Children}}</div>`,
+	"Text":      `<p{{template "attrs" .}}>{{.Props.text}}{{.Children}}</p>`,
+	"Heading":   `<div{{template "attrs" .}} role="heading" aria-level="{{level .Props.level}}">{{.Props.text}}{{.Children}}</div>`,
+	"Button":    `<button{{template "attrs" .}} type="button">{{.Props.label}}{{.Children}}</button>`,
+	"Link":      `<a{{template "attrs" .}} href="{{url .Props.href}}" rel="noopener">{{.Props.label}}{{.Children}}</a>`,
+	"Image":     `<img{{template "attrs" .}} src="{{url .Props.src}}" alt="{{.Props.alt}}" loading="lazy">`,
+	"List":      `<ul{{template "attrs" .}}>{{.Children}}</ul>`,
+	"ListItem":  `<li{{template "attrs" .}}>{{.Props.text}}{{.Children}}</li>`,
+}
+
+var (
+	blockTemplate = template.Must(parse("block", `<div{{template "attrs" .}} data-block="{{.Props.ref}}">{{.Children}}</div>`))
+
+	pageTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+{{- if .CSS.Inline}}
+<style>{{.CSS.Inline}}</style>
+{{- else if .CSS.Href}}
+<link rel="stylesheet" href="{{.CSS.Href}}" integrity="{{.CSS.Integrity}}" crossorigin="anonymous">
+{{- end}}
+</head>
+<body>
+<main class="bui-root">{{.Body}}</main>
+</body>
+</html>
+`))
+)
+
+func init() {
+	fallback = template.Must(parse("fallback", `<div{{template "attrs" .}} data-primitive="{{.Primitive}}">{{.Children}}</div>`))
+
+	for name, text := range builtin {
+		if err := Register(name, text); err != nil {
+			panic(err)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"blocksui-node/account"
+	"blocksui-node/analytics"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const analyticsDays = 30
+
+// RecordServe logs the block once the rest of the chain has served it.
+// Failed and refused reads aren't counted.
+func RecordServe(r *gin.Context) {
+	params := r.MustGet("params").(AuthParams)
+
+	r.Next()
+
+	if r.IsAborted() || r.Writer.Status() != 200 {
+		return
+	}
+
+	if err := analytics.Record(params.BlockCID, params.TokenId, params.Type, params.Origin); err != nil {
+		fmt.Printf("[analytics]\t%v\n", err)
+	}
+}
+
+// queryDays reads ?since= and ?until= as YYYY-MM-DD, defaulting to the
+// last 30 days.
+func queryDays(r *gin.Context) (time.Time, time.Time, error) {
+	until := time.Now().UTC()
+	if v := r.Query("until"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("until must be a date as YYYY-MM-DD")
+		}
+		until = t
+	}
+
+	since := until.AddDate(0, 0, -(analyticsDays - 1))
+	if v := r.Query("since"); v != "" {
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("since must be a date as YYYY-MM-DD")
+		}
+		since = t
+	}
+
+	if since.After(until) {
+		return time.Time{}, time.Time{}, fmt.Errorf("since must not be after until")
+	}
+
+	return since, until, nil
+}
+
+// BlockAnalytics serves the creator's block's serves per origin and day.
+func BlockAnalytics(r *gin.Context) {
+	params := r.MustGet("params").(AuthParams)
+
+	since, until, err := queryDays(r)
+	if err != nil {
+		r.AbortWithError(422, err)
+		return
+	}
+
+	stats, err := analytics.Stats(params.BlockCID, since, until)
+	if err != nil {
+		r.AbortWithError(503, err)
+		return
+	}
+
+	r.JSON(200, stats)
+}
+
+// ExportAnalytics serves every aggregate in the range as a batch signed by
+// the node.
+func ExportAnalytics(a *account.Account) gin.HandlerFunc {
+	return func(r *gin.Context) {
+		since, until, err := queryDays(r)
+		if err != nil {
+			r.AbortWithError(422, err)
+			return
+		}
+
+		batch, err := analytics.Export(a, since, until)
+		if err != nil {
+			r.AbortWithError(503, err)
+			return
+		}
+
+		r.JSON(200, batch)
+	}
+}
@@ -1,13 +1,15 @@
 package server
 
 import (
-	"blocksui-node/abi"
 	"blocksui-node/account"
 	"blocksui-node/config"
 	"blocksui-node/contracts"
+	"blocksui-node/indexer"
+	"blocksui-node/licenses"
 	"blocksui-node/lit"
 	"crypto/hmac"
 	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/hex"
 	"fmt"
 	"strconv"
@@ -19,10 +21,13 @@ import (
 	"github.com/umbracle/ethgo"
 )
 
+// AuthParams identify a read of a block. TokenId is the block's token;
+// LicenseId is the licence token it is read under, when Type is license.
 type AuthParams struct {
 	Address   ethgo.Address `json:"address" binding:"required"`
 	BlockCID  string        `json:"cid" binding:"required"`
 	TokenId   uint64        `json:"tokenId" binding:"required"`
+	LicenseId uint64        `json:"licenseId"`
 	Chain     string        `json:"chain" binding:"required"`
 	IssueDate string        `json:"issueDate" binding:"required"`
 	Origin    string        `json:"origin" binding:"required"`
@@ -79,6 +84,26 @@ func SignMessage(a *account.Account) gin.HandlerFunc {
 	}
 }
 
+// nodeCondition releases the network key to staked nodes.
+func nodeCondition(cnt *contracts.Contract, chain string) (lit.EvmContractCondition, error) {
+	member, ok := cnt.Member("verify")
+	if !ok {
+		return lit.EvmContractCondition{}, fmt.Errorf("ABI Method not found")
+	}
+
+	return lit.EvmContractCondition{
+		ContractAddress: cnt.Address.String(),
+		Chain:           chain,
+		FunctionName:    "verify",
+		FunctionParams:  []string{":userAddress"},
+		FunctionAbi:     member,
+		ReturnValueTest: lit.ReturnValueTest{
+			Comparator: "=",
+			Value:      "true",
+		},
+	}, nil
+}
+
 func AuthenticateNode(c *config.Config, a *account.Account) gin.HandlerFunc {
 	return func(r *gin.Context) {
 		cnt, ok := contracts.GetContract("BUINodeStaking")
@@ -94,24 +119,12 @@ func AuthenticateNode(c *config.Config, a *account.Account) gin.HandlerFunc {
 			return
 		}
 
-		method := cnt.Abi.GetMethod("verify")
-		if method == nil {
-			r.AbortWithError(500, fmt.Errorf("ABI Method not found"))
+		condition, err := nodeCondition(cnt, c.Chain())
+		if err != nil {
+			r.AbortWithError(500, err)
 			return
 		}
 
-		condition := lit.EvmContractCondition{
-			ContractAddress: cnt.Address.String(),
-			Chain:           c.Chain(),
-			FunctionName:    "verify",
-			FunctionParams:  []string{":userAddress"},
-			FunctionAbi:     abi.MethodToMember(method),
-			ReturnValueTest: lit.ReturnValueTest{
-				Comparator: "=",
-				Value:      "true",
-			},
-		}
-
 		// TODO: need a chainId <> name map
 		authSig, err := a.Siwe("80001", "")
 		if err != nil {
@@ -192,28 +205,50 @@ func AuthenticateBlock(r *gin.Context) {
 		return
 	}
 
-	cnt, ok := contracts.GetContract(contractName)
-	if !ok {
-		r.AbortWithError(404, fmt.Errorf("Contract not found %s", contractName))
+	if params.Type == "license" && params.LicenseId == 0 {
+		r.AbortWithError(422, fmt.Errorf("licenseId is required for licence reads"))
 		return
 	}
 
-	result, err := cnt.Call("verifyOwner", params.BlockCID, params.Address)
+	owns, err := verifyOwner(contractName, params.BlockCID, params.Address)
 	if err != nil {
 		r.AbortWithError(500, err)
 		return
 	}
 
-	if !result["0"].(bool) {
+	if !owns {
 		r.AbortWithError(401, fmt.Errorf("Not authorized"))
 		return
 	}
 
+	if params.Type == "license" && !checkTerms(r, params) {
+		return
+	}
+
 	// TODO: Verify Origin in contract
 
 	r.Next()
 }
 
+// verifyOwner checks the index first, falling back to a live call.
+func verifyOwner(contractName, cid string, address ethgo.Address) (bool, error) {
+	if indexer.Owns(contractName, cid, address) {
+		return true, nil
+	}
+
+	cnt, ok := contracts.GetContract(contractName)
+	if !ok {
+		return false, fmt.Errorf("Contract not found %s", contractName)
+	}
+
+	result, err := cnt.Call("verifyOwner", cid, address)
+	if err != nil {
+		return false, err
+	}
+
+	return result["0"].(bool), nil
+}
+
 func CreateToken(c *config.Config) gin.HandlerFunc {
 	return func(r *gin.Context) {
 		params := r.MustGet("params").(AuthParams)
@@ -230,11 +265,26 @@ func CreateToken(c *config.Config) gin.HandlerFunc {
 			return
 		}
 
+		// Tokens never outlive the licence they were issued for
+		expires := time.Now().Add(c.TokenTTL)
+		if v, ok := r.Get("terms"); ok {
+			if terms := v.(*licenses.Terms); !terms.ExpiresAt.IsZero() && terms.ExpiresAt.Before(expires) {
+				expires = terms.ExpiresAt
+			}
+		}
+
 		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 			"aud": params.Origin,
-			"sub": strings.Join([]string{params.Chain, params.Type, strconv.FormatUint(params.TokenId, 10), params.BlockCID}, ":"),
+			"sub": strings.Join([]string{
+				params.Chain,
+				params.Type,
+				strconv.FormatUint(params.TokenId, 10),
+				strconv.FormatUint(params.LicenseId, 10),
+				params.BlockCID,
+			}, ":"),
 			"iss": strings.Join([]string{params.Address.String(), params.Sig}, ":"),
 			"nbf": float64(date.Unix()),
+			"exp": float64(expires.Unix()),
 		})
 
 		tokenStr, err := token.SignedString(pkb)
@@ -263,14 +313,27 @@ func AuthenticateToken(r *gin.Context) {
 		return pkb, nil
 	})
 
+	// Includes expired tokens
 	if err != nil {
-		r.AbortWithError(500, err)
+		r.AbortWithError(401, err)
 		return
 	}
 
 	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
 		sub := strings.Split(claims["sub"].(string), ":")
 		iss := strings.Split(claims["iss"].(string), ":")
+		if len(sub) == 4 {
+			// Tokens issued before licence ids were separate carry the
+			// licence in the token id
+			sub = []string{sub[0], sub[1], sub[2], sub[2], sub[3]}
+			if sub[1] != "license" {
+				sub[3] = "0"
+			}
+		}
+		if len(sub) != 5 || len(iss) != 2 {
+			r.AbortWithError(401, fmt.Errorf("Not a block token"))
+			return
+		}
 
 		date := time.Unix(int64(claims["nbf"].(float64)), 0)
 		tokenId, err := strconv.ParseUint(sub[2], 10, 64)
@@ -279,11 +342,18 @@ func AuthenticateToken(r *gin.Context) {
 			return
 		}
 
+		licenseId, err := strconv.ParseUint(sub[3], 10, 64)
+		if err != nil {
+			r.AbortWithError(500, err)
+			return
+		}
+
 		params := AuthParams{
 			Address:   ethgo.HexToAddress(iss[0]),
-			BlockCID:  sub[3],
+			BlockCID:  sub[4],
 			Chain:     sub[0],
 			IssueDate: date.Format(time.RFC3339),
+			LicenseId: licenseId,
 			Origin:    claims["aud"].(string),
 			Sig:       iss[1],
 			TokenId:   tokenId,
@@ -296,3 +366,22 @@ func AuthenticateToken(r *gin.Context) {
 		r.AbortWithError(401, fmt.Errorf("JWT Claims failed"))
 	}
 }
+
+// AuthenticateAdmin guards node operator routes with ADMIN_TOKEN. They are
+// off entirely when no token is set.
+func AuthenticateAdmin(c *config.Config) gin.HandlerFunc {
+	return func(r *gin.Context) {
+		if c.AdminToken == "" {
+			r.AbortWithError(403, fmt.Errorf("Admin routes are disabled"))
+			return
+		}
+
+		token := strings.TrimPrefix(r.GetHeader("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(c.AdminToken)) != 1 {
+			r.AbortWithError(401, fmt.Errorf("Invalid admin token"))
+			return
+		}
+
+		r.Next()
+	}
+}
@@ -1,176 +1,234 @@
 package server
 
 import (
-	"blocksui-node/abi"
 	"blocksui-node/account"
+	"blocksui-node/blocks"
 	"blocksui-node/config"
 	"blocksui-node/contracts"
+	"blocksui-node/indexer"
 	"blocksui-node/ipfs"
 	"blocksui-node/lit"
+	"blocksui-node/pins"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"strings"
 
 	"github.com/gin-gonic/gin"
-	goIpfs "github.com/ipfs/go-ipfs-api"
 )
 
-func GetBlock(c *config.Config) gin.HandlerFunc {
-	return func(r *gin.Context) {
-		params := r.MustGet("params").(AuthParams)
-		signedMessage := r.MustGet("signedMessage").(string)
-		ipfsClient := r.MustGet("ipfs").(*goIpfs.Shell)
-
-		authSig := account.AuthSig{
-			Sig:           params.Sig,
-			DerivedVia:    "BlocksUI",
-			SignedMessage: signedMessage,
-			Address:       params.Address.String(),
-		}
+// blockConditions are the Lit conditions a block's key is released under:
+// owning the block or a licence for it, depending on contractName.
+func blockConditions(contractName, chain, cid string) ([]lit.EvmContractCondition, error) {
+	contract, ok := contracts.GetContract(contractName)
+	if !ok {
+		return nil, fmt.Errorf("Failed to fetch contract")
+	}
 
-		contractName := "BUILicenseNFT"
-		if params.Type == "block" {
-			contractName = "BUIBlockNFT"
-		}
+	return ownerConditions(contract, chain, cid)
+}
 
-		contract, ok := contracts.GetContract(contractName)
-		if !ok {
-			r.AbortWithError(500, fmt.Errorf("Failed to fetch contract"))
-			return
-		}
+// ownerConditions require verifyOwner(cid, :userAddress) on contract.
+func ownerConditions(contract *contracts.Contract, chain, cid string) ([]lit.EvmContractCondition, error) {
+	member, ok := contract.Member("verifyOwner")
+	if !ok {
+		return nil, fmt.Errorf("ABI Method not found")
+	}
 
-		method := contract.Abi.GetMethod("verifyOwner")
-
-		conditions := []lit.EvmContractCondition{
-			lit.EvmContractCondition{
-				ContractAddress: contract.Address.String(),
-				Chain:           contracts.ChainNameForId(params.Chain),
-				FunctionAbi:     abi.MethodToMember(method),
-				FunctionName:    "verifyOwner",
-				FunctionParams: []string{
-					params.BlockCID,
-					":userAddress",
-				},
-				ReturnValueTest: lit.ReturnValueTest{
-					Key:        "",
-					Comparator: "=",
-					Value:      "true",
-				},
+	return []lit.EvmContractCondition{
+		lit.EvmContractCondition{
+			ContractAddress: contract.Address.String(),
+			Chain:           chain,
+			FunctionAbi:     member,
+			FunctionName:    "verifyOwner",
+			FunctionParams: []string{
+				cid,
+				":userAddress",
 			},
-		}
+			ReturnValueTest: lit.ReturnValueTest{
+				Key:        "",
+				Comparator: "=",
+				Value:      "true",
+			},
+		},
+	}, nil
+}
 
-		bcont, ok := contracts.GetContract("BUIBlockNFT")
-		if !ok {
-			r.AbortWithError(500, fmt.Errorf("Failed to fetch contract"))
-			return
-		}
+// decryptBlock fetches the key for a block from Lit and decrypts the
+// payload at payloadCid. Lit refusing the key is a *noKeyError.
+func decryptBlock(ctx context.Context, c *config.Config, store ipfs.BlockStore, authSig *account.AuthSig, chain, contractName, cid string, meta *BlockMeta, payloadCid string) ([]byte, error) {
+	conditions, err := blockConditions(contractName, chain, cid)
+	if err != nil {
+		return nil, err
+	}
 
-		result, err := bcont.Call("tokenURI", params.TokenId)
-		if err != nil {
-			r.AbortWithError(401, fmt.Errorf("Failed to fetch TokenURI"))
-			return
-		}
+	return decryptWith(ctx, c, store, authSig, chain, conditions, meta, payloadCid)
+}
 
-		uri := result["0"].(string)
-		cid := strings.Split(uri, "//")[1]
+func decryptWith(ctx context.Context, c *config.Config, store ipfs.BlockStore, authSig *account.AuthSig, chain string, conditions []lit.EvmContractCondition, meta *BlockMeta, payloadCid string) ([]byte, error) {
+	keyParams := lit.EncryptedKeyParams{
+		AuthSig:               authSig,
+		Chain:                 chain,
+		EvmContractConditions: conditions,
+		ToDecrypt:             meta.BUIProps.EncryptedKey,
+	}
 
-		data, err := ipfsClient.Cat(cid)
-		if err != nil {
-			r.AbortWithError(422, err)
-			return
-		}
+	litClient := lit.New(c)
+	symmetricKey, err := litClient.GetEncryptionKey(keyParams)
+	if err != nil {
+		return nil, &noKeyError{err}
+	}
 
-		buf := new(bytes.Buffer)
-		if _, err := io.Copy(buf, data); err != nil {
-			r.AbortWithError(500, err)
-			return
-		}
+	blockData, err := store.Get(ctx, payloadCid)
+	if err != nil {
+		return nil, err
+	}
+	defer blockData.Close()
 
-		blockMeta := BlockMeta{}
-		if err := json.Unmarshal(buf.Bytes(), &blockMeta); err != nil {
-			r.AbortWithError(500, err)
-			return
-		}
+	bbuf := new(bytes.Buffer)
+	if _, err := io.Copy(bbuf, blockData); err != nil {
+		return nil, err
+	}
+
+	return lit.AesDecrypt(symmetricKey, bbuf.Bytes()), nil
+}
 
-		keyParams := lit.EncryptedKeyParams{
-			AuthSig:               &authSig,
-			Chain:                 contracts.ChainNameForId(params.Chain),
-			EvmContractConditions: conditions,
-			ToDecrypt:             blockMeta.BUIProps.EncryptedKey,
+// noKeyError is Lit refusing to release a block's key.
+type noKeyError struct {
+	err error
+}
+
+func (e *noKeyError) Error() string {
+	return e.err.Error()
+}
+
+// callerAuthSig is the caller's signed sign-in message in the form Lit
+// expects.
+func callerAuthSig(r *gin.Context) *account.AuthSig {
+	params := r.MustGet("params").(AuthParams)
+
+	return &account.AuthSig{
+		Sig:           params.Sig,
+		DerivedVia:    "BlocksUI",
+		SignedMessage: r.MustGet("signedMessage").(string),
+		Address:       params.Address.String(),
+	}
+}
+
+// DecryptBlock decrypts the block the token grants access to. It sets
+// "block" to the plaintext and "document" to the parsed document, which
+// is nil for blocks compiled before the schema.
+func DecryptBlock(c *config.Config) gin.HandlerFunc {
+	return func(r *gin.Context) {
+		params := r.MustGet("params").(AuthParams)
+		store := r.MustGet("store").(ipfs.BlockStore)
+		ctx := r.Request.Context()
+
+		contractName := "BUILicenseNFT"
+		if params.Type == "block" {
+			contractName = "BUIBlockNFT"
 		}
 
-		litClient := lit.New(c)
-		symmetricKey, err := litClient.GetEncryptionKey(keyParams)
+		version, code, err := resolveVersion(ctx, store, params, r.Query("version"))
 		if err != nil {
-			r.AbortWithError(401, err)
+			r.AbortWithError(code, err)
 			return
 		}
+		blockMeta := version.Meta
 
-		blockCid := ipfs.Bytes32ToCid(params.BlockCID)
-
-		blockData, err := ipfsClient.Cat(blockCid)
-		bbuf := new(bytes.Buffer)
-		if _, err := io.Copy(bbuf, blockData); err != nil {
-			r.AbortWithError(500, err)
+		chain := contracts.ChainNameForId(params.Chain)
+		block, err := decryptBlock(ctx, c, store, callerAuthSig(r), chain, contractName, params.BlockCID, blockMeta, version.Payload)
+		if _, ok := err.(*noKeyError); ok {
+			r.AbortWithError(401, err)
+			return
+		} else if err != nil {
+			r.AbortWithError(422, err)
 			return
 		}
 
-		block := lit.AesDecrypt(symmetricKey, bbuf.Bytes())
-
-		blockRes := make([]map[string]interface{}, 0)
-		if err := json.Unmarshal(block, &blockRes); err != nil {
-			r.AbortWithError(500, err)
+		// Documents are validated at compile time. Blocks compiled before
+		// the schema existed are passed through as long as they are JSON.
+		if !json.Valid(block) {
+			r.AbortWithError(500, fmt.Errorf("Block is not valid JSON"))
 			return
 		}
 
-		r.JSON(200, blockRes)
+		r.Set("metadata", blockMeta)
+		r.Set("block", block)
+
+		doc, _ := blocks.Parse(block, nil)
+		r.Set("document", doc)
+
+		r.Next()
 	}
 }
 
-func GetPrimitive(c *config.Config) gin.HandlerFunc {
+// ResolveRefs resolves the blocks the document embeds, each against the
+// caller's own licences, leaving those licences in "refMeters" for
+// MeterLicense.
+func ResolveRefs(c *config.Config) gin.HandlerFunc {
 	return func(r *gin.Context) {
-		name := r.Param("name")
-		if name == "" {
-			err := fmt.Errorf("No name")
-			r.AbortWithError(422, err)
-		} else {
-			resp, err := ipfs.Web3Get(c.PrimitivesCID, c.Web3Token)
-			if err != nil {
-				r.AbortWithError(422, err)
-			} else {
-				file, err := ipfs.FileFromWeb3Res(resp, name)
-				if err != nil {
-					r.AbortWithError(422, err)
-				} else {
-					r.Data(200, "text/javacript", file)
-				}
-			}
+		params := r.MustGet("params").(AuthParams)
+		store := r.MustGet("store").(ipfs.BlockStore)
+		doc := r.MustGet("document").(*blocks.Document)
+		ctx := r.Request.Context()
+
+		if doc == nil || !doc.HasRefs() {
+			r.Next()
+			return
 		}
-	}
-}
 
-func GetBlocksCSS(c *config.Config) gin.HandlerFunc {
-	return func(r *gin.Context) {
-		resp, err := ipfs.Web3Get(c.PrimitivesCID, c.Web3Token)
+		chain := contracts.ChainNameForId(params.Chain)
+		var meters []*meter
+		missing, err := blocks.Resolve(doc, strings.ToLower(params.BlockCID), refFetcher(ctx, c, store, callerAuthSig(r), chain, params, &meters))
 		if err != nil {
-			r.AbortWithError(404, err)
+			r.Error(err)
+			r.AbortWithStatusJSON(422, gin.H{"errors": err})
 			return
 		}
 
-		file, err := ipfs.FileFromWeb3Res(resp, "blocksui.css")
-		if err != nil {
-			r.AbortWithError(404, err)
+		if len(missing) > 0 {
+			r.AbortWithStatusJSON(403, gin.H{
+				"error":   "Not licensed for every embedded block",
+				"missing": missing,
+			})
+			return
 		}
 
-		r.Data(200, "text/css", file)
+		r.Set("refMeters", meters)
+		r.Next()
 	}
 }
 
+// GetBlock serves the block with the primitives it was compiled against.
+// Blocks from before the schema are passed through as they are.
+func GetBlock(r *gin.Context) {
+	block := r.MustGet("block").([]byte)
+	doc := r.MustGet("document").(*blocks.Document)
+	metadata := r.MustGet("metadata").(*BlockMeta)
+
+	if doc == nil {
+		r.Data(200, "application/json", block)
+		return
+	}
+
+	doc.Primitives = metadata.Primitives
+	r.JSON(200, doc)
+}
+
+// BUIProps locates and unlocks a block's payload. Upgrades of a minted
+// block also record the minted block's CID as Root, which their access
+// conditions are bound to, and the metadata URIs of every earlier version
+// as Lineage, oldest first.
 type BUIProps struct {
-	Cid          string `json:"cid"`
-	EncryptedKey string `json:"encryptedKey"`
+	Cid          string        `json:"cid"`
+	CidHint      *ipfs.CidHint `json:"cidHint,omitempty"`
+	EncryptedKey string        `json:"encryptedKey"`
+	Root         string        `json:"root,omitempty"`
+	Lineage      []string      `json:"lineage,omitempty"`
+	Version      int           `json:"version,omitempty"`
 }
 
 type BlockMeta struct {
@@ -178,55 +236,39 @@ type BlockMeta struct {
 	Description string   `json:"description"`
 	Image       string   `json:"image"`
 	Name        string   `json:"name"`
+	Preview     string   `json:"preview,omitempty"`
+	Primitives  string   `json:"primitives,omitempty"`
 	Tags        string   `json:"tags"`
 }
 
-func CompileBlock(r *gin.Context) {
-	ipfs := r.MustGet("ipfs").(*goIpfs.Shell)
+// TokenURI looks the block token's metadata URI up in the index, falling
+// back to a live call.
+func TokenURI(tokenId uint64) (string, error) {
+	return indexer.FetchTokenURI("BUIBlockNFT", tokenId)
+}
 
-	form, err := r.MultipartForm()
+func ReadMetadata(ctx context.Context, store ipfs.BlockStore, uri string) (*BlockMeta, error) {
+	data, err := store.Get(ctx, strings.TrimPrefix(uri, "ipfs://"))
 	if err != nil {
-		r.AbortWithError(422, err)
-		return
+		return nil, err
 	}
+	defer data.Close()
 
-	metadata := BlockMeta{
-		Description: form.Value["description"][0],
-		Name:        form.Value["name"][0],
-		Tags:        form.Value["tags"][0],
+	buf := new(bytes.Buffer)
+	if _, err := io.Copy(buf, data); err != nil {
+		return nil, err
 	}
 
-	if len(form.File) != 0 {
-		files, ok := form.File["image"]
-		if !ok {
-			r.AbortWithError(422, fmt.Errorf("File uploaded should use the name `block`"))
-			return
-		}
-
-		image, err := files[0].Open()
-		defer image.Close()
-		if err != nil {
-			r.AbortWithError(500, err)
-			return
-		}
-
-		imgCid, err := ipfs.Add(image)
-		if err != nil {
-			r.AbortWithError(500, err)
-			return
-		}
-
-		metadata.Image = fmt.Sprintf("ipfs://%s", imgCid)
+	blockMeta := BlockMeta{}
+	if err := json.Unmarshal(buf.Bytes(), &blockMeta); err != nil {
+		return nil, err
 	}
 
-	r.Set("metadata", &metadata)
-	r.Set("block", []byte(form.Value["block"][0]))
-
-	r.Next()
+	return &blockMeta, nil
 }
 
 func SaveMetadata(r *gin.Context) {
-	ipfs := r.MustGet("ipfs").(*goIpfs.Shell)
+	store := r.MustGet("store").(ipfs.BlockStore)
 	metadata := r.MustGet("metadata").(*BlockMeta)
 
 	data, err := json.Marshal(metadata)
@@ -235,7 +277,7 @@ func SaveMetadata(r *gin.Context) {
 		return
 	}
 
-	cid, err := ipfs.Add(bytes.NewBuffer(data))
+	cid, err := store.Put(r.Request.Context(), bytes.NewBuffer(data))
 	if err != nil {
 		r.AbortWithError(500, err)
 		return
@@ -244,3 +286,21 @@ func SaveMetadata(r *gin.Context) {
 	r.Set("metaURI", fmt.Sprintf("ipfs://%s", cid))
 	r.Next()
 }
+
+// TrackPins hands everything the compile added to the pin manager, which
+// keeps it until the block is minted or abandoned.
+func TrackPins(r *gin.Context) {
+	metadata := r.MustGet("metadata").(*BlockMeta)
+	metaURI := r.MustGet("metaURI").(string)
+	cid := r.MustGet("cid").(string)
+
+	upload := r.MustGet("upload").(*pins.Upload)
+
+	err := pins.Track(r.Request.Context(), upload, cid, metaURI, metadata.Image, metadata.Preview, metadata.BUIProps.Cid)
+	if err != nil {
+		r.AbortWithError(500, err)
+		return
+	}
+
+	r.Next()
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"blocksui-node/blocks"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetBlockPrimitives(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	block := []byte(`{"version":1,"components":[{"primitive":"Button"}]}`)
+
+	tests := []struct {
+		name       string
+		primitives string
+		want       string
+	}{
+		{"compiled against a bundle", "bafyprimitives", "bafyprimitives"},
+		{"from before versioned primitives", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := blocks.Parse(block, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			w := httptest.NewRecorder()
+			r, _ := gin.CreateTestContext(w)
+			r.Set("block", block)
+			r.Set("document", doc)
+			r.Set("metadata", &BlockMeta{Primitives: tt.primitives})
+
+			GetBlock(r)
+
+			var got map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+
+			primitives, _ := got["primitives"].(string)
+			if primitives != tt.want {
+				t.Errorf("got primitives %q, want %q", primitives, tt.want)
+			}
+			if _, ok := got["components"]; !ok {
+				t.Errorf("got %s, want the block's components", w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"blocksui-node/blocks"
+	"blocksui-node/ipfs"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BundleRoots returns the CIDs that make up a published block: for the
+// version the token points at and every version in its lineage, the
+// metadata, the encrypted payload, the image and the preview.
+func BundleRoots(ctx context.Context, store ipfs.BlockStore, tokenId uint64) ([]string, error) {
+	uri, err := TokenURI(tokenId)
+	if err != nil {
+		return nil, err
+	}
+
+	return bundleRoots(ctx, store, uri)
+}
+
+func bundleRoots(ctx context.Context, store ipfs.BlockStore, uri string) ([]string, error) {
+	meta, err := ReadMetadata(ctx, store, uri)
+	if err != nil {
+		return nil, err
+	}
+
+	if meta.BUIProps.Cid == "" {
+		return nil, fmt.Errorf("Metadata at %s has no block CID", uri)
+	}
+
+	// Earlier versions, then any later ones published through this node
+	uris := append([]string{uri}, meta.BUIProps.Lineage...)
+	if meta.BUIProps.Root != "" {
+		for _, v := range blocks.Versions(meta.BUIProps.Root) {
+			uris = append(uris, v.MetadataURI)
+		}
+	}
+
+	var roots []string
+	seen := make(map[string]bool)
+	add := func(uris ...string) {
+		for _, uri := range uris {
+			cid := strings.TrimPrefix(uri, "ipfs://")
+			if cid != "" && !seen[cid] {
+				seen[cid] = true
+				roots = append(roots, cid)
+			}
+		}
+	}
+
+	for _, u := range uris {
+		if seen[strings.TrimPrefix(u, "ipfs://")] {
+			continue
+		}
+
+		m := meta
+		if u != uri {
+			if m, err = ReadMetadata(ctx, store, u); err != nil {
+				return nil, err
+			}
+		}
+
+		add(u, m.BUIProps.Cid, m.Image, m.Preview)
+	}
+
+	return roots, nil
+}
+
+// GetBundle streams a block's bundle as a CAR so peers and backups can
+// replicate it. The payload is encrypted, so nothing here needs auth.
+func GetBundle(r *gin.Context) {
+	store := r.MustGet("store").(ipfs.BlockStore)
+
+	tokenId, err := strconv.ParseUint(r.Param("tokenId"), 10, 64)
+	if err != nil {
+		r.AbortWithError(422, fmt.Errorf("Invalid token id"))
+		return
+	}
+
+	roots, err := BundleRoots(r.Request.Context(), store, tokenId)
+	if err != nil {
+		r.AbortWithError(404, err)
+		return
+	}
+
+	r.Header("Content-Type", "application/vnd.ipld.car")
+	r.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"block-%d.car\"", tokenId))
+	r.Status(200)
+
+	// Headers are already sent, so a failure can only cut the CAR short
+	if err := ipfs.WriteCar(r.Request.Context(), store, roots, r.Writer); err != nil {
+		fmt.Printf("[bundle]\tToken %d: %v\n", tokenId, err)
+		r.Error(err)
+	}
+}
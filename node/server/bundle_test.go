@@ -0,0 +1,106 @@
+package server
+
+import (
+	"blocksui-node/ipfs"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+)
+
+func putFile(t *testing.T, store ipfs.BlockStore, data string) string {
+	cid, err := store.Put(context.Background(), strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cid
+}
+
+func putMeta(t *testing.T, store ipfs.BlockStore, meta BlockMeta) string {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return "ipfs://" + putFile(t, store, string(data))
+}
+
+func TestBundleRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	src := ipfs.NewMemStore()
+
+	files := map[string]string{}
+	put := func(name, data string) string {
+		cid := putFile(t, src, data)
+		files[name] = cid
+		return cid
+	}
+
+	minted := putMeta(t, src, BlockMeta{
+		BUIProps: BUIProps{Cid: put("payload v1", "sealed v1")},
+		Image:    "ipfs://" + put("image v1", "png v1"),
+		Preview:  "ipfs://" + put("preview v1", "<div>v1</div>"),
+	})
+	files["metadata v1"] = strings.TrimPrefix(minted, "ipfs://")
+
+	current := putMeta(t, src, BlockMeta{
+		BUIProps: BUIProps{
+			Cid:     put("payload v2", "sealed v2"),
+			Root:    "0xaa",
+			Lineage: []string{minted},
+			Version: 2,
+		},
+		Image:   "ipfs://" + put("image v2", "png v2"),
+		Preview: "ipfs://" + put("preview v2", "<div>v2</div>"),
+	})
+	files["metadata v2"] = strings.TrimPrefix(current, "ipfs://")
+
+	roots, err := bundleRoots(ctx, src, current)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var car bytes.Buffer
+	if err := ipfs.WriteCar(ctx, src, roots, &car); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := ipfs.NewMemStore()
+	if _, err := dst.PutCar(ctx, &car); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, cid := range files {
+		t.Run(name, func(t *testing.T) {
+			want, err := readAll(ctx, src, cid)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := readAll(ctx, dst, cid)
+			if err != nil {
+				t.Fatalf("got %v, want %s imported from the bundle", err, cid)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("got %q, want %q", got, want)
+			}
+		})
+	}
+
+	if len(roots) != len(files) {
+		t.Errorf("got %d roots, want %d", len(roots), len(files))
+	}
+}
+
+func readAll(ctx context.Context, store ipfs.BlockStore, cid string) ([]byte, error) {
+	r, err := store.Get(ctx, cid)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
@@ -0,0 +1,314 @@
+package server
+
+import (
+	"blocksui-node/blocks"
+	"blocksui-node/config"
+	"blocksui-node/ipfs"
+	"blocksui-node/primitives"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Limits for the text parts of a compile request. The block and image
+// limits come from the config.
+var fieldLimits = map[string]int64{
+	"name":        256,
+	"description": 4 << 10,
+	"tags":        1 << 10,
+	"primitives":  128,
+	"preview":     16,
+}
+
+var imageTypes = map[string]bool{
+	"image/gif":  true,
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/webp": true,
+}
+
+// FieldError is a compile request problem the client can fix.
+type FieldError struct {
+	Code  int    `json:"-"`
+	Field string `json:"field"`
+	Err   string `json:"error"`
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Err)
+}
+
+func fieldError(code int, field, format string, args ...interface{}) *FieldError {
+	return &FieldError{code, field, fmt.Sprintf(format, args...)}
+}
+
+func abortField(r *gin.Context, err *FieldError) {
+	r.Error(err)
+	r.AbortWithStatusJSON(err.Code, err)
+}
+
+type CompileRequest struct {
+	Name        string
+	Description string
+	Tags        string
+	Primitives  string
+	Preview     string
+	Block       []byte
+	ImageCid    string
+}
+
+var errTooLarge = errors.New("too large")
+
+// limitReader fails once more than n bytes have been read, rather than
+// silently truncating like io.LimitReader.
+type limitReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	if l.n < 0 {
+		return 0, errTooLarge
+	}
+
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n < 0 {
+		return n, errTooLarge
+	}
+
+	return n, err
+}
+
+// bodyError reports the whole request as too large once MaxBytesReader
+// cuts it off.
+func bodyError(err error) *FieldError {
+	if strings.Contains(err.Error(), "request body too large") {
+		return fieldError(413, "body", "request body too large")
+	}
+
+	return fieldError(400, "body", "%v", err)
+}
+
+func readPart(part io.Reader, field string, limit int64) ([]byte, *FieldError) {
+	data, err := io.ReadAll(&limitReader{part, limit})
+	if err == errTooLarge {
+		return nil, fieldError(413, field, "must be at most %d bytes", limit)
+	} else if err != nil {
+		return nil, bodyError(err)
+	}
+
+	return data, nil
+}
+
+// putImage sniffs the image type from its first bytes, then streams it
+// into the store without buffering the rest.
+func putImage(ctx context.Context, store ipfs.BlockStore, part io.Reader, limit int64) (string, *FieldError) {
+	lr := &limitReader{part, limit}
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(lr, head)
+	if err == errTooLarge {
+		return "", fieldError(413, "image", "must be at most %d bytes", limit)
+	} else if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", bodyError(err)
+	}
+	head = head[:n]
+
+	if n == 0 {
+		return "", fieldError(422, "image", "is empty")
+	}
+
+	ctype := http.DetectContentType(head)
+	if !imageTypes[ctype] {
+		return "", fieldError(415, "image", "type %s is not allowed", ctype)
+	}
+
+	cid, err := store.Put(ctx, io.MultiReader(bytes.NewReader(head), lr))
+	if lr.n < 0 {
+		return "", fieldError(413, "image", "must be at most %d bytes", limit)
+	} else if err != nil {
+		return "", fieldError(500, "image", "%v", err)
+	}
+
+	return cid, nil
+}
+
+// parseCompile reads the multipart body part by part so nothing is
+// buffered beyond the limits.
+func parseCompile(r *gin.Context, store ipfs.BlockStore, maxBlock, maxImage int64) (req *CompileRequest, ferr *FieldError) {
+	ctype, _, err := mime.ParseMediaType(r.GetHeader("Content-Type"))
+	if err != nil || ctype != "multipart/form-data" {
+		return nil, fieldError(415, "body", "must be multipart/form-data")
+	}
+
+	var textTotal int64
+	for _, limit := range fieldLimits {
+		textTotal += limit
+	}
+
+	// Room for the parts plus their headers and boundaries
+	r.Request.Body = http.MaxBytesReader(r.Writer, r.Request.Body, maxBlock+maxImage+textTotal+64<<10)
+
+	reader, err := r.Request.MultipartReader()
+	if err != nil {
+		return nil, fieldError(400, "body", "%v", err)
+	}
+
+	ctx := r.Request.Context()
+	req = &CompileRequest{}
+
+	seen := make(map[string]bool)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return req, bodyError(err)
+		}
+
+		field := part.FormName()
+		if seen[field] {
+			return req, fieldError(422, field, "was sent more than once")
+		}
+		seen[field] = true
+
+		switch field {
+		case "image":
+			if req.ImageCid, ferr = putImage(ctx, store, part, maxImage); ferr != nil {
+				return req, ferr
+			}
+		case "block":
+			if req.Block, ferr = readPart(part, field, maxBlock); ferr != nil {
+				return req, ferr
+			}
+		default:
+			limit, ok := fieldLimits[field]
+			if !ok {
+				return req, fieldError(422, field, "is not a compile field")
+			}
+
+			data, ferr := readPart(part, field, limit)
+			if ferr != nil {
+				return req, ferr
+			}
+
+			switch field {
+			case "name":
+				req.Name = string(data)
+			case "description":
+				req.Description = string(data)
+			case "tags":
+				req.Tags = string(data)
+			case "primitives":
+				req.Primitives = string(data)
+			case "preview":
+				req.Preview = string(data)
+			}
+		}
+	}
+
+	if req.Name == "" {
+		return req, fieldError(422, "name", "is required")
+	}
+
+	if len(req.Block) == 0 {
+		return req, fieldError(422, "block", "is required")
+	}
+
+	if req.Preview != "" && req.Preview != blocks.PreviewStrip && req.Preview != blocks.PreviewWatermark {
+		return req, fieldError(422, "preview", "must be %q or %q", blocks.PreviewStrip, blocks.PreviewWatermark)
+	}
+
+	if _, ok := primitives.Get(req.Primitives); !ok && req.Primitives != "" {
+		return req, fieldError(422, "primitives", "%s is not loaded", primitives.Resolve(req.Primitives))
+	}
+
+	return req, nil
+}
+
+func CompileBlock(c *config.Config) gin.HandlerFunc {
+	return func(r *gin.Context) {
+		store := r.MustGet("store").(ipfs.BlockStore)
+
+		req, ferr := parseCompile(r, store, int64(c.MaxBlockSize), int64(c.MaxImageSize))
+		if ferr != nil {
+			abortField(r, ferr)
+			return
+		}
+
+		bundle, ok := primitives.Get(req.Primitives)
+		if !ok {
+			abortField(r, fieldError(503, "primitives", "no primitives bundle is loaded"))
+			return
+		}
+
+		// Nothing is encrypted or pinned for an invalid document
+		doc, err := blocks.Parse(req.Block, func(name string) bool {
+			_, ok := bundle.File("blocks/" + name + ".js")
+			return ok
+		})
+		if err != nil {
+			r.Error(err)
+			r.AbortWithStatusJSON(422, gin.H{"field": "block", "errors": err})
+			return
+		}
+
+		block, err := json.Marshal(doc)
+		if err != nil {
+			r.AbortWithError(500, err)
+			return
+		}
+
+		// Record the exact primitives bundle the block was authored against
+		metadata := BlockMeta{
+			Description: req.Description,
+			Name:        req.Name,
+			Primitives:  bundle.Cid,
+			Tags:        req.Tags,
+		}
+
+		// Set by SelectParent when publishing a new version
+		if props, ok := r.Get("lineage"); ok {
+			metadata.BUIProps = props.(BUIProps)
+		}
+
+		if req.ImageCid != "" {
+			metadata.Image = fmt.Sprintf("ipfs://%s", req.ImageCid)
+		}
+
+		// The preview is the only part of a block stored unencrypted
+		if req.Preview != "" {
+			preview, err := json.Marshal(blocks.Preview(doc, req.Preview))
+			if err != nil {
+				r.AbortWithError(500, err)
+				return
+			}
+
+			cid, err := store.Put(r.Request.Context(), bytes.NewReader(preview))
+			if err != nil {
+				r.AbortWithError(500, err)
+				return
+			}
+
+			metadata.Preview = fmt.Sprintf("ipfs://%s", cid)
+		}
+
+		r.Set("metadata", &metadata)
+		r.Set("block", block)
+
+		r.Next()
+	}
+}
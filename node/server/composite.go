@@ -0,0 +1,89 @@
+package server
+
+import (
+	"blocksui-node/account"
+	"blocksui-node/blocks"
+	"blocksui-node/config"
+	"blocksui-node/contracts"
+	"blocksui-node/indexer"
+	"blocksui-node/ipfs"
+	"context"
+	"fmt"
+)
+
+// refFetcher decrypts blocks embedded in a composite block. Each one is
+// authorized on its own: the reader needs to own it, or a licence for it
+// whose terms cover the read. Licences are left in meters to be charged
+// with the block itself. Embedded blocks are served at the version their
+// token points at.
+func refFetcher(ctx context.Context, c *config.Config, store ipfs.BlockStore, authSig *account.AuthSig, chain string, params AuthParams, meters *[]*meter) blocks.Fetcher {
+	return func(ref string) (*blocks.Document, error) {
+		contractName := ""
+		for _, name := range []string{"BUIBlockNFT", "BUILicenseNFT"} {
+			owns, err := verifyOwner(name, ref, params.Address)
+			if err != nil {
+				return nil, err
+			}
+			if owns {
+				contractName = name
+				break
+			}
+		}
+
+		if contractName == "" {
+			return nil, blocks.ErrNotLicensed
+		}
+
+		var license *meter
+		if contractName == "BUILicenseNFT" {
+			var err error
+			if license, err = refLicense(ctx, ref, params); err != nil {
+				return nil, err
+			}
+		}
+
+		tokenId, ok := indexer.TokenForCid("BUIBlockNFT", ref)
+		if !ok {
+			// The mint may not be indexed yet, or there may be no index
+			from := indexer.FirstBlock()
+			if from == 0 {
+				var err error
+				if from, err = contracts.DeploymentBlock("BUIBlockNFT"); err != nil {
+					return nil, err
+				}
+			}
+
+			var err error
+			if tokenId, ok, err = indexer.FindToken("BUIBlockNFT", ref, from); err != nil {
+				return nil, err
+			}
+		}
+		if !ok {
+			return nil, fmt.Errorf("Block %s was not minted", ref)
+		}
+
+		version, _, err := resolveVersion(ctx, store, AuthParams{BlockCID: ref, TokenId: tokenId}, "")
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := decryptBlock(ctx, c, store, authSig, chain, contractName, ref, version.Meta, version.Payload)
+		if _, ok := err.(*noKeyError); ok {
+			return nil, blocks.ErrNotLicensed
+		} else if err != nil {
+			return nil, err
+		}
+
+		doc, err := blocks.Parse(data, nil)
+		if err != nil {
+			return nil, fmt.Errorf("Block %s is not a valid block document", ref)
+		}
+		doc.Primitives = version.Meta.Primitives
+
+		if license != nil {
+			*meters = append(*meters, license)
+		}
+
+		return doc, nil
+	}
+}
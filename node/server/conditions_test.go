@@ -0,0 +1,84 @@
+package server
+
+import (
+	"blocksui-node/contracts"
+	"blocksui-node/lit"
+	"encoding/json"
+	"testing"
+
+	"github.com/umbracle/ethgo"
+	ethgoAbi "github.com/umbracle/ethgo/abi"
+)
+
+// Lit keeps keys under the hash of their conditions, so these must match
+// what keys were saved with before any change to how conditions marshal.
+const testABI = `[
+	{"type":"function","name":"verifyOwner","stateMutability":"view","inputs":[{"name":"cid","type":"bytes32","internalType":"bytes32"},{"name":"account","type":"address","internalType":"address"}],"outputs":[{"name":"","type":"bool","internalType":"bool"}]},
+	{"type":"function","name":"verify","stateMutability":"view","inputs":[{"name":"node","type":"address","internalType":"address"}],"outputs":[{"name":"","type":"bool","internalType":"bool"}]}
+]`
+
+func testContract(t *testing.T) *contracts.Contract {
+	a, err := ethgoAbi.NewABI(testABI)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &contracts.Contract{
+		Address: ethgo.HexToAddress("0x0000000000000000000000000000000000000B0b"),
+		Abi:     a,
+	}
+}
+
+func TestConditionsGolden(t *testing.T) {
+	cnt := testContract(t)
+
+	owner, err := ownerConditions(cnt, "mumbai", "0x1220aabbccddeeff00112233445566778899aabbccddeeff0011223344556677")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	node, err := nodeCondition(cnt, "mumbai")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		conditions []lit.EvmContractCondition
+		json       string
+		hash       string
+	}{
+		{
+			"verifyOwner",
+			owner,
+			`[{"contractAddress":"0x0000000000000000000000000000000000000B0b","functionName":"verifyOwner","functionParams":["0x1220aabbccddeeff00112233445566778899aabbccddeeff0011223344556677",":userAddress"],"functionAbi":{"name":"verifyOwner","inputs":[{"name":"cid","type":"bytes32"},{"name":"account","type":"address"}],"outputs":[{"name":"","type":"bool"}],"constant":false,"stateMutability":"view"},"chain":"mumbai","returnValueTest":{"key":"","comparator":"=","value":"true"}}]`,
+			"d100a300d187fd02a5cfe55987356ce3370519dd26fe799b8047036f3deb613f",
+		},
+		{
+			"verify",
+			[]lit.EvmContractCondition{node},
+			`[{"contractAddress":"0x0000000000000000000000000000000000000B0b","functionName":"verify","functionParams":[":userAddress"],"functionAbi":{"name":"verify","inputs":[{"name":"node","type":"address"}],"outputs":[{"name":"","type":"bool"}],"constant":false,"stateMutability":"view"},"chain":"mumbai","returnValueTest":{"key":"","comparator":"=","value":"true"}}]`,
+			"9a651d5984cd3093b3051d02024089a1836017fd53b1e50ce9107e1e090e8209",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.conditions)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.json {
+				t.Errorf("conditions changed:\n got %s\nwant %s", data, tt.json)
+			}
+
+			hash, err := lit.ConditionsHash(tt.conditions)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hash != tt.hash {
+				t.Errorf("hash %s, want %s", hash, tt.hash)
+			}
+		})
+	}
+}
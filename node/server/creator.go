@@ -0,0 +1,496 @@
+package server
+
+import (
+	"blocksui-node/blocks"
+	"blocksui-node/catalog"
+	"blocksui-node/config"
+	"blocksui-node/contracts"
+	"blocksui-node/indexer"
+	"blocksui-node/ipfs"
+	"blocksui-node/pins"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/umbracle/ethgo"
+)
+
+// creatorCID stands in for the block CID in a creator's sign-in message,
+// which is fetched from /auth/sign like any other.
+const creatorCID = "creator"
+
+const (
+	// The most metadata the catalog and licence terms will read
+	maxMetadataSize = 64 << 10
+	imageTimeout    = 30 * time.Second
+)
+
+type CreatorParams struct {
+	Address   ethgo.Address `json:"address" binding:"required"`
+	Chain     string        `json:"chain" binding:"required"`
+	IssueDate string        `json:"issueDate" binding:"required"`
+	Origin    string        `json:"origin" binding:"required"`
+	Sig       string        `json:"signature" binding:"required"`
+}
+
+// BindCreator reads a creator sign-in so AuthenticateSignature can check it.
+func BindCreator(r *gin.Context) {
+	var creator CreatorParams
+	if err := r.ShouldBind(&creator); err != nil {
+		r.AbortWithError(422, err)
+		return
+	}
+
+	r.Set("params", AuthParams{
+		Address:   creator.Address,
+		BlockCID:  creatorCID,
+		Chain:     creator.Chain,
+		IssueDate: creator.IssueDate,
+		Origin:    creator.Origin,
+		Sig:       creator.Sig,
+		Type:      creatorCID,
+	})
+	r.Next()
+}
+
+// CreateCreatorToken issues a session for every block the address owns.
+// Ownership is checked per block on each request.
+func CreateCreatorToken(c *config.Config) gin.HandlerFunc {
+	return func(r *gin.Context) {
+		params := r.MustGet("params").(AuthParams)
+		pkb, err := hex.DecodeString(r.MustGet("networkPrivKey").(string))
+		if err != nil {
+			r.AbortWithError(500, err)
+			return
+		}
+
+		date, err := time.Parse(time.RFC3339, params.IssueDate)
+		if err != nil {
+			r.AbortWithError(422, err)
+			return
+		}
+
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"aud": params.Origin,
+			"sub": strings.Join([]string{creatorCID, params.Chain}, ":"),
+			"iss": strings.Join([]string{params.Address.String(), params.Sig}, ":"),
+			"nbf": float64(date.Unix()),
+			"exp": float64(time.Now().Add(c.TokenTTL).Unix()),
+		})
+
+		tokenStr, err := token.SignedString(pkb)
+		if err != nil {
+			r.AbortWithError(500, err)
+			return
+		}
+
+		r.String(200, tokenStr)
+	}
+}
+
+// AuthenticateCreator reads the creator session from the Authorization
+// header. AuthenticateSignature then checks the sign-in it carries.
+func AuthenticateCreator(r *gin.Context) {
+	pkb, err := hex.DecodeString(r.MustGet("networkPrivKey").(string))
+	if err != nil {
+		r.AbortWithError(500, err)
+		return
+	}
+
+	bearer := strings.TrimPrefix(r.GetHeader("Authorization"), "Bearer ")
+	token, err := jwt.Parse(bearer, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+		}
+
+		return pkb, nil
+	})
+	if err != nil {
+		r.AbortWithError(401, err)
+		return
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		r.AbortWithError(401, fmt.Errorf("JWT Claims failed"))
+		return
+	}
+
+	sub := strings.Split(fmt.Sprint(claims["sub"]), ":")
+	iss := strings.Split(fmt.Sprint(claims["iss"]), ":")
+	if len(sub) != 2 || sub[0] != creatorCID || len(iss) != 2 {
+		r.AbortWithError(401, fmt.Errorf("Not a creator token"))
+		return
+	}
+
+	nbf, _ := claims["nbf"].(float64)
+	origin, _ := claims["aud"].(string)
+
+	r.Set("params", AuthParams{
+		Address:   ethgo.HexToAddress(iss[0]),
+		BlockCID:  creatorCID,
+		Chain:     sub[1],
+		IssueDate: time.Unix(int64(nbf), 0).Format(time.RFC3339),
+		Origin:    origin,
+		Sig:       iss[1],
+		Type:      creatorCID,
+	})
+	r.Next()
+}
+
+// blockCidForToken finds the bytes32 CID a block token was minted for.
+func blockCidForToken(ctx context.Context, store ipfs.BlockStore, tokenId uint64) (string, error) {
+	if t, ok := indexer.GetToken("BUIBlockNFT", tokenId); ok && t.Cid != "" {
+		return t.Cid, nil
+	}
+
+	uri, err := TokenURI(tokenId)
+	if err != nil {
+		return "", err
+	}
+
+	meta, err := ReadMetadata(ctx, store, uri)
+	if err != nil {
+		return "", err
+	}
+
+	if meta.BUIProps.Root != "" {
+		return strings.ToLower(meta.BUIProps.Root), nil
+	}
+
+	cid, _, err := ipfs.CidToBytes32(meta.BUIProps.Cid)
+	return cid, err
+}
+
+// CreatorBlock checks the creator owns the block in :tokenId and makes the
+// rest of the chain see an owner's block request.
+func CreatorBlock(r *gin.Context) {
+	params := r.MustGet("params").(AuthParams)
+	store := r.MustGet("store").(ipfs.BlockStore)
+
+	tokenId, err := strconv.ParseUint(r.Param("tokenId"), 10, 64)
+	if err != nil {
+		r.AbortWithError(422, fmt.Errorf("Invalid token id"))
+		return
+	}
+
+	cid, err := blockCidForToken(r.Request.Context(), store, tokenId)
+	if err != nil {
+		r.AbortWithError(404, err)
+		return
+	}
+
+	owns, err := verifyOwner("BUIBlockNFT", cid, params.Address)
+	if err != nil {
+		r.AbortWithError(500, err)
+		return
+	}
+
+	if !owns {
+		r.AbortWithError(403, fmt.Errorf("Not the owner of block %d", tokenId))
+		return
+	}
+
+	params.BlockCID = cid
+	params.TokenId = tokenId
+	params.Type = "block"
+
+	r.Set("params", params)
+	r.Next()
+}
+
+type CreatorBlockInfo struct {
+	TokenId     uint64 `json:"tokenId"`
+	Cid         string `json:"cid"`
+	Name        string `json:"name,omitempty"`
+	MetadataURI string `json:"metadataURI,omitempty"`
+	Licenses    int    `json:"licenses"`
+	Versions    int    `json:"versions"`
+}
+
+// ListCreatorBlocks lists the blocks the creator currently owns.
+func ListCreatorBlocks(r *gin.Context) {
+	params := r.MustGet("params").(AuthParams)
+
+	tokens, _ := indexer.Tokens("BUIBlockNFT")
+	if tokens == nil {
+		r.AbortWithError(503, fmt.Errorf("The indexer is not running"))
+		return
+	}
+
+	list := []CreatorBlockInfo{}
+	for id, t := range tokens {
+		if t.Owner() != params.Address {
+			continue
+		}
+
+		tokenId, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			continue
+		}
+
+		info := CreatorBlockInfo{
+			TokenId:     tokenId,
+			Cid:         t.Cid,
+			MetadataURI: t.TokenURI,
+			Versions:    len(blocks.Versions(t.Cid)),
+		}
+
+		if e, ok := catalog.Get(tokenId); ok {
+			info.Name = e.Name
+			info.MetadataURI = e.MetadataURI
+			info.Licenses = e.Licenses
+		}
+
+		list = append(list, info)
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].TokenId < list[j].TokenId })
+
+	r.JSON(200, list)
+}
+
+// GetBlockSource serves the decrypted block exactly as compiled, without
+// resolving embedded blocks.
+func GetBlockSource(r *gin.Context) {
+	r.Data(200, "application/json", r.MustGet("block").([]byte))
+}
+
+type MetadataUpdate struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	Image       *string `json:"image"`
+	Tags        *string `json:"tags"`
+}
+
+// UpdateMetadata starts from the block's current metadata and applies the
+// fields sent. The payload and its key are unchanged; pointing the token at
+// the new metadata is left to the creator's wallet. A new image must
+// already be on IPFS and within the compile's image limit.
+func UpdateMetadata(c *config.Config) gin.HandlerFunc {
+	return func(r *gin.Context) {
+		params := r.MustGet("params").(AuthParams)
+		store := r.MustGet("store").(ipfs.BlockStore)
+		ctx := r.Request.Context()
+
+		var update MetadataUpdate
+		if err := r.ShouldBindJSON(&update); err != nil {
+			r.AbortWithError(422, err)
+			return
+		}
+
+		fields := map[string]*string{
+			"name":        update.Name,
+			"description": update.Description,
+			"tags":        update.Tags,
+		}
+		for field, v := range fields {
+			if v != nil && int64(len(*v)) > fieldLimits[field] {
+				abortField(r, fieldError(413, field, "must be at most %d bytes", fieldLimits[field]))
+				return
+			}
+		}
+
+		if update.Name != nil && *update.Name == "" {
+			abortField(r, fieldError(422, "name", "is required"))
+			return
+		}
+
+		if update.Image != nil && *update.Image != "" && !strings.HasPrefix(*update.Image, "ipfs://") {
+			abortField(r, fieldError(422, "image", "must be an ipfs:// URI"))
+			return
+		}
+
+		current, code, err := resolveVersion(ctx, store, params, "")
+		if err != nil {
+			r.AbortWithError(code, err)
+			return
+		}
+
+		if update.Image != nil && *update.Image != "" && *update.Image != current.Meta.Image {
+			if ferr := statImage(ctx, store, *update.Image, int64(c.MaxImageSize)); ferr != nil {
+				abortField(r, ferr)
+				return
+			}
+		}
+
+		metadata := *current.Meta
+		if update.Name != nil {
+			metadata.Name = *update.Name
+		}
+		if update.Description != nil {
+			metadata.Description = *update.Description
+		}
+		if update.Image != nil {
+			metadata.Image = *update.Image
+		}
+		if update.Tags != nil {
+			metadata.Tags = *update.Tags
+		}
+
+		data, err := json.Marshal(&metadata)
+		if err != nil {
+			r.AbortWithError(500, err)
+			return
+		}
+
+		if len(data) > maxMetadataSize {
+			abortField(r, fieldError(413, "metadata", "must be at most %d bytes", maxMetadataSize))
+			return
+		}
+
+		r.Set("metadata", &metadata)
+		r.Next()
+	}
+}
+
+// statImage checks an image given by URI, rather than uploaded, is a
+// single file within limit. The node pins it, so it would otherwise keep
+// whatever the URI points at.
+func statImage(ctx context.Context, store ipfs.BlockStore, uri string, limit int64) *FieldError {
+	cid := strings.TrimPrefix(uri, "ipfs://")
+	if strings.Contains(cid, "/") {
+		return fieldError(422, "image", "must be the URI of a single file")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, imageTimeout)
+	defer cancel()
+
+	stat, err := store.Stat(ctx, cid)
+	if err != nil {
+		return fieldError(422, "image", "could not be found: %v", err)
+	}
+
+	if stat.Size > uint64(limit) {
+		return fieldError(413, "image", "must be at most %d bytes", limit)
+	}
+
+	return nil
+}
+
+// TrackMetadata pins updated metadata like a compile: it is kept once the
+// token URI points at it, and unpinned if that doesn't happen within the
+// grace period.
+func TrackMetadata(r *gin.Context) {
+	params := r.MustGet("params").(AuthParams)
+	metadata := r.MustGet("metadata").(*BlockMeta)
+	metaURI := r.MustGet("metaURI").(string)
+
+	upload := r.MustGet("upload").(*pins.Upload)
+
+	err := pins.TrackUpdate(r.Request.Context(), upload, params.TokenId, params.BlockCID, metaURI, metadata.Image)
+	if err != nil {
+		r.AbortWithError(500, err)
+		return
+	}
+
+	r.JSON(200, gin.H{"metadataURI": metaURI})
+}
+
+// RotateOptions are the conditions a rotated key is released under. As
+// with a re-key, the key can be bound to the block on another BUIBlockNFT
+// deployment, such as one being migrated to; readers find it once the node
+// is configured with that deployment. Zero values keep the current
+// conditions.
+type RotateOptions struct {
+	Contract ethgo.Address `json:"contract"`
+	Chain    string        `json:"chain"`
+}
+
+// RotateSource re-publishes the parent version's source for LitEncrypt to
+// encrypt under a fresh key, as a new version of the block, released under
+// the conditions in the body if any are sent.
+func RotateSource(c *config.Config) gin.HandlerFunc {
+	return func(r *gin.Context) {
+		params := r.MustGet("params").(AuthParams)
+		store := r.MustGet("store").(ipfs.BlockStore)
+		props := r.MustGet("lineage").(BUIProps)
+		parent := r.MustGet("parent").(*blockVersion)
+		ctx := r.Request.Context()
+
+		var opts RotateOptions
+		if r.Request.ContentLength != 0 {
+			if err := r.ShouldBindJSON(&opts); err != nil {
+				r.AbortWithError(422, err)
+				return
+			}
+		}
+
+		_, contract, err := RekeyOptions{ToAddress: opts.Contract, Chain: opts.Chain}.contracts(c)
+		if err != nil {
+			r.AbortWithError(422, err)
+			return
+		}
+
+		chain := contracts.ChainNameForId(params.Chain)
+		block, err := decryptBlock(ctx, c, store, callerAuthSig(r), chain, "BUIBlockNFT", params.BlockCID, parent.Meta, parent.Payload)
+		if _, ok := err.(*noKeyError); ok {
+			r.AbortWithError(401, err)
+			return
+		} else if err != nil {
+			r.AbortWithError(422, err)
+			return
+		}
+
+		metadata := *parent.Meta
+		metadata.BUIProps = props
+
+		r.Set("metadata", &metadata)
+		r.Set("block", block)
+		r.Set("contract", contract)
+		r.Next()
+	}
+}
+
+// SourceRotated reports a rotation. The old key is not revoked: it still
+// opens the earlier versions, and readers keep being served the version
+// the token points at until it is repointed at the new metadata.
+func SourceRotated(r *gin.Context) {
+	published := r.MustGet("published").(gin.H)
+	published["revoked"] = false
+	published["contract"] = r.MustGet("contract").(*contracts.Contract).Address
+	published["notice"] = fmt.Sprintf("Nothing is revoked until the token URI is pointed at %s; earlier versions stay readable with their old keys", published["metadataURI"])
+
+	r.JSON(200, published)
+}
+
+type LicenseHolder struct {
+	TokenId uint64        `json:"tokenId"`
+	Holder  ethgo.Address `json:"holder"`
+}
+
+// ListLicenseHolders lists who currently holds a licence for the block.
+func ListLicenseHolders(r *gin.Context) {
+	params := r.MustGet("params").(AuthParams)
+
+	tokens, _ := indexer.Tokens("BUILicenseNFT")
+	if tokens == nil {
+		r.AbortWithError(503, fmt.Errorf("The indexer is not running"))
+		return
+	}
+
+	holders := []LicenseHolder{}
+	for id, t := range tokens {
+		if t.Cid != strings.ToLower(params.BlockCID) {
+			continue
+		}
+
+		tokenId, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			continue
+		}
+
+		holders = append(holders, LicenseHolder{tokenId, t.Owner()})
+	}
+
+	sort.Slice(holders, func(i, j int) bool { return holders[i].TokenId < holders[j].TokenId })
+
+	r.JSON(200, holders)
+}
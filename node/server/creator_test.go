@@ -0,0 +1,39 @@
+package server
+
+import (
+	"blocksui-node/ipfs"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestStatImage(t *testing.T) {
+	ctx := context.Background()
+	store := ipfs.NewMemStore()
+
+	small := putFile(t, store, "png")
+	large := putFile(t, store, strings.Repeat("x", 1<<10))
+
+	tests := []struct {
+		name string
+		uri  string
+		code int
+	}{
+		{"within the limit", "ipfs://" + small, 0},
+		{"too large", "ipfs://" + large, 413},
+		{"a path", "ipfs://" + small + "/image.png", 422},
+		{"not a cid", "ipfs://nothing", 422},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code := 0
+			if ferr := statImage(ctx, store, tt.uri, 512); ferr != nil {
+				code = ferr.Code
+			}
+			if code != tt.code {
+				t.Errorf("got %d, want %d", code, tt.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"blocksui-node/catalog"
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+func queryInt(r *gin.Context, name string, fallback, min, max int) (int, error) {
+	v := r.Query(name)
+	if v == "" {
+		return fallback, nil
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil || n < min || n > max {
+		return 0, fmt.Errorf("%s must be a number from %d to %d", name, min, max)
+	}
+
+	return n, nil
+}
+
+// ListBlocks searches the minted blocks. Licences are sold per block, so
+// listing them needs no auth.
+func ListBlocks(r *gin.Context) {
+	page, err := queryInt(r, "page", 1, 1, 1<<20)
+	if err != nil {
+		r.AbortWithError(422, err)
+		return
+	}
+
+	limit, err := queryInt(r, "limit", defaultPageSize, 1, maxPageSize)
+	if err != nil {
+		r.AbortWithError(422, err)
+		return
+	}
+
+	r.JSON(200, catalog.Search(catalog.Query{
+		Query:   r.Query("query"),
+		Tag:     r.Query("tag"),
+		Creator: r.Query("creator"),
+		Page:    page,
+		Limit:   limit,
+	}))
+}
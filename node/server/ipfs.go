@@ -2,17 +2,29 @@ package server
 
 import (
 	"blocksui-node/ipfs"
+	"blocksui-node/pins"
 
 	"github.com/gin-gonic/gin"
 )
 
-func IPFSConnect(r *gin.Context) {
-	ipfs, err := ipfs.Connect()
-	if err != nil {
-		r.AbortWithError(500, err)
-		return
+func UseStore(store ipfs.BlockStore) gin.HandlerFunc {
+	return func(r *gin.Context) {
+		r.Set("store", store)
+		r.Next()
 	}
+}
+
+// TrackUploads has the pin manager record everything the rest of the chain
+// puts in the store as it is added, and unpins it again if the request
+// fails before it is tracked for good.
+func TrackUploads(r *gin.Context) {
+	upload := pins.Begin(r.MustGet("store").(ipfs.BlockStore))
+	r.Set("store", upload)
+	r.Set("upload", upload)
 
-	r.Set("ipfs", ipfs)
 	r.Next()
+
+	if r.IsAborted() || len(r.Errors) > 0 {
+		upload.Discard()
+	}
 }
@@ -0,0 +1,230 @@
+package server
+
+import (
+	"blocksui-node/blocks"
+	"blocksui-node/contracts"
+	"blocksui-node/indexer"
+	"blocksui-node/licenses"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/umbracle/ethgo"
+)
+
+// licenseHolder checks that the request's licence is for the block and
+// held by the caller, since its terms and quota are what the
+// request is charged against.
+func licenseHolder(params AuthParams) error {
+	if t, ok := indexer.GetToken("BUILicenseNFT", params.LicenseId); ok {
+		if t.Cid != "" && t.Cid != strings.ToLower(params.BlockCID) {
+			return fmt.Errorf("Licence %d is not for %s", params.LicenseId, params.BlockCID)
+		}
+		if t.Owner() != params.Address {
+			return fmt.Errorf("Licence %d is not held by %s", params.LicenseId, params.Address)
+		}
+		return nil
+	}
+
+	cnt, ok := contracts.GetContract("BUILicenseNFT")
+	if !ok {
+		return fmt.Errorf("Contract not found BUILicenseNFT")
+	}
+
+	if cnt.Abi.GetMethod("ownerOf") == nil {
+		return nil
+	}
+
+	result, err := cnt.Call("ownerOf", params.LicenseId)
+	if err != nil {
+		return err
+	}
+
+	if owner, _ := result["0"].(ethgo.Address); owner != params.Address {
+		return fmt.Errorf("Licence %d is not held by %s", params.LicenseId, params.Address)
+	}
+
+	return nil
+}
+
+// checkTerms enforces a licence's expiry and origins and reports a spent
+// quota, leaving the terms in "terms" for MeterLicense and CreateToken.
+func checkTerms(r *gin.Context, params AuthParams) bool {
+	if err := licenseHolder(params); err != nil {
+		r.AbortWithError(401, err)
+		return false
+	}
+
+	terms, err := licenses.Lookup(r.Request.Context(), params.LicenseId)
+	if err != nil {
+		r.AbortWithError(503, err)
+		return false
+	}
+
+	if !terms.ExpiresAt.IsZero() {
+		r.Header("X-License-Expires", terms.ExpiresAt.UTC().Format(time.RFC3339))
+	}
+
+	if err := termsAllow(terms, params.Origin); err != nil {
+		r.AbortWithError(403, err)
+		return false
+	}
+
+	if terms.Quota > 0 {
+		e, err := licenses.Remaining(params.LicenseId, terms)
+		if err != nil {
+			r.AbortWithError(500, err)
+			return false
+		}
+
+		if !entitled(r, e) {
+			return false
+		}
+	}
+
+	r.Set("terms", terms)
+
+	return true
+}
+
+// termsAllow rejects a read after the licence's expiry or from an origin
+// it doesn't cover.
+func termsAllow(terms *licenses.Terms, origin string) error {
+	if terms.Expired() {
+		return fmt.Errorf("Licence expired at %s", terms.ExpiresAt.UTC().Format(time.RFC3339))
+	}
+
+	if !terms.AllowsOrigin(origin) {
+		return fmt.Errorf("Licence does not cover %s", origin)
+	}
+
+	return nil
+}
+
+// meter is a metered licence a read is charged against.
+type meter struct {
+	licenseId uint64
+	terms     *licenses.Terms
+	e         licenses.Entitlement
+}
+
+// refLicense finds the caller's licence for a block embedded in the one
+// being read and checks its terms as checkTerms does. A licence that
+// doesn't cover the read leaves the block out like one that isn't held.
+func refLicense(ctx context.Context, ref string, params AuthParams) (*meter, error) {
+	licenseId, ok := indexer.Held("BUILicenseNFT", ref, params.Address)
+	if !ok {
+		return nil, fmt.Errorf("Licence for %s has not been indexed", ref)
+	}
+
+	terms, err := licenses.Lookup(ctx, licenseId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := termsAllow(terms, params.Origin); err != nil {
+		return nil, blocks.NotLicensed(err.Error())
+	}
+
+	if terms.Quota > 0 {
+		e, err := licenses.Remaining(licenseId, terms)
+		if err != nil {
+			return nil, err
+		}
+
+		if e.Remaining == 0 {
+			return nil, blocks.NotLicensed("Licence quota is used up")
+		}
+	}
+
+	return &meter{licenseId: licenseId, terms: terms}, nil
+}
+
+// entitled sets the remaining entitlement headers and rejects the request
+// once nothing is left.
+func entitled(r *gin.Context, e licenses.Entitlement) bool {
+	r.Header("X-License-Remaining", strconv.FormatUint(e.Remaining, 10))
+	if !e.ResetsAt.IsZero() {
+		r.Header("X-License-Resets", e.ResetsAt.UTC().Format(time.RFC3339))
+	}
+
+	if e.Remaining > 0 {
+		return true
+	}
+
+	if !e.ResetsAt.IsZero() {
+		r.Header("Retry-After", strconv.Itoa(int(time.Until(e.ResetsAt).Seconds())+1))
+	}
+	r.AbortWithError(429, fmt.Errorf("Licence quota is used up"))
+
+	return false
+}
+
+// MeterLicense charges a read of the block against a metered licence, and
+// against the licence of every metered block it embeds. The reads are
+// taken before the rest of the chain runs, so concurrent requests can't
+// overrun a quota, and given back unless the block was actually written:
+// failed reads and 304s aren't charged.
+func MeterLicense(r *gin.Context) {
+	params := r.MustGet("params").(AuthParams)
+
+	var own *meter
+	var meters []*meter
+	if v, ok := r.Get("terms"); ok && v.(*licenses.Terms).Quota > 0 {
+		own = &meter{licenseId: params.LicenseId, terms: v.(*licenses.Terms)}
+		meters = append(meters, own)
+	}
+	if v, ok := r.Get("refMeters"); ok {
+		for _, m := range v.([]*meter) {
+			if m.terms.Quota > 0 {
+				meters = append(meters, m)
+			}
+		}
+	}
+
+	if len(meters) == 0 {
+		r.Next()
+		return
+	}
+
+	for i, m := range meters {
+		e, ok, err := licenses.Consume(m.licenseId, m.terms)
+		if err != nil || !ok {
+			refund(meters[:i])
+		}
+
+		if err != nil {
+			r.AbortWithError(500, err)
+			return
+		}
+
+		if !ok && m == own {
+			entitled(r, e)
+			return
+		} else if !ok {
+			r.AbortWithError(429, fmt.Errorf("Licence %d for an embedded block is used up", m.licenseId))
+			return
+		}
+
+		m.e = e
+	}
+
+	// Consume leaves the count after this read
+	if own != nil {
+		r.Header("X-License-Remaining", strconv.FormatUint(own.e.Remaining, 10))
+	}
+	r.Next()
+
+	if r.IsAborted() || r.Writer.Status() != 200 {
+		refund(meters)
+	}
+}
+
+func refund(meters []*meter) {
+	for _, m := range meters {
+		licenses.Refund(m.licenseId, m.terms, m.e)
+	}
+}
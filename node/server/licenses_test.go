@@ -0,0 +1,218 @@
+package server
+
+import (
+	"blocksui-node/config"
+	"blocksui-node/licenses"
+	"encoding/hex"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/umbracle/ethgo"
+)
+
+func TestLicenseToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	key := []byte("network key")
+	params := AuthParams{
+		Address:   ethgo.HexToAddress("0x00000000000000000000000000000000000000aa"),
+		BlockCID:  "0x1220aa",
+		Chain:     "mumbai",
+		IssueDate: time.Now().Add(-time.Minute).Format(time.RFC3339),
+		LicenseId: 9,
+		Origin:    "https://example.com",
+		Sig:       "0xsig",
+		TokenId:   3,
+		Type:      "license",
+	}
+
+	w := httptest.NewRecorder()
+	r, _ := gin.CreateTestContext(w)
+	r.Set("networkPrivKey", hex.EncodeToString(key))
+	r.Set("params", params)
+	CreateToken(&config.Config{TokenTTL: time.Hour})(r)
+
+	old, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"aud": params.Origin,
+		"sub": "mumbai:license:9:0x1220aa",
+		"iss": params.Address.String() + ":0xsig",
+		"nbf": float64(time.Now().Add(-time.Minute).Unix()),
+		"exp": float64(time.Now().Add(time.Hour).Unix()),
+	}).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		token     string
+		tokenId   uint64
+		licenseId uint64
+	}{
+		{"licence read", w.Body.String(), 3, 9},
+		{"issued before licence ids", old, 9, 9},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := gin.CreateTestContext(httptest.NewRecorder())
+			r.Set("networkPrivKey", hex.EncodeToString(key))
+			r.Params = gin.Params{{Key: "token", Value: tt.token}}
+
+			AuthenticateToken(r)
+			if r.IsAborted() {
+				t.Fatalf("got %v, want the token accepted", r.Errors)
+			}
+
+			got := r.MustGet("params").(AuthParams)
+			if got.TokenId != tt.tokenId || got.LicenseId != tt.licenseId {
+				t.Errorf("got token %d licence %d, want token %d licence %d", got.TokenId, got.LicenseId, tt.tokenId, tt.licenseId)
+			}
+			if got.BlockCID != params.BlockCID || got.Type != params.Type {
+				t.Errorf("got %s %s, want %s %s", got.Type, got.BlockCID, params.Type, params.BlockCID)
+			}
+		})
+	}
+}
+
+func TestMeterLicense(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// The block's token and the licence it is read under differ
+	params := AuthParams{TokenId: 3, LicenseId: 11, Type: "license"}
+	terms := &licenses.Terms{Quota: 2}
+
+	tests := []struct {
+		name      string
+		status    int
+		want      int
+		remaining uint64
+	}{
+		{"served", 200, 200, 1},
+		{"not modified", 304, 304, 1},
+		{"served again", 200, 200, 0},
+		{"used up", 200, 429, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/",
+				func(r *gin.Context) {
+					r.Set("params", params)
+					r.Set("terms", terms)
+				},
+				MeterLicense,
+				func(r *gin.Context) { r.Status(tt.status) },
+			)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+			if w.Code != tt.want {
+				t.Errorf("got status %d, want %d", w.Code, tt.want)
+			}
+
+			e, err := licenses.Remaining(params.LicenseId, terms)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e.Remaining != tt.remaining {
+				t.Errorf("got %d left on the licence, want %d", e.Remaining, tt.remaining)
+			}
+		})
+	}
+
+	e, err := licenses.Remaining(params.TokenId, terms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Remaining != terms.Quota {
+		t.Errorf("got %d left on the block's token id, want it untouched", e.Remaining)
+	}
+}
+
+func TestMeterRefLicenses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// The block is read by its owner, so only the licences for the blocks
+	// it embeds are charged
+	params := AuthParams{TokenId: 3, Type: "block"}
+	open := &meter{licenseId: 21, terms: &licenses.Terms{Quota: 5}}
+	scarce := &meter{licenseId: 22, terms: &licenses.Terms{Quota: 1}}
+
+	tests := []struct {
+		name   string
+		status int
+		want   int
+		open   uint64
+		scarce uint64
+	}{
+		{"not modified", 304, 304, 5, 1},
+		{"served", 200, 200, 4, 0},
+		{"embedded licence used up", 200, 429, 4, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/",
+				func(r *gin.Context) {
+					r.Set("params", params)
+					r.Set("refMeters", []*meter{
+						{licenseId: open.licenseId, terms: open.terms},
+						{licenseId: scarce.licenseId, terms: scarce.terms},
+					})
+				},
+				MeterLicense,
+				func(r *gin.Context) { r.Status(tt.status) },
+			)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+			if w.Code != tt.want {
+				t.Errorf("got status %d, want %d", w.Code, tt.want)
+			}
+
+			for _, m := range []struct {
+				meter *meter
+				want  uint64
+			}{{open, tt.open}, {scarce, tt.scarce}} {
+				e, err := licenses.Remaining(m.meter.licenseId, m.meter.terms)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if e.Remaining != m.want {
+					t.Errorf("got %d left on licence %d, want %d", e.Remaining, m.meter.licenseId, m.want)
+				}
+			}
+		})
+	}
+}
+
+func TestTermsAllow(t *testing.T) {
+	tests := []struct {
+		name  string
+		terms licenses.Terms
+		ok    bool
+	}{
+		{"no terms", licenses.Terms{}, true},
+		{"subscription", licenses.Terms{ExpiresAt: time.Now().Add(time.Hour)}, true},
+		{"expired", licenses.Terms{ExpiresAt: time.Now().Add(-time.Hour)}, false},
+		{"origin", licenses.Terms{Origins: []string{"https://example.com/"}}, true},
+		{"other origin", licenses.Terms{Origins: []string{"https://other.com"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := termsAllow(&tt.terms, "https://example.com")
+			if ok := err == nil; ok != tt.ok {
+				t.Errorf("got %v, want allowed %v", err, tt.ok)
+			}
+		})
+	}
+}
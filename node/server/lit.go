@@ -1,93 +1,109 @@
 package server
 
 import (
-	"blocksui-node/abi"
 	"blocksui-node/account"
 	"blocksui-node/config"
 	"blocksui-node/contracts"
 	"blocksui-node/ipfs"
 	"blocksui-node/lit"
 	"bytes"
+	"context"
 	"fmt"
 
 	"github.com/gin-gonic/gin"
-	goIpfs "github.com/ipfs/go-ipfs-api"
 )
 
+// sealedBlock is a block payload stored encrypted under a key saved to Lit.
+type sealedBlock struct {
+	Cid          string
+	B32Cid       string
+	Hint         *ipfs.CidHint
+	EncryptedKey string
+}
+
+// encryptBlock stores plaintext encrypted under a fresh key and saves the
+// key to Lit, released to the owner of root on contract. An empty root
+// binds the key to the new payload itself.
+func encryptBlock(ctx context.Context, c *config.Config, a *account.Account, store ipfs.BlockStore, contract *contracts.Contract, chain, root string, plaintext []byte) (*sealedBlock, error) {
+	symmetricKey := lit.Prng(32)
+	ciphertext := lit.AesEncrypt(symmetricKey, plaintext)
+
+	cid, err := store.Put(ctx, bytes.NewBuffer(ciphertext))
+	if err != nil {
+		return nil, err
+	}
+
+	b32Cid, hint, err := ipfs.CidToBytes32(cid)
+	if err != nil {
+		return nil, err
+	}
+
+	conditionCid := b32Cid
+	if root != "" {
+		conditionCid = root
+	}
+
+	authConditions, err := ownerConditions(contract, chain, conditionCid)
+	if err != nil {
+		return nil, err
+	}
+
+	// TODO: need a chain <> name map
+	authSig, err := a.Siwe("80001", "")
+	if err != nil {
+		return nil, err
+	}
+
+	litClient := lit.New(c)
+
+	encryptedKey, err := litClient.SaveEncryptionKey(
+		symmetricKey,
+		*authSig,
+		authConditions,
+		chain,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sealedBlock{
+		Cid:          cid,
+		B32Cid:       b32Cid,
+		Hint:         hint,
+		EncryptedKey: encryptedKey,
+	}, nil
+}
+
 func LitEncrypt(c *config.Config, a *account.Account) gin.HandlerFunc {
 	return func(r *gin.Context) {
-		ipfsClient := r.MustGet("ipfs").(*goIpfs.Shell)
+		store := r.MustGet("store").(ipfs.BlockStore)
 		plaintext := r.MustGet("block").([]byte)
 		metadata := r.MustGet("metadata").(*BlockMeta)
 
-		symmetricKey := lit.Prng(32)
-		ciphertext := lit.AesEncrypt(symmetricKey, plaintext)
-
-		cid, err := ipfsClient.Add(bytes.NewBuffer(ciphertext))
-		if err != nil {
-			r.AbortWithError(500, err)
-			return
-		}
-
-		b32Cid := ipfs.CidToBytes32(cid)
-
+		// A rotation may bind the key to another deployment
 		contract, ok := contracts.GetContract("BUIBlockNFT")
+		if v, set := r.Get("contract"); set {
+			contract, ok = v.(*contracts.Contract), true
+		}
 		if !ok {
 			r.AbortWithError(500, fmt.Errorf("Contract not found"))
 			return
 		}
 
-		method := contract.Abi.GetMethod("verifyOwner")
-		if method == nil {
-			r.AbortWithError(404, fmt.Errorf("Method not found"))
-			return
-		}
-
-		authConditions := []lit.EvmContractCondition{
-			lit.EvmContractCondition{
-				ContractAddress: contract.Address.String(),
-				Chain:           c.Chain(), // TODO: make this configurable
-				FunctionAbi:     abi.MethodToMember(method),
-				FunctionName:    "verifyOwner",
-				FunctionParams: []string{
-					b32Cid,
-					":userAddress",
-				},
-				ReturnValueTest: lit.ReturnValueTest{
-					Key:        "",
-					Comparator: "=",
-					Value:      "true",
-				},
-			},
-		}
-
-		// TODO: need a chain <> name map
-		authSig, err := a.Siwe("80001", "")
+		// Upgrades stay locked to the minted block so existing licences
+		// keep covering them
+		sealed, err := encryptBlock(r.Request.Context(), c, a, store, contract, c.Chain(), metadata.BUIProps.Root, plaintext) // TODO: make the chain configurable
 		if err != nil {
 			r.AbortWithError(500, err)
 			return
 		}
 
-		litClient := lit.New(c)
-
-		encryptedKey, err := litClient.SaveEncryptionKey(
-			symmetricKey,
-			*authSig,
-			authConditions,
-			c.Chain(),
-		)
-		if err != nil {
-			r.AbortWithError(500, err)
-			return
-		}
-
-		metadata.BUIProps = BUIProps{
-			Cid:          cid,
-			EncryptedKey: encryptedKey,
-		}
+		metadata.BUIProps.Cid = sealed.Cid
+		metadata.BUIProps.CidHint = sealed.Hint
+		metadata.BUIProps.EncryptedKey = sealed.EncryptedKey
 
 		r.Set("metadata", metadata)
-		r.Set("cid", b32Cid)
+		r.Set("cid", sealed.B32Cid)
 
 		r.Next()
 	}
@@ -0,0 +1,31 @@
+package server
+
+import (
+	"blocksui-node/config"
+	"blocksui-node/licenses"
+	"fmt"
+	"os"
+	"testing"
+)
+
+// testHome is the home the package's tests start the process-wide stores
+// in, since each can only be started once.
+var testHome string
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "bui-server")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	testHome = dir
+
+	if err := licenses.Start(&config.Config{HomeDir: dir}, nil); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
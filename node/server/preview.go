@@ -0,0 +1,56 @@
+package server
+
+import (
+	"blocksui-node/blocks"
+	"blocksui-node/catalog"
+	"blocksui-node/config"
+	"blocksui-node/ipfs"
+	"blocksui-node/pins"
+	"fmt"
+	"io"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetPreview serves a block's public preview without auth. Only CIDs a
+// block's metadata names as its preview are fetched, and only documents
+// compiled as previews are served, so the endpoint can't be used to read
+// anything else through the store.
+func GetPreview(c *config.Config) gin.HandlerFunc {
+	return func(r *gin.Context) {
+		store := r.MustGet("store").(ipfs.BlockStore)
+		cid := r.Param("cid")
+
+		if !catalog.HasPreview(cid) && !pins.Tracked(cid) {
+			r.AbortWithError(404, fmt.Errorf("%s is not a block preview", cid))
+			return
+		}
+
+		etag := `"` + cid + `"`
+		if notModified(r, etag) {
+			return
+		}
+
+		data, err := store.Get(r.Request.Context(), cid)
+		if err != nil {
+			r.AbortWithError(404, err)
+			return
+		}
+		defer data.Close()
+
+		preview, err := io.ReadAll(io.LimitReader(data, int64(c.MaxBlockSize)+1))
+		if err != nil {
+			r.AbortWithError(500, err)
+			return
+		}
+
+		if _, err := blocks.ParsePreview(preview); uint64(len(preview)) > c.MaxBlockSize || err != nil {
+			r.AbortWithError(404, fmt.Errorf("%s is not a block preview", cid))
+			return
+		}
+
+		r.Header("ETag", etag)
+		r.Header("Cache-Control", immutable)
+		r.Data(200, "application/json", preview)
+	}
+}
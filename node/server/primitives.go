@@ -0,0 +1,134 @@
+package server
+
+import (
+	"blocksui-node/primitives"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	immutable = "public, max-age=31536000, immutable"
+	// Labels and the default bundle can be repointed
+	shortCache = "public, max-age=300"
+)
+
+func notModified(r *gin.Context, etag string) bool {
+	for _, tag := range strings.Split(r.GetHeader("If-None-Match"), ",") {
+		if strings.TrimSpace(tag) == etag {
+			r.Status(304)
+			return true
+		}
+	}
+
+	return false
+}
+
+// selectBundle picks the primitives version from ?v=, which takes a version
+// label or a bundle CID. Without it the default bundle is used.
+func selectBundle(r *gin.Context) (*primitives.Bundle, bool) {
+	b, ok := primitives.Get(r.Query("v"))
+	if !ok {
+		r.AbortWithError(503, fmt.Errorf("Primitives %s are not loaded", primitives.Resolve(r.Query("v"))))
+		return nil, false
+	}
+
+	return b, true
+}
+
+func servePrimitive(r *gin.Context, path string) {
+	bundle, ok := selectBundle(r)
+	if !ok {
+		return
+	}
+
+	file, ok := bundle.File(path)
+	if !ok {
+		r.AbortWithError(404, fmt.Errorf("No primitive %s", path))
+		return
+	}
+
+	// Only a bundle CID pins the bytes for good
+	cache := shortCache
+	if r.Query("v") == bundle.Cid {
+		cache = immutable
+	}
+
+	r.Header("ETag", file.ETag())
+	r.Header("Cache-Control", cache)
+	r.Header("X-Integrity", file.Integrity)
+
+	if notModified(r, file.ETag()) {
+		return
+	}
+
+	r.Data(200, file.ContentType, file.Data())
+}
+
+func GetPrimitive(r *gin.Context) {
+	name := r.Param("name")
+	if name == "" {
+		r.AbortWithError(422, fmt.Errorf("No name"))
+		return
+	}
+
+	servePrimitive(r, "blocks/"+name)
+}
+
+func GetBlocksCSS(r *gin.Context) {
+	servePrimitive(r, "blocks/blocksui.css")
+}
+
+// GetPrimitivesManifest lists every primitive with its content type, hash,
+// size and SRI hash so embedders can pin what they load.
+func GetPrimitivesManifest(r *gin.Context) {
+	bundle, ok := selectBundle(r)
+	if !ok {
+		return
+	}
+
+	data, err := json.Marshal(bundle.Manifest())
+	if err != nil {
+		r.AbortWithError(500, err)
+		return
+	}
+
+	// The manifest only changes with the bundle, whose CID names it
+	etag := `"` + bundle.Cid + `"`
+	r.Header("ETag", etag)
+	r.Header("Cache-Control", "no-cache")
+
+	if notModified(r, etag) {
+		return
+	}
+
+	r.Data(200, "application/json", data)
+}
+
+type AddPrimitivesParams struct {
+	Cid     string `json:"cid" binding:"required"`
+	Version string `json:"version"`
+	Default bool   `json:"default"`
+}
+
+// AddPrimitives loads another bundle into the running node.
+func AddPrimitives(r *gin.Context) {
+	var params AddPrimitivesParams
+	if err := r.ShouldBind(&params); err != nil {
+		r.AbortWithError(422, err)
+		return
+	}
+
+	if _, err := primitives.Add(r.Request.Context(), params.Cid, params.Version, params.Default); err != nil {
+		r.AbortWithError(422, err)
+		return
+	}
+
+	r.JSON(200, primitives.List())
+}
+
+func ListPrimitives(r *gin.Context) {
+	r.JSON(200, primitives.List())
+}
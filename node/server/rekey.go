@@ -0,0 +1,260 @@
+package server
+
+import (
+	"blocksui-node/account"
+	"blocksui-node/blocks"
+	"blocksui-node/config"
+	"blocksui-node/contracts"
+	"blocksui-node/ipfs"
+	"blocksui-node/pins"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/umbracle/ethgo"
+)
+
+// RekeyOptions say where a block's key is bound now and where it should be
+// bound after re-keying. Zero values mean the configured BUIBlockNFT and
+// chain. Readers look keys up on the node's chain, so no other chain is
+// accepted.
+type RekeyOptions struct {
+	FromAddress ethgo.Address
+	ToAddress   ethgo.Address
+	Chain       string
+	DryRun      bool
+}
+
+// RekeyResult is one block's line in a migration report.
+type RekeyResult struct {
+	TokenId         uint64 `json:"tokenId"`
+	Cid             string `json:"cid,omitempty"`
+	FromMetadataURI string `json:"fromMetadataURI,omitempty"`
+	FromPayload     string `json:"fromPayload,omitempty"`
+	MetadataURI     string `json:"metadataURI,omitempty"`
+	Payload         string `json:"payload,omitempty"`
+	Version         int    `json:"version,omitempty"`
+	// Skipped is set when the newest version is already bound to the target
+	Skipped bool   `json:"skipped,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// RekeyReport is what a migration did to every block it was given.
+type RekeyReport struct {
+	From      string        `json:"from"`
+	To        string        `json:"to"`
+	Chain     string        `json:"chain"`
+	DryRun    bool          `json:"dryRun"`
+	StartedAt time.Time     `json:"startedAt"`
+	Results   []RekeyResult `json:"results"`
+}
+
+func (o RekeyOptions) contracts(c *config.Config) (*contracts.Contract, *contracts.Contract, error) {
+	if o.Chain != "" && o.Chain != c.Chain() {
+		return nil, nil, fmt.Errorf("Blocks are read on %s, keys saved on %s would never be found", c.Chain(), o.Chain)
+	}
+
+	current, ok := contracts.GetContract("BUIBlockNFT")
+	if !ok {
+		return nil, nil, fmt.Errorf("Contract not found BUIBlockNFT")
+	}
+
+	from, to := current, current
+	if o.FromAddress != ethgo.ZeroAddress {
+		if from, ok = contracts.ContractAt("BUIBlockNFT", o.FromAddress); !ok {
+			return nil, nil, fmt.Errorf("Contract not found BUIBlockNFT")
+		}
+	}
+	if o.ToAddress != ethgo.ZeroAddress {
+		if to, ok = contracts.ContractAt("BUIBlockNFT", o.ToAddress); !ok {
+			return nil, nil, fmt.Errorf("Contract not found BUIBlockNFT")
+		}
+	}
+
+	return from, to, nil
+}
+
+// Rekey decrypts the newest version of a block as its owner and publishes
+// it as a new version, encrypted under a fresh key bound to the block on
+// the target contract. Pointing the token at the new metadata is left to
+// the owner's wallet, as with any other version. A block whose newest
+// version already opens under the target is skipped.
+func Rekey(ctx context.Context, c *config.Config, a *account.Account, store ipfs.BlockStore, tokenId uint64, opts RekeyOptions) RekeyResult {
+	res := RekeyResult{TokenId: tokenId}
+	if err := rekey(ctx, c, a, store, opts, &res); err != nil {
+		res.Error = err.Error()
+	}
+
+	return res
+}
+
+// RekeyAll re-keys each block in turn. A failure is recorded in the
+// block's result and doesn't stop the rest.
+func RekeyAll(ctx context.Context, c *config.Config, a *account.Account, store ipfs.BlockStore, tokenIds []uint64, opts RekeyOptions) (*RekeyReport, error) {
+	from, to, err := opts.contracts(c)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &RekeyReport{
+		From:      from.Address.String(),
+		To:        to.Address.String(),
+		Chain:     c.Chain(),
+		DryRun:    opts.DryRun,
+		StartedAt: time.Now(),
+		Results:   make([]RekeyResult, 0, len(tokenIds)),
+	}
+
+	for _, tokenId := range tokenIds {
+		res := Rekey(ctx, c, a, store, tokenId, opts)
+		report.Results = append(report.Results, res)
+	}
+
+	return report, nil
+}
+
+func rekey(ctx context.Context, c *config.Config, a *account.Account, store ipfs.BlockStore, opts RekeyOptions, res *RekeyResult) error {
+	from, to, err := opts.contracts(c)
+	if err != nil {
+		return err
+	}
+
+	chain := c.Chain()
+
+	uri, err := tokenURIAt(from, opts.FromAddress, res.TokenId)
+	if err != nil {
+		return err
+	}
+
+	meta, err := ReadMetadata(ctx, store, uri)
+	if err != nil {
+		return err
+	}
+
+	root := meta.BUIProps.Root
+	if root == "" {
+		if root, _, err = ipfs.CidToBytes32(meta.BUIProps.Cid); err != nil {
+			return err
+		}
+	}
+	root = strings.ToLower(root)
+	res.Cid = root
+
+	// Upgrades published since the token was pointed anywhere are what
+	// readers see, so they are what gets carried over
+	parent, err := latestVersion(ctx, store, root, &blockVersion{meta, uri, meta.BUIProps.Cid})
+	if err != nil {
+		return err
+	}
+	res.FromMetadataURI = parent.URI
+	res.FromPayload = parent.Payload
+
+	authSig, err := a.Siwe("80001", "")
+	if err != nil {
+		return err
+	}
+
+	// A version an earlier run already re-keyed opens under the target's
+	// conditions, so running the migration again leaves it alone
+	conditions, err := ownerConditions(to, chain, root)
+	if err != nil {
+		return err
+	}
+
+	_, err = decryptWith(ctx, c, store, authSig, chain, conditions, parent.Meta, parent.Payload)
+	if err == nil {
+		res.Skipped = true
+		return nil
+	} else if _, ok := err.(*noKeyError); !ok || from.Address == to.Address {
+		return err
+	}
+
+	if conditions, err = ownerConditions(from, chain, root); err != nil {
+		return err
+	}
+
+	block, err := decryptWith(ctx, c, store, authSig, chain, conditions, parent.Meta, parent.Payload)
+	if err != nil {
+		return err
+	}
+
+	if !json.Valid(block) {
+		return fmt.Errorf("Block did not decrypt to JSON")
+	}
+
+	if opts.DryRun {
+		return nil
+	}
+
+	sealed, err := encryptBlock(ctx, c, a, store, to, chain, root, block)
+	if err != nil {
+		return err
+	}
+
+	metadata := *parent.Meta
+	metadata.BUIProps = nextVersion(root, parent)
+	metadata.BUIProps.Cid = sealed.Cid
+	metadata.BUIProps.CidHint = sealed.Hint
+	metadata.BUIProps.EncryptedKey = sealed.EncryptedKey
+
+	data, err := json.Marshal(&metadata)
+	if err != nil {
+		return err
+	}
+
+	metaCid, err := store.Put(ctx, bytes.NewBuffer(data))
+	if err != nil {
+		return err
+	}
+	metaURI := fmt.Sprintf("ipfs://%s", metaCid)
+
+	for _, cid := range []string{sealed.Cid, metaCid} {
+		if err := store.Pin(ctx, cid); err != nil {
+			return err
+		}
+	}
+
+	err = pins.TrackVersion(ctx, nil, res.TokenId, root, metaURI, metadata.Image, metadata.Preview, sealed.Cid)
+	if err != nil {
+		return err
+	}
+
+	err = blocks.AddVersion(root, blocks.Version{
+		Number:      metadata.BUIProps.Version,
+		Cid:         sealed.Cid,
+		MetadataURI: metaURI,
+		CreatedAt:   time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	res.MetadataURI = metaURI
+	res.Payload = sealed.Cid
+	res.Version = metadata.BUIProps.Version
+
+	return nil
+}
+
+// tokenURIAt reads the tokenURI from an earlier deployment directly, since
+// the index only follows the configured one.
+func tokenURIAt(contract *contracts.Contract, address ethgo.Address, tokenId uint64) (string, error) {
+	if address == ethgo.ZeroAddress {
+		return TokenURI(tokenId)
+	}
+
+	result, err := contract.Call("tokenURI", tokenId)
+	if err != nil {
+		return "", fmt.Errorf("Failed to fetch TokenURI")
+	}
+
+	uri, _ := result["0"].(string)
+	if uri == "" {
+		return "", fmt.Errorf("Token %d has no tokenURI", tokenId)
+	}
+
+	return uri, nil
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"blocksui-node/blocks"
+	"blocksui-node/config"
+	"blocksui-node/primitives"
+	"blocksui-node/render"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Rendered blocks are only for the licensee, so shared caches must not
+// keep them.
+const renderCache = "private, max-age=300"
+
+// renderPolicy allows nothing but the stylesheet and images, and only lets
+// the origin the token was issued for frame the block.
+func renderPolicy(styleSrc, origin string, gateways []string) string {
+	imgSrc := []string{"data:", "https:"}
+	for _, gw := range gateways {
+		if u, err := url.Parse(gw); err == nil && u.Scheme == "http" {
+			imgSrc = append(imgSrc, gw)
+		}
+	}
+
+	return strings.Join([]string{
+		"default-src 'none'",
+		"style-src " + styleSrc,
+		"img-src " + strings.Join(imgSrc, " "),
+		"base-uri 'none'",
+		"form-action 'none'",
+		"frame-ancestors " + origin,
+	}, "; ")
+}
+
+// RenderBlock serves the block as static HTML. ?css=link links
+// blocksui.css with its SRI hash instead of inlining it.
+func RenderBlock(c *config.Config) gin.HandlerFunc {
+	return func(r *gin.Context) {
+		params := r.MustGet("params").(AuthParams)
+		metadata := r.MustGet("metadata").(*BlockMeta)
+		doc := r.MustGet("document").(*blocks.Document)
+
+		// Tokens are issued per origin, so don't serve one to another site
+		if origin := r.GetHeader("Origin"); origin != "" && origin != params.Origin {
+			r.AbortWithError(403, fmt.Errorf("Token was issued for %s", params.Origin))
+			return
+		}
+
+		if doc == nil {
+			r.AbortWithError(422, fmt.Errorf("Block has no document to render"))
+			return
+		}
+
+		// Render with the primitives the block was compiled against when
+		// they're still loaded
+		bundle, ok := primitives.Get(metadata.Primitives)
+		if !ok {
+			if bundle, ok = primitives.Get(""); !ok {
+				r.AbortWithError(503, fmt.Errorf("No primitives bundle is loaded"))
+				return
+			}
+		}
+
+		css, ok := bundle.File("blocks/blocksui.css")
+		if !ok {
+			r.AbortWithError(503, fmt.Errorf("Primitives %s have no blocksui.css", bundle.Cid))
+			return
+		}
+
+		opts := render.Options{}
+		if len(c.IPFSGateways) > 0 {
+			opts.Gateway = strings.TrimRight(c.IPFSGateways[0], "/")
+		}
+
+		body, err := render.Render(doc, opts)
+		if err != nil {
+			r.AbortWithError(500, err)
+			return
+		}
+
+		var sheet render.Stylesheet
+		var styleSrc string
+		if r.Query("css") == "link" {
+			sheet.Href = "/primitives/blocksui.css?v=" + url.QueryEscape(bundle.Cid)
+			sheet.Integrity = css.Integrity
+			styleSrc = "'self'"
+		} else {
+			sum, err := hex.DecodeString(css.Hash)
+			if err != nil {
+				r.AbortWithError(500, err)
+				return
+			}
+
+			// The bundle is loaded by an admin, so its CSS is trusted
+			sheet.Inline = template.CSS(css.Data())
+			styleSrc = "'sha256-" + base64.StdEncoding.EncodeToString(sum) + "'"
+		}
+
+		html, err := render.Page(metadata.Name, body, sheet)
+		if err != nil {
+			r.AbortWithError(500, err)
+			return
+		}
+
+		sum := sha256.Sum256(html)
+		etag := `"` + hex.EncodeToString(sum[:]) + `"`
+
+		r.Header("Content-Security-Policy", renderPolicy(styleSrc, params.Origin, c.IPFSGateways))
+		r.Header("Cache-Control", renderCache)
+		r.Header("ETag", etag)
+		r.Header("Vary", "Origin")
+
+		if notModified(r, etag) {
+			return
+		}
+
+		r.Data(200, "text/html; charset=utf-8", html)
+	}
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"blocksui-node/render"
+	"crypto/sha256"
+	"encoding/base64"
+	"html/template"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRenderPolicy(t *testing.T) {
+	origin := "https://example.com"
+
+	tests := []struct {
+		name     string
+		styleSrc string
+		gateways []string
+		want     []string
+		not      []string
+	}{
+		{
+			name:     "inline stylesheet",
+			styleSrc: "'sha256-abc='",
+			want:     []string{"default-src 'none'", "style-src 'sha256-abc='", "frame-ancestors https://example.com", "base-uri 'none'", "form-action 'none'"},
+			not:      []string{"script-src", "'unsafe-inline'"},
+		},
+		{
+			name:     "linked stylesheet",
+			styleSrc: "'self'",
+			want:     []string{"style-src 'self'"},
+		},
+		{
+			name:     "local gateway",
+			styleSrc: "'self'",
+			gateways: []string{"http://127.0.0.1:8080", "https://ipfs.io"},
+			want:     []string{"img-src data: https: http://127.0.0.1:8080"},
+			not:      []string{"https://ipfs.io"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := renderPolicy(tt.styleSrc, origin, tt.gateways)
+
+			for _, want := range tt.want {
+				if !strings.Contains(policy, want) {
+					t.Errorf("got %q, want it to contain %q", policy, want)
+				}
+			}
+			for _, not := range tt.not {
+				if strings.Contains(policy, not) {
+					t.Errorf("got %q, want no %q", policy, not)
+				}
+			}
+		})
+	}
+}
+
+// The policy allows the inline stylesheet by hash, so the page has to
+// carry exactly the bytes that were hashed.
+func TestRenderInlineHash(t *testing.T) {
+	css := ".bui-button{color:red}\n.bui-box > p{margin:0}"
+
+	html, err := render.Page("Block", template.HTML("<p>hi</p>"), render.Stylesheet{Inline: template.CSS(css)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := regexp.MustCompile(`(?s)<style>(.*?)</style>`).FindSubmatch(html)
+	if m == nil {
+		t.Fatalf("got %s, want an inline stylesheet", html)
+	}
+
+	got := sha256.Sum256(m[1])
+	want := sha256.Sum256([]byte(css))
+	if got != want {
+		t.Errorf("got style %q, want %q", m[1], css)
+	}
+
+	policy := renderPolicy("'sha256-"+base64.StdEncoding.EncodeToString(want[:])+"'", "https://example.com", nil)
+	if !strings.Contains(policy, base64.StdEncoding.EncodeToString(got[:])) {
+		t.Errorf("got %q, want the stylesheet's hash allowed", policy)
+	}
+}
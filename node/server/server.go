@@ -2,16 +2,33 @@ package server
 
 import (
 	"blocksui-node/account"
+	"blocksui-node/analytics"
+	"blocksui-node/blocks"
+	"blocksui-node/catalog"
 	"blocksui-node/config"
 	"blocksui-node/contracts"
+	"blocksui-node/indexer"
+	"blocksui-node/ipfs"
+	"blocksui-node/licenses"
+	"blocksui-node/pins"
+	"blocksui-node/primitives"
+	"context"
 	"fmt"
+	"io"
 	"net/http"
+	"sync"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
 
-var router *gin.Engine
+var (
+	router *gin.Engine
+
+	mu         sync.Mutex
+	httpServer *http.Server
+	openStore  ipfs.BlockStore
+)
 
 func GetContractABIs(c *config.Config) gin.HandlerFunc {
 	return func(r *gin.Context) {
@@ -20,36 +37,127 @@ func GetContractABIs(c *config.Config) gin.HandlerFunc {
 	}
 }
 
-func Start(c *config.Config, a *account.Account) {
+func Healthcheck(daemon *ipfs.Supervisor) gin.HandlerFunc {
+	return func(r *gin.Context) {
+		if daemon == nil {
+			r.Status(200)
+			return
+		}
+
+		code := 200
+		if !daemon.Ready() {
+			code = 503
+		}
+
+		r.JSON(code, gin.H{"ipfs": daemon.Status()})
+	}
+}
+
+// Start serves the node's API until Shutdown, when it returns
+// http.ErrServerClosed.
+func Start(c *config.Config, a *account.Account, daemon *ipfs.Supervisor) error {
 	if c.Env == "production" {
 		gin.SetMode(gin.ReleaseMode)
 	}
+	store, err := ipfs.Open(c)
+	if err != nil {
+		return fmt.Errorf("[Store] %v", err)
+	}
+
+	mu.Lock()
+	openStore = store
+	mu.Unlock()
+
+	if err := pins.Start(c, store); err != nil {
+		fmt.Printf("[Pins] %v\n", err)
+	}
+
+	if err := primitives.Start(c, store); err != nil {
+		fmt.Printf("[Primitives] %v\n", err)
+	}
+
+	if err := blocks.StartLineage(c); err != nil {
+		fmt.Printf("[Lineage] %v\n", err)
+	}
+
+	if err := catalog.Start(c, store); err != nil {
+		fmt.Printf("[Catalog] %v\n", err)
+	}
+
+	if err := licenses.Start(c, store); err != nil {
+		fmt.Printf("[Licenses] %v\n", err)
+	}
+
+	if err := analytics.Start(c, a.Address); err != nil {
+		fmt.Printf("[Analytics] %v\n", err)
+	}
+
 	router := gin.Default()
 	router.SetTrustedProxies(nil)
 	router.Use(cors.Default())
 
 	// Routes
-	router.GET("/healthcheck", func(r *gin.Context) { r.Status(200) })
+	router.GET("/healthcheck", Healthcheck(daemon))
 	router.GET("/contracts/abis", GetContractABIs(c))
 
 	// Primitives
-	router.GET("/primitives/blocksui.css", GetBlocksCSS(c))
-	router.GET("/primitives/:name", GetPrimitive(c))
+	router.GET("/primitives/blocksui.css", GetBlocksCSS)
+	router.GET("/primitives/manifest.json", GetPrimitivesManifest)
+	router.GET("/primitives/:name", GetPrimitive)
+
+	// Admin
+	router.GET("/admin/primitives", AuthenticateAdmin(c), ListPrimitives)
+	router.POST("/admin/primitives", AuthenticateAdmin(c), AddPrimitives)
+	router.GET("/admin/analytics/export", AuthenticateAdmin(c), ExportAnalytics(a))
 
 	// Blocks
+	router.GET("/blocks", ListBlocks)
 	router.GET("/blocks/:token",
-		IPFSConnect,
+		UseStore(store),
+		AuthenticateNode(c, a),
+		AuthenticateToken,
+		AuthenticateBlock,
+		AuthenticateSignature,
+		RecordServe,
+		DecryptBlock(c),
+		ResolveRefs(c),
+		MeterLicense,
+		GetBlock,
+	)
+	router.GET("/blocks/preview/:cid", UseStore(store), GetPreview(c))
+	router.GET("/blocks/:token/render",
+		UseStore(store),
 		AuthenticateNode(c, a),
 		AuthenticateToken,
 		AuthenticateBlock,
 		AuthenticateSignature,
-		GetBlock(c),
+		DecryptBlock(c),
+		ResolveRefs(c),
+		MeterLicense,
+		RenderBlock(c),
 	)
+	router.POST("/blocks/:token/versions",
+		UseStore(store),
+		AuthenticateNode(c, a),
+		AuthenticateToken,
+		AuthenticateBlock,
+		AuthenticateSignature,
+		SelectParent,
+		TrackUploads,
+		CompileBlock(c),
+		LitEncrypt(c, a),
+		SaveMetadata,
+		PublishVersion,
+		VersionPublished,
+	)
+	router.GET("/bundles/:tokenId", UseStore(store), GetBundle)
 	router.POST("/blocks/compile",
-		IPFSConnect,
-		CompileBlock,
+		UseStore(store),
+		TrackUploads,
+		CompileBlock(c),
 		LitEncrypt(c, a),
 		SaveMetadata,
+		TrackPins,
 		func(r *gin.Context) {
 			cid := r.MustGet("cid").(string)
 			metaURI := r.MustGet("metaURI").(string)
@@ -61,6 +169,36 @@ func Start(c *config.Config, a *account.Account) {
 		},
 	)
 
+	// Creators
+	router.POST("/creator/token",
+		BindCreator,
+		AuthenticateNode(c, a),
+		AuthenticateSignature,
+		CreateCreatorToken(c),
+	)
+
+	creator := router.Group("/creator/blocks",
+		UseStore(store),
+		AuthenticateNode(c, a),
+		AuthenticateCreator,
+		AuthenticateSignature,
+	)
+	creator.GET("", ListCreatorBlocks)
+	creator.GET("/:tokenId/source", CreatorBlock, DecryptBlock(c), GetBlockSource)
+	creator.GET("/:tokenId/licenses", CreatorBlock, ListLicenseHolders)
+	creator.GET("/:tokenId/analytics", CreatorBlock, BlockAnalytics)
+	creator.PUT("/:tokenId/metadata", CreatorBlock, TrackUploads, UpdateMetadata(c), SaveMetadata, TrackMetadata)
+	creator.POST("/:tokenId/rotate",
+		CreatorBlock,
+		SelectParent,
+		TrackUploads,
+		RotateSource(c),
+		LitEncrypt(c, a),
+		SaveMetadata,
+		PublishVersion,
+		SourceRotated,
+	)
+
 	// Auth
 	router.POST("/auth/sign", AuthenticateNode(c, a), SignMessage(a))
 	router.POST("/auth/token",
@@ -80,6 +218,48 @@ func Start(c *config.Config, a *account.Account) {
 		CreateToken(c),
 	)
 
+	srv := &http.Server{Addr: c.Port, Handler: router}
+
+	mu.Lock()
+	httpServer = srv
+	mu.Unlock()
+
 	fmt.Printf("Node server running on port: %s\n", c.Port)
-	router.Run(c.Port)
+	return srv.ListenAndServe()
+}
+
+// Shutdown stops taking requests and waits for those in flight, then
+// saves what the licences, pins and indexer batch in memory, closes the
+// event log and closes the store.
+func Shutdown(ctx context.Context) {
+	mu.Lock()
+	srv, s := httpServer, openStore
+	mu.Unlock()
+
+	if srv != nil {
+		if err := srv.Shutdown(ctx); err != nil {
+			fmt.Printf("[Server] %v\n", err)
+		}
+	}
+
+	flushes := []struct {
+		name  string
+		flush func() error
+	}{
+		{"Licenses", licenses.Flush},
+		{"Pins", pins.Flush},
+		{"Indexer", indexer.Flush},
+		{"Analytics", analytics.Close},
+	}
+	for _, f := range flushes {
+		if err := f.flush(); err != nil {
+			fmt.Printf("[%s] %v\n", f.name, err)
+		}
+	}
+
+	if closer, ok := s.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			fmt.Printf("[Store] %v\n", err)
+		}
+	}
 }
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"blocksui-node/analytics"
+	"blocksui-node/config"
+	"blocksui-node/licenses"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/umbracle/ethgo"
+)
+
+func TestShutdownFlushes(t *testing.T) {
+	c := &config.Config{HomeDir: testHome}
+
+	if err := analytics.Start(c, ethgo.Address{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Both stay in memory until the next batched save
+	if _, _, err := licenses.Consume(7, &licenses.Terms{Quota: 10}); err != nil {
+		t.Fatal(err)
+	}
+	if err := analytics.Record("0xaa", 1, "block", "https://example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	Shutdown(context.Background())
+
+	tests := []struct {
+		file string
+		want string
+	}{
+		{"usage.json", `"7":{`},
+		{"events.log", `"block":"0xaa"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join(c.HomeDir, ".bui", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(data), tt.want) {
+				t.Errorf("got %s, want it to contain %s", data, tt.want)
+			}
+		})
+	}
+
+	if err := analytics.Record("0xaa", 1, "block", ""); err == nil {
+		t.Error("got a serve recorded after the shutdown, want an error")
+	}
+}
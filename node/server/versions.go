@@ -0,0 +1,199 @@
+package server
+
+import (
+	"blocksui-node/blocks"
+	"blocksui-node/ipfs"
+	"blocksui-node/pins"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// blockVersion is one version of a block: its metadata, the URI the
+// metadata lives at and the CID of its encrypted payload.
+type blockVersion struct {
+	Meta    *BlockMeta
+	URI     string
+	Payload string
+}
+
+// Number counts the minted block as version 1.
+func (v *blockVersion) Number() int {
+	if v.Meta.BUIProps.Version == 0 {
+		return 1
+	}
+
+	return v.Meta.BUIProps.Version
+}
+
+// readVersion reads the metadata at uri as a version of root. The minted
+// payload is addressed by the CID the licences name rather than whatever
+// its metadata says.
+func readVersion(ctx context.Context, store ipfs.BlockStore, root, uri string) (*blockVersion, error) {
+	meta, err := ReadMetadata(ctx, store, uri)
+	if err != nil {
+		return nil, err
+	}
+
+	if meta.BUIProps.Root == "" {
+		payload, err := ipfs.Bytes32ToCid(root, meta.BUIProps.CidHint)
+		if err != nil {
+			return nil, err
+		}
+
+		return &blockVersion{meta, uri, payload}, nil
+	}
+
+	if !strings.EqualFold(meta.BUIProps.Root, root) {
+		return nil, fmt.Errorf("Version %s does not belong to this block", strings.TrimPrefix(uri, "ipfs://"))
+	}
+
+	return &blockVersion{meta, uri, meta.BUIProps.Cid}, nil
+}
+
+// latestVersion is the newer of current, what the token points at on
+// chain, and the newest version published through this node. Versions
+// published elsewhere are only seen once the token points at them.
+func latestVersion(ctx context.Context, store ipfs.BlockStore, root string, current *blockVersion) (*blockVersion, error) {
+	local, ok := blocks.Latest(root)
+	if !ok || local.Number <= current.Number() {
+		return current, nil
+	}
+
+	return readVersion(ctx, store, root, local.MetadataURI)
+}
+
+// findVersion looks selector up in this node's lineage, then along the
+// metadata chain behind current, which every node can follow.
+func findVersion(ctx context.Context, store ipfs.BlockStore, root string, current *blockVersion, selector string) (*blockVersion, error) {
+	if v, ok := blocks.FindVersion(root, selector); ok {
+		return readVersion(ctx, store, root, v.MetadataURI)
+	}
+
+	chain := current.Meta.BUIProps.Lineage
+	for i := len(chain) - 1; i >= 0; i-- {
+		v, err := readVersion(ctx, store, root, chain[i])
+		if err != nil {
+			return nil, err
+		}
+
+		if v.Payload == selector || strings.TrimPrefix(v.URI, "ipfs://") == selector {
+			return v, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// resolveVersion picks the version a selector refers to. An empty
+// selector is what the token points at, "latest" the newest version known
+// and anything else the payload or metadata CID of one version in the
+// block's lineage.
+func resolveVersion(ctx context.Context, store ipfs.BlockStore, params AuthParams, selector string) (*blockVersion, int, error) {
+	uri, err := TokenURI(params.TokenId)
+	if err != nil {
+		return nil, 401, err
+	}
+
+	current, err := readVersion(ctx, store, params.BlockCID, uri)
+	if err != nil {
+		return nil, 422, err
+	}
+
+	switch selector {
+	case "", current.Payload, strings.TrimPrefix(uri, "ipfs://"):
+		return current, 0, nil
+	case "latest":
+		v, err := latestVersion(ctx, store, params.BlockCID, current)
+		if err != nil {
+			return nil, 422, err
+		}
+		return v, 0, nil
+	}
+
+	v, err := findVersion(ctx, store, params.BlockCID, current, selector)
+	if err != nil {
+		return nil, 422, err
+	} else if v == nil {
+		return nil, 404, fmt.Errorf("Version %s not found", selector)
+	}
+
+	return v, 0, nil
+}
+
+// SelectParent starts publishing a new version of the caller's block. The
+// parent is picked with ?parent=, "latest" by default, and the new version
+// extends its lineage.
+func SelectParent(r *gin.Context) {
+	params := r.MustGet("params").(AuthParams)
+	store := r.MustGet("store").(ipfs.BlockStore)
+
+	if params.Type != "block" {
+		r.AbortWithError(403, fmt.Errorf("Only the block owner can publish versions"))
+		return
+	}
+
+	parent, code, err := resolveVersion(r.Request.Context(), store, params, r.DefaultQuery("parent", "latest"))
+	if err != nil {
+		r.AbortWithError(code, err)
+		return
+	}
+
+	r.Set("parent", parent)
+	r.Set("lineage", nextVersion(params.BlockCID, parent))
+
+	r.Next()
+}
+
+// nextVersion is the lineage of a new version of root published on top of
+// parent.
+func nextVersion(root string, parent *blockVersion) BUIProps {
+	return BUIProps{
+		Root:    strings.ToLower(root),
+		Lineage: append(append([]string{}, parent.Meta.BUIProps.Lineage...), parent.URI),
+		Version: blocks.NextNumber(root, parent.Number()),
+	}
+}
+
+// PublishVersion records the new version in the block's lineage and keeps
+// its content pinned for as long as the minted block.
+func PublishVersion(r *gin.Context) {
+	params := r.MustGet("params").(AuthParams)
+	metadata := r.MustGet("metadata").(*BlockMeta)
+	metaURI := r.MustGet("metaURI").(string)
+	cid := r.MustGet("cid").(string)
+
+	upload := r.MustGet("upload").(*pins.Upload)
+
+	err := pins.TrackVersion(r.Request.Context(), upload, params.TokenId, params.BlockCID, metaURI, metadata.Image, metadata.Preview, metadata.BUIProps.Cid)
+	if err != nil {
+		r.AbortWithError(500, err)
+		return
+	}
+
+	err = blocks.AddVersion(params.BlockCID, blocks.Version{
+		Number:      metadata.BUIProps.Version,
+		Cid:         metadata.BUIProps.Cid,
+		MetadataURI: metaURI,
+		CreatedAt:   time.Now(),
+	})
+	if err != nil {
+		r.AbortWithError(500, err)
+		return
+	}
+
+	r.Set("published", gin.H{
+		"cid":         cid,
+		"metadataURI": metaURI,
+		"version":     metadata.BUIProps.Version,
+	})
+	r.Next()
+}
+
+func VersionPublished(r *gin.Context) {
+	r.JSON(http.StatusOK, r.MustGet("published"))
+}
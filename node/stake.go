@@ -0,0 +1,179 @@
+package main
+
+import (
+	"blocksui-node/account"
+	"blocksui-node/config"
+	"blocksui-node/contracts"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+)
+
+var (
+	// Stake Flags
+	stakeFlags  = flag.NewFlagSet("stake", flag.ExitOnError)
+	stakeDryRun = stakeFlags.Bool("dry-run", false, "--dry-run - Simulate the transaction without sending it")
+	stakeYes    = stakeFlags.Bool("yes", false, "--yes - Skip the confirmation prompt")
+	stakeJSON   = stakeFlags.Bool("json", false, "--json - Print the transaction plan as JSON")
+	stakeWei    = stakeFlags.Bool("wei", false, "--wei - Amounts are given in wei")
+)
+
+func stakeUsage() {
+	fmt.Println("")
+	fmt.Println("Usage: bui stake [status|topup <amount>|withdraw <amount>|rewards|claim] [OPTIONS]")
+	fmt.Println("")
+	stakeFlags.PrintDefaults()
+	fmt.Println("")
+}
+
+func printAmount(label string, chain contracts.Chain, wei *big.Int) {
+	fmt.Printf("%s: %s (%s wei)\n", label, chain.FormatUnits(wei), wei)
+}
+
+func stake(c *config.Config, args []string) {
+	if len(args) == 0 {
+		stakeUsage()
+		os.Exit(1)
+	}
+
+	cmd := args[0]
+	parseFlags(stakeFlags, args[1:])
+
+	switch cmd {
+	case "topup", "withdraw":
+		if stakeFlags.NArg() != 1 {
+			stakeUsage()
+			os.Exit(1)
+		}
+	default:
+		if stakeFlags.NArg() != 0 {
+			fmt.Printf("Unexpected arguments: %v\n", stakeFlags.Args())
+			stakeUsage()
+			os.Exit(1)
+		}
+	}
+
+	chain, ok := contracts.ChainForName(c.Chain())
+	if !ok {
+		fmt.Printf("Unknown chain: %s\n", c.Chain())
+		os.Exit(1)
+	}
+
+	out := os.Stdout
+	if *stakeJSON {
+		out = os.Stderr
+	}
+
+	if err := contracts.LoadContracts(c); err != nil {
+		fmt.Fprintf(out, "[Load Contracts] %v\n", err)
+		os.Exit(1)
+	}
+
+	a, err := account.LoadAccount(c)
+	if err != nil {
+		fmt.Fprintf(out, "[Load Accounts] %v\n", err)
+		os.Exit(1)
+	}
+
+	amount := func() *big.Int {
+		parse := chain.ParseUnits
+		if *stakeWei {
+			parse = contracts.ParseWei
+		}
+
+		wei, err := parse(stakeFlags.Arg(0))
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		if wei.Sign() == 0 {
+			fmt.Println("The amount must be more than zero")
+			os.Exit(1)
+		}
+
+		return wei
+	}
+
+	resolve := func(m contracts.Method) {
+		if err := contracts.Resolve("BUINodeStaking", m); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
+	send := func(method string, value *big.Int, prompt string, args ...interface{}) {
+		plan, err := contracts.Simulate(a.Address, "BUINodeStaking", method, value, args...)
+		if err != nil {
+			fmt.Fprintf(out, "[Simulate] %v\n", err)
+			os.Exit(1)
+		}
+
+		approve(out, plan, *stakeDryRun, *stakeYes, *stakeJSON, prompt)
+
+		receipt, err := contracts.Transact(a.Sender(), method, value, args...)
+		if err != nil {
+			fmt.Fprintln(out, err)
+			os.Exit(1)
+		}
+
+		fmt.Fprintf(out, "Transaction Hash: %s\n", receipt.TransactionHash)
+	}
+
+	switch cmd {
+	case "status":
+		cost, balance, err := contracts.StakeStatus(a.Address)
+		if err != nil {
+			fmt.Printf("[Stake Status] %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Account: %s\n", a.Address)
+		printAmount("Staking Cost", chain, cost)
+		printAmount("Stake", chain, balance)
+
+		if verified, err := contracts.Verify(a.Address); err == nil {
+			fmt.Printf("Registered: %t\n", verified)
+		}
+
+		record, err := contracts.Registration(a.Address)
+		if err != nil {
+			fmt.Printf("[Registration] %v\n", err)
+			os.Exit(1)
+		}
+
+		fmt.Println("Registration:")
+		for key, value := range record {
+			fmt.Printf("  %s: %v\n", key, value)
+		}
+	case "topup":
+		value := amount()
+		resolve(contracts.TopUpMethod)
+
+		send(contracts.TopUpMethod.Name, value, fmt.Sprintf("Add %s to your stake?", chain.FormatUnits(value)))
+		fmt.Fprintln(out, "Stake topped up.")
+	case "withdraw":
+		value := amount()
+		resolve(contracts.WithdrawMethod)
+
+		send(contracts.WithdrawMethod.Name, nil, fmt.Sprintf("Withdraw %s from your stake?", chain.FormatUnits(value)), value)
+		fmt.Fprintln(out, "Stake withdrawn.")
+	case "rewards":
+		rewards, err := contracts.PendingRewards(a.Address)
+		if err != nil {
+			fmt.Printf("[Rewards] %v\n", err)
+			os.Exit(1)
+		}
+
+		printAmount("Pending Rewards", chain, rewards)
+	case "claim":
+		resolve(contracts.ClaimMethod)
+
+		send(contracts.ClaimMethod.Name, nil, "Claim your pending rewards?")
+		fmt.Fprintln(out, "Rewards claimed.")
+	default:
+		stakeUsage()
+		os.Exit(1)
+	}
+}
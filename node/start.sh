@@ -14,7 +14,7 @@ if [ $? != 0 ]; then
 fi
 
 if [ $balance == 0 ]; then
-  bui register || exit 1
+  bui register --yes || exit 1
 fi
 
 modd -f $1